@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -25,11 +26,31 @@ const (
 
 func main() {
 	dsn := flag.String("dsn", "host=localhost port=5432 user=ddstats password=ddstats dbname=ddstats sslmode=disable", "PostgreSQL data source name")
+	ddAPIURL := flag.String("dd-api-url", ddapi.DefaultBaseURL, "Base URL of the Devil Daggers backend")
+	concurrency := flag.Int("concurrency", collector.DefaultConcurrency, "How many pages of the leaderboard to fetch at once")
+	snapshotRetention := flag.Duration("snapshot-retention", collector.DefaultSnapshotRetention, "How long to keep player snapshots of every run before downsampling them to weekly, 0 to keep them all")
+	daemon := flag.Bool("daemon", false, "Keep running and collect on a schedule, rather than once")
+	interval := flag.Duration("schedule", collector.DefaultSchedule.Interval, "How often to collect in daemon mode")
+	offset := flag.Duration("schedule-offset", collector.DefaultSchedule.Offset, "How long after midnight UTC the daemon schedule starts")
+	record := flag.String("record", "", "Directory to save the raw leaderboard pages from the DD API to")
+	replay := flag.String("replay", "", "Directory of leaderboard pages saved with -record to collect instead of the DD API")
+	dryRun := flag.Bool("dry-run", false, "Calculate the run and print it without writing to the database")
 	flag.Parse()
 
 	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
 	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
 
+	if *interval <= 0 {
+		errorLog.Fatal("schedule must be greater than 0")
+	}
+	schedule := collector.Schedule{Interval: *interval, Offset: *offset}
+	if *record != "" && *replay != "" {
+		errorLog.Fatal("only one of record and replay can be set")
+	}
+	if *dryRun && *daemon {
+		errorLog.Fatal("dry-run can't be used in daemon mode")
+	}
+
 	db, err := openDB(*dsn)
 	if err != nil {
 		errorLog.Fatal(err)
@@ -39,19 +60,53 @@ func main() {
 	// TODO: set up client appropriately
 	client := &http.Client{}
 
-	postgresDB := postgres.NewPostgres(client, db)
-
 	ddAPI := ddapi.NewAPI(client)
+	ddAPI.BaseURL = *ddAPIURL
+	switch {
+	case *record != "":
+		err = os.MkdirAll(*record, 0755)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		client.Transport = &ddapi.Recorder{Dir: *record}
+	case *replay != "":
+		// nothing is requested, so there is nothing to limit or retry
+		client.Transport = &ddapi.Replayer{Dir: *replay}
+		ddAPI.SetRateLimit(0, 0)
+		ddAPI.MaxRetries = 0
+	}
+
+	postgresDB := postgres.NewPostgres(ddAPI, db)
 
 	collector := collector.NewCollector(ddAPI, postgresDB, infoLog, errorLog)
+	collector.Concurrency = *concurrency
+	collector.SnapshotRetention = *snapshotRetention
+
+	if *dryRun {
+		run, err := collector.DryRun()
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		js, err := json.MarshalIndent(run, "", "  ")
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		fmt.Println(string(js))
+		return
+	}
 
 	done := make(chan bool)
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 
-	infoLog.Println("Starting the collector...")
 	start := time.Now()
-	go collector.Start()
+	if *daemon {
+		infoLog.Println("Starting the collector daemon...")
+		go collector.StartDaemon(schedule)
+	} else {
+		infoLog.Println("Starting the collector...")
+		go collector.Start()
+	}
 	go func() {
 		<-quit
 		fmt.Println("\r") // overwrites ^C char
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
 
 	"github.com/alexwilkerson/ddstats-server/gamesubmission"
@@ -20,6 +21,7 @@ import (
 	"github.com/alexwilkerson/ddstats-server/pkg/discord"
 
 	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
+	"github.com/alexwilkerson/ddstats-server/pkg/live"
 	"github.com/alexwilkerson/ddstats-server/pkg/socketio"
 	"github.com/alexwilkerson/ddstats-server/pkg/websocket"
 
@@ -42,6 +44,19 @@ func main() {
 	dsn := flag.String("dsn", "host=localhost port=5432 user=ddstats password=ddstats dbname=ddstats sslmode=disable", "PostgreSQL data source name")
 	discordToken := flag.String("discord-token", "wheaties", "Discord Bot Token")
 	disableDiscord := flag.Bool("disable-discord", false, "Disable the Discord Bot")
+	wsAllowedOrigins := flag.String("ws-allowed-origins", "", "Comma separated list of origins allowed to open a websocket, all origins are allowed if empty")
+	wsMaxConnsPerIP := flag.Int("ws-max-conns-per-ip", 0, "Maximum number of websocket connections per IP address, 0 for no limit")
+	wsTrustForwardedFor := flag.Bool("ws-trust-forwarded-for", false, "Limit websocket connections by the address in X-Forwarded-For, only set behind a reverse proxy which appends it")
+	wsViewerSecret := flag.String("ws-viewer-secret", "", "Secret used to sign viewer tokens for private websocket rooms")
+	wsPrivateRooms := flag.String("ws-private-rooms", "", "Comma separated list of websocket rooms which require a viewer token")
+	socketioLoginSecret := flag.String("socketio-login-secret", "", "Secret shared with the client to sign socket.io logins, the legacy login event is refused if set. It ships with the client, so it only makes spoofing harder and doesn't authenticate players")
+	socketioRejectLegacyLogin := flag.Bool("socketio-reject-legacy-login", false, "Refuse the legacy socket.io login event, which carries no token, even without a login secret")
+	sharedPresence := flag.Bool("shared-presence", false, "Read live players from the database so that players connected to other instances are included")
+	ddAPIURL := flag.String("dd-api-url", ddapi.DefaultBaseURL, "Base URL of the Devil Daggers backend")
+	ddAPICacheTTL := flag.Duration("dd-api-cache-ttl", ddapi.DefaultCacheTTL, "How long players looked up from the Devil Daggers backend are cached for, 0 to disable")
+	adminToken := flag.String("admin-token", "", "Bearer token required by the admin endpoints, which are disabled if empty")
+	playerTokenSecret := flag.String("player-token-secret", "", "Secret used to sign player tokens, which let players create and start their own races and set their notifications")
+	ddAPIRateLimit := flag.Float64("dd-api-rate-limit", ddapi.DefaultRequestsPerSecond, "Requests per second allowed to the Devil Daggers backend, 0 for no limit")
 	flag.Parse()
 
 	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
@@ -58,23 +73,50 @@ func main() {
 		Timeout: defaultTimeout,
 	}
 
-	postgresDB := postgres.NewPostgres(client, db)
+	ddAPI := ddapi.NewAPI(client)
+	ddAPI.BaseURL = *ddAPIURL
+	ddAPI.CacheTTL = *ddAPICacheTTL
+	ddAPI.SetRateLimit(*ddAPIRateLimit, ddapi.DefaultRequestBurst)
+
+	postgresDB := postgres.NewPostgres(ddAPI, db)
 
 	clientVersion, err := postgresDB.Releases.GetMostRecentVersion()
 	if err != nil {
 		errorLog.Fatal(err)
 	}
 
+	// rows left in the live table by a previous run of the server which were
+	// never cleaned up are expired here, and then periodically by the hub. The
+	// rest are kept alive by whichever instance the player is connected to.
+	expired, err := postgresDB.Live.DeleteStale(websocket.PresenceTTL)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	infoLog.Printf("Expired %d stale live players", expired)
+
 	websocketHub := websocket.NewHub(postgresDB)
+	websocketHub.SharedPresence = *sharedPresence
+	websocketHub.ViewerSecret = []byte(*wsViewerSecret)
+	websocketHub.PrivateRooms = make(map[string]bool)
+	for _, room := range strings.Split(*wsPrivateRooms, ",") {
+		if room = strings.TrimSpace(room); room != "" {
+			websocketHub.PrivateRooms[room] = true
+		}
+	}
 
-	ddAPI := ddapi.NewAPI(client)
+	websocketUpgrader := websocket.NewUpgrader(strings.Split(*wsAllowedOrigins, ","), *wsMaxConnsPerIP)
+	websocketUpgrader.TrustForwardedFor = *wsTrustForwardedFor
 
-	api, err := api.NewAPI(client, postgresDB, websocketHub, ddAPI, infoLog, errorLog)
+	api, err := api.NewAPI(client, postgresDB, websocketHub, websocketUpgrader, ddAPI, infoLog, errorLog)
 	if err != nil {
 		errorLog.Fatal(err)
 	}
+	api.AdminToken = *adminToken
+	api.PlayerSecret = []byte(*playerTokenSecret)
+
+	liveService := live.NewService(infoLog, errorLog, websocketHub, ddAPI, postgresDB)
 
-	socketioServer, err := socketio.NewServer(infoLog, errorLog, websocketHub, client, postgresDB)
+	socketioServer, err := socketio.NewServer(infoLog, errorLog, liveService, *socketioLoginSecret, *socketioRejectLegacyLogin)
 	if err != nil {
 		errorLog.Fatal(err)
 	}
@@ -119,6 +161,8 @@ func main() {
 
 	go websocketHub.Start()
 	defer websocketHub.Close()
+	go liveService.Start()
+	defer liveService.Close()
 	go socketioServer.Serve()
 	defer socketioServer.Close()
 
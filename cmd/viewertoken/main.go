@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/websocket"
+)
+
+// viewertoken prints a signed token which allows a viewer to join a private
+// websocket room, such as a tournament broadcast, or with -player a token
+// which lets a player create races and set their notifications
+func main() {
+	secret := flag.String("secret", "", "Secret passed to the server with -ws-viewer-secret, or -player-token-secret for a player token")
+	room := flag.String("room", "", "Name of the private room")
+	player := flag.Int("player", 0, "ID of the player to sign a player token for, instead of a viewer token")
+	ttl := flag.Duration("ttl", 24*time.Hour, "How long the token is valid for")
+	flag.Parse()
+
+	if *secret == "" || (*room == "") == (*player == 0) {
+		log.Fatal("-secret and one of -room or -player are required")
+	}
+
+	expires := time.Now().Add(*ttl)
+	if *player != 0 {
+		fmt.Println(websocket.SignPlayerToken([]byte(*secret), *player, expires))
+		return
+	}
+	fmt.Println(websocket.SignViewerToken([]byte(*secret), *room, expires))
+}
@@ -1,23 +1,28 @@
 module github.com/alexwilkerson/ddstats-server
 
-go 1.13
+go 1.20
 
 require (
 	github.com/bmizerany/pat v0.0.0-20170815010413-6226ea591a40
 	github.com/bwmarrin/discordgo v0.20.2
 	github.com/golang/protobuf v1.4.2
-	github.com/googollee/go-engine.io v1.4.2 // indirect
 	github.com/googollee/go-socket.io v1.4.3-0.20191220165003-799291763859
 	github.com/gorilla/websocket v1.4.1
 	github.com/jmoiron/sqlx v1.2.0
 	github.com/justinas/alice v1.2.0
 	github.com/lib/pq v1.3.0
 	github.com/soheilhy/cmux v0.1.4
-	golang.org/x/crypto v0.0.0-20200109152110-61a87790db17 // indirect
-	golang.org/x/sys v0.0.0-20200107162124-548cf772de50 // indirect
 	golang.org/x/text v0.3.2
 	google.golang.org/grpc v1.36.0
-	google.golang.org/grpc/examples v0.0.0-20210305213134-61f0b5fa7c1c // indirect
 	google.golang.org/protobuf v1.25.0
 	gopkg.in/guregu/null.v3 v3.4.0
 )
+
+require (
+	github.com/googollee/go-engine.io v1.4.2 // indirect
+	golang.org/x/crypto v0.0.0-20200109152110-61a87790db17 // indirect
+	golang.org/x/net v0.0.0-20190404232315-eb5bcb51f2a3 // indirect
+	golang.org/x/sys v0.0.0-20200107162124-548cf772de50 // indirect
+	google.golang.org/genproto v0.0.0-20200806141610-86f49bd18e98 // indirect
+	google.golang.org/grpc/examples v0.0.0-20210305213134-61f0b5fa7c1c // indirect
+)
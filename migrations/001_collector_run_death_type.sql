@@ -0,0 +1,59 @@
+-- Moves the death type counts of the collector runs out of the sixteen
+-- columns of collector_run and into collector_run_death_type, so that new
+-- death types don't need a new column. Run it once against a database which
+-- was created before collector_run_death_type existed:
+--
+--   psql -d ddstats -f migrations/001_collector_run_death_type.sql
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS collector_run_death_type (
+  collector_run_id BIGINT REFERENCES collector_run(id) ON UPDATE CASCADE ON DELETE CASCADE,
+  death_type TEXT NOT NULL,
+  count INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (collector_run_id, death_type)
+);
+
+INSERT INTO collector_run_death_type(collector_run_id, death_type, count)
+SELECT collector_run.id, counts.death_type, counts.count
+FROM collector_run
+CROSS JOIN LATERAL (VALUES
+  ('FALLEN', fallen),
+  ('SWARMED', swarmed),
+  ('IMPALED', impaled),
+  ('GORED', gored),
+  ('INFESTED', infested),
+  ('OPENED', opened),
+  ('PURGED', purged),
+  ('DESECRATED', desecrated),
+  ('SACRIFICED', sacrificed),
+  ('EVISCERATED', eviscerated),
+  ('ANNIHILATED', annihilated),
+  ('INTOXICATED', intoxicated),
+  ('ENVENMONATED', envenmonated),
+  ('INCARNATED', incarnated),
+  ('DISCARNATED', discarnated),
+  ('BARBED', barbed)
+) AS counts(death_type, count)
+WHERE counts.count > 0
+ON CONFLICT (collector_run_id, death_type) DO NOTHING;
+
+ALTER TABLE collector_run
+  DROP COLUMN fallen,
+  DROP COLUMN swarmed,
+  DROP COLUMN impaled,
+  DROP COLUMN gored,
+  DROP COLUMN infested,
+  DROP COLUMN opened,
+  DROP COLUMN purged,
+  DROP COLUMN desecrated,
+  DROP COLUMN sacrificed,
+  DROP COLUMN eviscerated,
+  DROP COLUMN annihilated,
+  DROP COLUMN intoxicated,
+  DROP COLUMN envenmonated,
+  DROP COLUMN incarnated,
+  DROP COLUMN discarnated,
+  DROP COLUMN barbed;
+
+COMMIT;
@@ -0,0 +1,57 @@
+-- Repartitions the collector's player snapshots by month instead of by run,
+-- so that a player's history doesn't read a partition for every run. The
+-- snapshots are copied into the new table, which takes a while on a large
+-- database, and the partitions of every run are dropped. Run it once against
+-- a database which was created before collector_player_snapshot had a
+-- time_stamp column:
+--
+--   psql -d ddstats -f migrations/002_collector_player_snapshot_by_month.sql
+
+BEGIN;
+
+ALTER TABLE IF EXISTS collector_player_snapshot RENAME TO collector_player_snapshot_by_run;
+ALTER INDEX IF EXISTS collector_player_snapshot_pkey RENAME TO collector_player_snapshot_by_run_pkey;
+
+CREATE TABLE collector_player_snapshot (
+  collector_run_id BIGINT NOT NULL REFERENCES collector_run(id) ON UPDATE CASCADE ON DELETE CASCADE,
+  time_stamp TIMESTAMP WITH TIME ZONE NOT NULL,
+  collector_player_id INTEGER NOT NULL,
+  rank INTEGER NOT NULL DEFAULT 0,
+  game_time DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+  overall_deaths BIGINT NOT NULL DEFAULT 0,
+  overall_game_time DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+  PRIMARY KEY (collector_run_id, collector_player_id, time_stamp)
+) PARTITION BY RANGE (time_stamp);
+
+CREATE INDEX collector_player_snapshot_collector_player_id_time_stamp_idx ON collector_player_snapshot(collector_player_id, time_stamp);
+
+-- a partition for every month with a run, named as the collector names them
+DO $$
+DECLARE
+  month TIMESTAMP;
+BEGIN
+  FOR month IN
+    SELECT DISTINCT date_trunc('month', time_stamp AT TIME ZONE 'UTC')
+    FROM collector_run
+  LOOP
+    EXECUTE format(
+      'CREATE TABLE IF NOT EXISTS %I PARTITION OF collector_player_snapshot FOR VALUES FROM (%L) TO (%L)',
+      'collector_player_snapshot_' || to_char(month, 'YYYY_MM'),
+      month::TEXT || '+00',
+      (month + INTERVAL '1 month')::TEXT || '+00'
+    );
+  END LOOP;
+END $$;
+
+DO $$
+BEGIN
+  IF to_regclass('collector_player_snapshot_by_run') IS NOT NULL THEN
+    INSERT INTO collector_player_snapshot(collector_run_id, time_stamp, collector_player_id, rank, game_time, overall_deaths, overall_game_time)
+    SELECT collector_run_id, collector_run.time_stamp, collector_player_id, rank, game_time, overall_deaths, overall_game_time
+    FROM collector_player_snapshot_by_run
+    JOIN collector_run ON collector_run_id=collector_run.id;
+    DROP TABLE collector_player_snapshot_by_run;
+  END IF;
+END $$;
+
+COMMIT;
@@ -0,0 +1,12 @@
+-- Adds the source of each game, which marks the games recovered from live
+-- states. Every game already in the database was submitted by the client.
+-- Run it once against a database which was created before game had a source
+-- column:
+--
+--   psql -d ddstats -f migrations/003_game_source.sql
+
+BEGIN;
+
+ALTER TABLE game ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT 'client';
+
+COMMIT;
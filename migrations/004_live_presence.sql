@@ -0,0 +1,18 @@
+-- Adds what the live table needs to share presence between instances: the
+-- player's status and game time, when they logged in and when their instance
+-- last saw them, which stale rows are expired by. Run it once against a
+-- database which was created before live had a last_seen column:
+--
+--   psql -d ddstats -f migrations/004_live_presence.sql
+
+BEGIN;
+
+ALTER TABLE live
+  ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS game_time DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+  ADD COLUMN IF NOT EXISTS logged_in TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  ADD COLUMN IF NOT EXISTS last_seen TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS live_last_seen_idx ON live(last_seen);
+
+COMMIT;
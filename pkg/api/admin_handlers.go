@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+)
+
+const (
+	defaultAnomalyLimit = 50
+	maxAnomalyLimit     = 500
+)
+
+// getAnomalies returns the most recent anomalies flagged by the collector,
+// which are pending review unless another status is asked for. A status of
+// all returns every anomaly.
+func (api *API) getAnomalies(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = models.AnomalyPending
+	case "all":
+		status = ""
+	case models.AnomalyPending, models.AnomalyConfirmed, models.AnomalyDismissed:
+	default:
+		api.clientMessage(w, http.StatusBadRequest, "status must be pending, confirmed, dismissed or all")
+		return
+	}
+
+	limit := defaultAnomalyLimit
+	if r.URL.Query().Get("limit") != "" {
+		var err error
+		limit, err = strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil {
+			api.clientMessage(w, http.StatusBadRequest, "limit must be an integer")
+			return
+		}
+		if limit < 1 || limit > maxAnomalyLimit {
+			api.clientMessage(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxAnomalyLimit))
+			return
+		}
+	}
+
+	anomalies, err := api.db.CollectorAnomalies.Select(status, limit)
+	if err != nil {
+		api.serverError(w, err)
+		return
+	}
+
+	api.writeJSON(w, struct {
+		Anomalies []*models.CollectorAnomaly `json:"anomalies"`
+	}{
+		Anomalies: anomalies,
+	})
+}
+
+// reviewAnomaly sets the review status of an anomaly
+func (api *API) reviewAnomaly(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ID     int    `json:"id"`
+		Status string `json:"status"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		api.clientMessage(w, http.StatusBadRequest, "malformed data")
+		return
+	}
+	if body.ID < 1 {
+		api.clientMessage(w, http.StatusBadRequest, "id must be a positive integer")
+		return
+	}
+
+	err = api.db.CollectorAnomalies.Review(body.ID, body.Status)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidAnomalyStatus):
+			api.clientMessage(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, models.ErrNoRecord):
+			api.clientMessage(w, http.StatusNotFound, "anomaly not found")
+		default:
+			api.serverError(w, err)
+		}
+		return
+	}
+
+	api.clientMessage(w, http.StatusOK, "anomaly reviewed")
+}
@@ -18,13 +18,20 @@ type API struct {
 	client               *http.Client
 	db                   *postgres.Postgres
 	websocketHub         *websocket.Hub
+	websocketUpgrader    *websocket.Upgrader
 	ddAPI                *ddapi.API
 	infoLog              *log.Logger
 	errorLog             *log.Logger
 	currentClientVersion string
+	// AdminToken is the bearer token required by the admin endpoints, which
+	// are disabled if it is empty
+	AdminToken string
+	// PlayerSecret signs the player tokens which let players act for
+	// themselves, such as creating races and setting their notifications
+	PlayerSecret []byte
 }
 
-func NewAPI(client *http.Client, db *postgres.Postgres, websocketHub *websocket.Hub, ddapi *ddapi.API, infoLog, errorLog *log.Logger) (*API, error) {
+func NewAPI(client *http.Client, db *postgres.Postgres, websocketHub *websocket.Hub, websocketUpgrader *websocket.Upgrader, ddapi *ddapi.API, infoLog, errorLog *log.Logger) (*API, error) {
 	clientVersion, err := db.Releases.GetMostRecentVersion()
 	if err != nil {
 		return nil, err
@@ -33,6 +40,7 @@ func NewAPI(client *http.Client, db *postgres.Postgres, websocketHub *websocket.
 		client:               client,
 		db:                   db,
 		websocketHub:         websocketHub,
+		websocketUpgrader:    websocketUpgrader,
 		ddAPI:                ddapi,
 		infoLog:              infoLog,
 		errorLog:             errorLog,
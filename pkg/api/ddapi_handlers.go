@@ -1,12 +1,38 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
 )
 
+// defaultNeighborhoodRadius is the number of ranks shown on either side of a
+// player by default
+const defaultNeighborhoodRadius = 5
+
+// ddAPIError responds with the status matching an error from the DD API: not
+// found when there is no such player, and a gateway error when the DD API
+// couldn't be reached or its response couldn't be used
+func (api *API) ddAPIError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ddapi.ErrPlayerNotFound), errors.Is(err, ddapi.ErrNoPlayersFound):
+		api.clientMessage(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ddapi.ErrInvalidRadius):
+		api.clientMessage(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, ddapi.ErrNetwork):
+		api.errorLog.Println(err)
+		api.clientMessage(w, http.StatusServiceUnavailable, ddapi.ErrNetwork.Error())
+	case errors.Is(err, ddapi.ErrStatusCode), errors.Is(err, ddapi.ErrDecode):
+		api.errorLog.Println(err)
+		api.clientMessage(w, http.StatusBadGateway, err.Error())
+	default:
+		api.serverError(w, err)
+	}
+}
+
 func (api *API) ddGetUserByRank(w http.ResponseWriter, r *http.Request) {
 	rank, err := strconv.Atoi(r.URL.Query().Get("rank"))
 	if err != nil {
@@ -19,9 +45,9 @@ func (api *API) ddGetUserByRank(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	player, err := api.ddAPI.UserByRank(rank)
+	player, err := api.ddAPI.UserByRankContext(r.Context(), rank)
 	if err != nil {
-		api.clientMessage(w, http.StatusNotFound, err.Error())
+		api.ddAPIError(w, err)
 		return
 	}
 
@@ -40,9 +66,9 @@ func (api *API) ddGetUserByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	player, err := api.ddAPI.UserByID(id)
+	player, err := api.ddAPI.UserByIDContext(r.Context(), id)
 	if err != nil {
-		api.clientMessage(w, http.StatusNotFound, err.Error())
+		api.ddAPIError(w, err)
 		return
 	}
 
@@ -56,9 +82,9 @@ func (api *API) ddUserSearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	players, err := api.ddAPI.UserSearch(name)
+	players, err := api.ddAPI.UserSearchContext(r.Context(), name)
 	if err != nil {
-		api.clientMessage(w, http.StatusNotFound, err.Error())
+		api.ddAPIError(w, err)
 		return
 	}
 
@@ -102,11 +128,47 @@ func (api *API) ddGetScores(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	leaderboard, err := api.ddAPI.GetLeaderboard(limit, offsetInt)
+	leaderboard, err := api.ddAPI.GetLeaderboardContext(r.Context(), limit, offsetInt)
 	if err != nil {
-		api.clientMessage(w, http.StatusNotFound, err.Error())
+		api.ddAPIError(w, err)
 		return
 	}
 
 	api.writeJSON(w, leaderboard)
 }
+
+func (api *API) ddNeighborhood(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		api.clientMessage(w, http.StatusBadRequest, "id must be an integer")
+		return
+	}
+
+	if id < 1 {
+		api.clientMessage(w, http.StatusBadRequest, "negative id not allowed")
+		return
+	}
+
+	radius := defaultNeighborhoodRadius
+	_, ok := r.URL.Query()["radius"]
+	if ok {
+		radius, err = strconv.Atoi(r.URL.Query().Get("radius"))
+		if err != nil {
+			api.clientMessage(w, http.StatusBadRequest, "radius must be an integer")
+			return
+		}
+
+		if radius < 1 || radius > ddapi.MaxNeighborhoodRadius {
+			api.clientMessage(w, http.StatusBadRequest, fmt.Sprintf("radius must be between 1 and %d", ddapi.MaxNeighborhoodRadius))
+			return
+		}
+	}
+
+	neighborhood, err := api.ddAPI.NeighborhoodContext(r.Context(), id, radius)
+	if err != nil {
+		api.ddAPIError(w, err)
+		return
+	}
+
+	api.writeJSON(w, neighborhood)
+}
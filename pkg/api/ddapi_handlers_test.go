@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
+	"github.com/alexwilkerson/ddstats-server/pkg/ddapi/ddapitest"
+)
+
+func newTestAPI(ddAPI *ddapi.API) *API {
+	logger := log.New(ioutil.Discard, "", 0)
+	return &API{ddAPI: ddAPI, infoLog: logger, errorLog: logger}
+}
+
+func TestDDGetUserByID(t *testing.T) {
+	s := ddapitest.NewServer(&ddapi.Player{PlayerID: 21854, PlayerName: "xvlv", Rank: 3, GameTime: 1183.4567, DeathType: "GORED", OverallDeaths: 1})
+	defer s.Close()
+	api := newTestAPI(s.API())
+
+	tests := []struct {
+		id     string
+		status int
+	}{
+		{"21854", http.StatusOK},
+		{"1", http.StatusNotFound},
+		{"-1", http.StatusBadRequest},
+		{"abc", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			api.ddGetUserByID(rr, httptest.NewRequest(http.MethodGet, "/api/v2/dd/user/id?id="+tt.id, nil))
+			if rr.Code != tt.status {
+				t.Fatalf("got status %d; want %d", rr.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var player ddapi.Player
+			err := json.Unmarshal(rr.Body.Bytes(), &player)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if player.PlayerName != "xvlv" || player.GameTime != 1183.4567 || player.DeathType != "GORED" {
+				t.Errorf("got %+v", player)
+			}
+		})
+	}
+}
+
+func TestDDNeighborhood(t *testing.T) {
+	var players []*ddapi.Player
+	for i := 1; i <= 20; i++ {
+		players = append(players, &ddapi.Player{PlayerID: uint64(100 + i), PlayerName: "player", Rank: uint32(i), GameTime: 1000 - float64(i), OverallDeaths: 1})
+	}
+	s := ddapitest.NewServer(players...)
+	defer s.Close()
+	api := newTestAPI(s.API())
+
+	tests := []struct {
+		query   string
+		status  int
+		players int
+	}{
+		{"id=110", http.StatusOK, 2*defaultNeighborhoodRadius + 1},
+		{"id=101&radius=2", http.StatusOK, 3},
+		{"id=110&radius=0", http.StatusBadRequest, 0},
+		{"id=110&radius=51", http.StatusBadRequest, 0},
+		{"id=1", http.StatusNotFound, 0},
+		{"radius=2", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			api.ddNeighborhood(rr, httptest.NewRequest(http.MethodGet, "/api/v2/ddapi/neighborhood?"+tt.query, nil))
+			if rr.Code != tt.status {
+				t.Fatalf("got status %d; want %d", rr.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var neighborhood struct {
+				Players []struct {
+					Rank        int     `json:"rank"`
+					GameTimeGap float64 `json:"game_time_gap"`
+				} `json:"players"`
+			}
+			err := json.Unmarshal(rr.Body.Bytes(), &neighborhood)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(neighborhood.Players) != tt.players {
+				t.Errorf("got %d players; want %d", len(neighborhood.Players), tt.players)
+			}
+		})
+	}
+}
+
+func TestDDAPIErrorStatus(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+	s := ddapitest.NewServer()
+	defer s.Close()
+
+	tests := []struct {
+		name    string
+		baseURL string
+		status  int
+	}{
+		{"not found", s.URL, http.StatusNotFound},
+		{"bad status", failing.URL, http.StatusBadGateway},
+		{"unreachable", unreachable.URL, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPI(&ddapi.API{Client: http.DefaultClient, BaseURL: tt.baseURL})
+			for _, handler := range []struct {
+				name  string
+				serve http.HandlerFunc
+				query string
+			}{
+				{"user by id", api.ddGetUserByID, "id=1"},
+				{"user by rank", api.ddGetUserByRank, "rank=1"},
+				{"search", api.ddUserSearch, "name=xvlv"},
+				{"neighborhood", api.ddNeighborhood, "id=1"},
+			} {
+				rr := httptest.NewRecorder()
+				handler.serve(rr, httptest.NewRequest(http.MethodGet, "/api/v2/ddapi?"+handler.query, nil))
+				if rr.Code != tt.status {
+					t.Errorf("%s: got status %d; want %d", handler.name, rr.Code, tt.status)
+				}
+			}
+		})
+	}
+}
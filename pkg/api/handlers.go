@@ -8,7 +8,9 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/alexwilkerson/ddstats-server/pkg/catalog"
 	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
 
 	"github.com/alexwilkerson/ddstats-server/pkg/models"
@@ -16,22 +18,51 @@ import (
 )
 
 const (
-	BronzeDaggerThreshold float64 = 60
-	SilverDaggerThreshold float64 = 120
-	GoldDaggerThreshold   float64 = 250
-	DevilDaggerThreshold  float64 = 500
-	PacifistSpawnset              = "Pacifist"
-	LevelOneSpawnset              = "Level One"
-	LevelTwoSpawnset              = "Level Two"
-	LevelThreeSpawnset            = "Level Three"
-	MaxHomingSpawnset             = "Max Homing"
-	PinkRunSpawnset               = "Pink Run"
+	PacifistSpawnset   = "Pacifist"
+	LevelOneSpawnset   = "Level One"
+	LevelTwoSpawnset   = "Level Two"
+	LevelThreeSpawnset = "Level Three"
+	MaxHomingSpawnset  = "Max Homing"
+	PinkRunSpawnset    = "Pink Run"
 )
 
+const (
+	eventsKeepAliveInterval = 15 * time.Second
+	defaultPlaySessionLimit = 10
+	maxPlaySessionLimit     = 50
+	defaultHistoryPeriod    = 365 * 24 * time.Hour
+	defaultTrendsPeriod     = 365 * 24 * time.Hour
+)
+
+// getDaily returns the summary of the most recent collector run, or of the run
+// with the run_id, or of the last run on the date
 func (api *API) getDaily(w http.ResponseWriter, r *http.Request) {
-	run, err := api.db.CollectorRuns.SelectMostRecent()
+	var run *models.CollectorRun
+	var err error
+	switch {
+	case r.URL.Query().Get("run_id") != "":
+		runID, convErr := strconv.Atoi(r.URL.Query().Get("run_id"))
+		if convErr != nil || runID < 1 {
+			api.clientMessage(w, http.StatusBadRequest, "run_id must be a positive integer")
+			return
+		}
+		run, err = api.db.CollectorRuns.SelectSummary(runID)
+	case r.URL.Query().Get("date") != "":
+		date, parseErr := time.Parse("2006-01-02", r.URL.Query().Get("date"))
+		if parseErr != nil {
+			api.clientMessage(w, http.StatusBadRequest, "date must be formatted as YYYY-MM-DD")
+			return
+		}
+		run, err = api.db.CollectorRuns.SelectSummaryOnDate(date)
+	default:
+		run, err = api.db.CollectorRuns.SelectMostRecent()
+	}
 	if err != nil {
-		api.serverError(w, err)
+		if errors.Is(err, models.ErrNoRecord) {
+			api.clientMessage(w, http.StatusNotFound, "no collector run found")
+		} else {
+			api.serverError(w, err)
+		}
 		return
 	}
 	newPlayers, err := api.db.CollectorNewPlayers.Select(run.ID)
@@ -55,19 +86,20 @@ func (api *API) getDaily(w http.ResponseWriter, r *http.Request) {
 	devilDaggers := []*models.CollectorHighScore{}
 
 	for _, player := range highScores {
-		switch {
-		case player.Score >= DevilDaggerThreshold:
+		switch catalog.Current.Dagger(player.Score).Name {
+		case catalog.DevilDagger:
 			devilDaggers = append(devilDaggers, player)
-		case player.Score >= GoldDaggerThreshold:
+		case catalog.GoldDagger:
 			goldDaggers = append(goldDaggers, player)
-		case player.Score >= SilverDaggerThreshold:
+		case catalog.SilverDagger:
 			silverDaggers = append(silverDaggers, player)
-		case player.Score >= BronzeDaggerThreshold:
+		case catalog.BronzeDagger:
 			bronzeDaggers = append(bronzeDaggers, player)
 		}
 	}
 
 	daily := struct {
+		RunID int `json:"run_id"`
 		*models.CollectorRun
 		NewPlayers    []*models.CollectorNewPlayer    `json:"new_players_list"`
 		ActivePlayers []*models.CollectorActivePlayer `json:"active_players_list"`
@@ -76,6 +108,7 @@ func (api *API) getDaily(w http.ResponseWriter, r *http.Request) {
 		GoldDaggers   []*models.CollectorHighScore    `json:"gold_daggers_list"`
 		DevilDaggers  []*models.CollectorHighScore    `json:"devil_daggers_list"`
 	}{
+		run.ID,
 		run,
 		newPlayers,
 		activePlayers,
@@ -88,6 +121,100 @@ func (api *API) getDaily(w http.ResponseWriter, r *http.Request) {
 	api.writeJSON(w, daily)
 }
 
+func (api *API) getCollectorStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := api.db.CollectorStatus.Select()
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			api.clientMessage(w, http.StatusNotFound, "the collector has not run")
+		} else {
+			api.serverError(w, err)
+		}
+		return
+	}
+	api.writeJSON(w, status)
+}
+
+// getTrends returns the weekly or monthly rollups of the collector runs
+// between from and to
+func (api *API) getTrends(w http.ResponseWriter, r *http.Request) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = models.RollupWeek
+	}
+	if period != models.RollupWeek && period != models.RollupMonth {
+		api.clientMessage(w, http.StatusBadRequest, models.ErrInvalidRollupPeriod.Error())
+		return
+	}
+
+	to, err := parseTime(r.URL.Query().Get("to"), time.Now())
+	if err != nil {
+		api.clientMessage(w, http.StatusBadRequest, "to must be a date or an RFC 3339 time")
+		return
+	}
+	from, err := parseTime(r.URL.Query().Get("from"), to.Add(-defaultTrendsPeriod))
+	if err != nil {
+		api.clientMessage(w, http.StatusBadRequest, "from must be a date or an RFC 3339 time")
+		return
+	}
+	if from.After(to) {
+		api.clientMessage(w, http.StatusBadRequest, "from must be before to")
+		return
+	}
+
+	rollups, err := api.db.CollectorRuns.SelectRollups(period, from, to)
+	if err != nil {
+		api.serverError(w, err)
+		return
+	}
+
+	api.writeJSON(w, struct {
+		Period  string                    `json:"period"`
+		From    time.Time                 `json:"from"`
+		To      time.Time                 `json:"to"`
+		Rollups []*models.CollectorRollup `json:"rollups"`
+	}{
+		Period:  period,
+		From:    from,
+		To:      to,
+		Rollups: rollups,
+	})
+}
+
+// getTrendsCompare returns the rollups of two periods, a and b, so that they
+// can be compared
+func (api *API) getTrendsCompare(w http.ResponseWriter, r *http.Request) {
+	var periods [2]*models.CollectorRollup
+	for i, name := range []string{"a", "b"} {
+		from, err := parseTime(r.URL.Query().Get("from_"+name), time.Time{})
+		if err != nil || from.IsZero() {
+			api.clientMessage(w, http.StatusBadRequest, fmt.Sprintf("from_%s must be a date or an RFC 3339 time", name))
+			return
+		}
+		to, err := parseTime(r.URL.Query().Get("to_"+name), time.Time{})
+		if err != nil || to.IsZero() {
+			api.clientMessage(w, http.StatusBadRequest, fmt.Sprintf("to_%s must be a date or an RFC 3339 time", name))
+			return
+		}
+		if from.After(to) {
+			api.clientMessage(w, http.StatusBadRequest, fmt.Sprintf("from_%s must be before to_%s", name, name))
+			return
+		}
+		periods[i], err = api.db.CollectorRuns.SelectRollup(from, to)
+		if err != nil {
+			api.serverError(w, err)
+			return
+		}
+	}
+
+	api.writeJSON(w, struct {
+		A *models.CollectorRollup `json:"a"`
+		B *models.CollectorRollup `json:"b"`
+	}{
+		A: periods[0],
+		B: periods[1],
+	})
+}
+
 func (api *API) getNews(w http.ResponseWriter, r *http.Request) {
 	pageSize, err := strconv.Atoi(r.URL.Query().Get("page_size"))
 	if err != nil {
@@ -201,21 +328,127 @@ func (api *API) getReleases(w http.ResponseWriter, r *http.Request) {
 }
 
 func (api *API) serveWebsocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := websocket.Upgrade(w, r)
+	conn, err := api.websocketUpgrader.Upgrade(w, r)
 	if err != nil {
-		fmt.Fprintf(w, "%+v", err)
+		api.infoLog.Printf("websocket connection rejected for %s (origin %q): %v", r.RemoteAddr, r.Header.Get("Origin"), err)
 		return
 	}
+	defer api.websocketUpgrader.Release(r)
 
 	client := &websocket.Client{
-		Conn: conn,
-		Hub:  api.websocketHub,
+		Conn:  conn,
+		Hub:   api.websocketHub,
+		Codec: conn.Subprotocol(),
 	}
 
 	api.websocketHub.Register <- client
 	client.Read()
 }
 
+// serveEvents streams the messages broadcast to every websocket client as
+// server-sent events. The topic query parameter can be given multiple times,
+// or as a comma separated list, to limit which events are sent. Clients can
+// resume from the short history kept by the hub using the Last-Event-ID header
+// or the last_event_id query parameter. A resync event is sent when events
+// were missed, either because they are no longer in the history or because
+// the client fell behind, after which the client should refetch whatever it
+// shows. Falling behind also ends the stream, for the client to reconnect.
+func (api *API) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		api.serverError(w, errors.New("streaming not supported"))
+		return
+	}
+
+	topics := make(map[string]bool)
+	for _, topic := range r.URL.Query()["topic"] {
+		for _, t := range strings.Split(topic, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				topics[t] = true
+			}
+		}
+	}
+
+	lastEventIDString := r.Header.Get("Last-Event-ID")
+	if lastEventIDString == "" {
+		lastEventIDString = r.URL.Query().Get("last_event_id")
+	}
+	var lastEventID uint64
+	var err error
+	if lastEventIDString != "" {
+		lastEventID, err = strconv.ParseUint(lastEventIDString, 10, 64)
+		if err != nil {
+			api.clientMessage(w, http.StatusBadRequest, "last event id must be an integer")
+			return
+		}
+	}
+
+	// the server write timeout would otherwise close the stream
+	err = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	if err != nil {
+		api.serverError(w, err)
+		return
+	}
+
+	subscriber, missed, complete := api.websocketHub.Events.Subscribe(lastEventID)
+	defer api.websocketHub.Events.Unsubscribe(subscriber)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	writeEvent := func(event *websocket.Event) error {
+		if len(topics) > 0 && !topics[event.Message.Func] {
+			return nil
+		}
+		_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Message.Func, event.Message.Body)
+		return err
+	}
+	writeResync := func() error {
+		_, err := fmt.Fprint(w, "event: resync\ndata: {}\n\n")
+		return err
+	}
+
+	if !complete {
+		if err := writeResync(); err != nil {
+			return
+		}
+	}
+	for _, event := range missed {
+		if err := writeEvent(event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event, ok := <-subscriber:
+			if !ok {
+				// dropped for falling behind
+				writeResync()
+				flusher.Flush()
+				return
+			}
+			if err := writeEvent(event); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
 func (api *API) playerLive(w http.ResponseWriter, r *http.Request) {
 	players := api.websocketHub.LivePlayers()
 	api.writeJSON(w, struct {
@@ -227,6 +460,145 @@ func (api *API) playerLive(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (api *API) getPlayerSessions(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || id < 1 {
+		api.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultPlaySessionLimit
+	if r.URL.Query().Get("limit") != "" {
+		limit, err = strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil {
+			api.clientMessage(w, http.StatusBadRequest, "limit must be an integer")
+			return
+		}
+		if limit < 1 || limit > maxPlaySessionLimit {
+			api.clientMessage(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPlaySessionLimit))
+			return
+		}
+	}
+
+	sessions, err := api.db.PlaySessions.SelectRecent(id, limit)
+	if err != nil {
+		api.serverError(w, err)
+		return
+	}
+
+	api.writeJSON(w, struct {
+		PlayerID int                   `json:"player_id"`
+		Sessions []*models.PlaySession `json:"sessions"`
+	}{
+		PlayerID: id,
+		Sessions: sessions,
+	})
+}
+
+func (api *API) getPlayerHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || id < 1 {
+		api.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	to, err := parseTime(r.URL.Query().Get("to"), time.Now())
+	if err != nil {
+		api.clientMessage(w, http.StatusBadRequest, "to must be a date or an RFC 3339 time")
+		return
+	}
+	from, err := parseTime(r.URL.Query().Get("from"), to.Add(-defaultHistoryPeriod))
+	if err != nil {
+		api.clientMessage(w, http.StatusBadRequest, "from must be a date or an RFC 3339 time")
+		return
+	}
+	if from.After(to) {
+		api.clientMessage(w, http.StatusBadRequest, "from must be before to")
+		return
+	}
+
+	history, err := api.db.PlayerSnapshots.Select(id, from, to)
+	if err != nil {
+		api.serverError(w, err)
+		return
+	}
+
+	api.writeJSON(w, struct {
+		PlayerID int                               `json:"player_id"`
+		From     time.Time                         `json:"from"`
+		To       time.Time                         `json:"to"`
+		History  []*models.CollectorPlayerSnapshot `json:"history"`
+	}{
+		PlayerID: id,
+		From:     from,
+		To:       to,
+		History:  history,
+	})
+}
+
+func (api *API) getPlayerNotifications(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || id < 1 {
+		api.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	preferences, err := api.db.NotificationRules.Select(id)
+	if err != nil {
+		api.serverError(w, err)
+		return
+	}
+
+	api.writeJSON(w, preferences)
+}
+
+func (api *API) updatePlayerNotifications(w http.ResponseWriter, r *http.Request) {
+	var preferences models.NotificationPreferences
+	err := json.NewDecoder(r.Body).Decode(&preferences)
+	if err != nil {
+		api.clientMessage(w, http.StatusBadRequest, "malformed data")
+		return
+	}
+
+	if preferences.PlayerID < 1 {
+		api.clientMessage(w, http.StatusBadRequest, "player_id must be greater than 0")
+		return
+	}
+
+	// players registered on Discord can also use the notify command, which
+	// checks the registration instead of a player token
+	if !api.authorizePlayers(w, r, preferences.PlayerID) {
+		return
+	}
+
+	err = preferences.Validate()
+	if err != nil {
+		api.clientMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if preferences.Rules == nil {
+		preferences.Rules = []*models.NotificationRule{}
+	}
+
+	exists, err := api.db.Players.Exists(preferences.PlayerID)
+	if err != nil {
+		api.serverError(w, err)
+		return
+	}
+	if !exists {
+		api.clientMessage(w, http.StatusNotFound, "not a ddstats player")
+		return
+	}
+
+	err = api.db.NotificationRules.Replace(&preferences)
+	if err != nil {
+		api.serverError(w, err)
+		return
+	}
+
+	api.writeJSON(w, preferences)
+}
+
 func (api *API) submitGame(w http.ResponseWriter, r *http.Request) {
 	var game models.SubmittedGame
 	err := json.NewDecoder(r.Body).Decode(&game)
@@ -268,7 +640,7 @@ func (api *API) submitGame(w http.ResponseWriter, r *http.Request) {
 	// it's worth it to take this block of code out and solely rely on the database.
 	// it does, however ensure that each time a user submits a game, the user
 	// data is up to date!
-	player, err := api.ddAPI.UserByID(game.PlayerID)
+	player, err := api.ddAPI.UserByIDContext(r.Context(), game.PlayerID)
 	if err != nil {
 		api.serverError(w, err)
 		return
@@ -281,7 +653,7 @@ func (api *API) submitGame(w http.ResponseWriter, r *http.Request) {
 
 	// This does the same as above, but for replay players.
 	if game.ReplayPlayerID != 0 {
-		replayPlayer, err := api.ddAPI.UserByID(game.ReplayPlayerID)
+		replayPlayer, err := api.ddAPI.UserByIDContext(r.Context(), game.ReplayPlayerID)
 		if err != nil && !errors.Is(err, ddapi.ErrPlayerNotFound) {
 			api.serverError(w, err)
 			return
@@ -956,7 +1328,7 @@ func (api *API) getPlayer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	playerFromDDAPI, err := api.ddAPI.UserByID(id)
+	playerFromDDAPI, err := api.ddAPI.UserByIDContext(r.Context(), id)
 	if err != nil {
 		api.serverError(w, err)
 		return
@@ -1003,7 +1375,7 @@ func (api *API) playerUpsert(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	player, err := api.ddAPI.UserByID(id)
+	player, err := api.ddAPI.UserByIDContext(r.Context(), id)
 	if err != nil {
 		api.clientMessage(w, http.StatusNotFound, err.Error())
 		return
@@ -1031,7 +1403,7 @@ func (api *API) playerUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	player, err := api.ddAPI.UserByID(id)
+	player, err := api.ddAPI.UserByIDContext(r.Context(), id)
 	if err != nil {
 		api.clientMessage(w, http.StatusNotFound, err.Error())
 		return
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"runtime/debug"
+	"time"
 )
 
 func (api *API) serverError(w http.ResponseWriter, err error) {
@@ -83,3 +84,16 @@ func (api *API) updateAvailable(version string) (bool, error) {
 	}
 	return false, nil
 }
+
+// parseTime parses a time query parameter, which is either a date such as
+// 2020-03-04, meaning midnight UTC, or an RFC 3339 time. An empty value parses
+// as the fallback.
+func parseTime(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
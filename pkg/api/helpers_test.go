@@ -1,6 +1,9 @@
 package api
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestValidVersion(t *testing.T) {
 	tests := []struct {
@@ -53,3 +56,30 @@ func TestValidVersion(t *testing.T) {
 // 		})
 // 	}
 // }
+
+func TestParseTime(t *testing.T) {
+	fallback := time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"", fallback, false},
+		{"2020-01-02", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), false},
+		{"2020-01-02T03:04:05Z", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), false},
+		{"2020-01-02T03:04:05+02:00", time.Date(2020, 1, 2, 1, 4, 5, 0, time.UTC), false},
+		{"yesterday", time.Time{}, true},
+		{"2020-13-01", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseTime(tt.value, fallback)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v; want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(tt.want) {
+				t.Errorf("got %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,10 +1,13 @@
 package api
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/alexwilkerson/ddstats-server/pkg/websocket"
 	socketio "github.com/googollee/go-socket.io"
 )
 
@@ -39,6 +42,62 @@ func (api *API) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
+// requireAdmin only lets through requests with the admin token as a bearer
+// token. The admin endpoints are hidden if there is no admin token.
+func (api *API) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if api.AdminToken == "" {
+			api.notFound(w)
+			return
+		}
+		if !api.isAdmin(r) {
+			api.unauthorized(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorizePlayers returns true if the request has the admin token or a player
+// token signed for one of the players as its bearer token. Otherwise it
+// responds with 401 and returns false.
+func (api *API) authorizePlayers(w http.ResponseWriter, r *http.Request, playerIDs ...int) bool {
+	if api.isAdmin(r) {
+		return true
+	}
+	playerID, err := websocket.VerifyPlayerToken(api.PlayerSecret, bearerToken(r))
+	if err == nil {
+		for _, id := range playerIDs {
+			if id == playerID {
+				return true
+			}
+		}
+	}
+	api.unauthorized(w)
+	return false
+}
+
+func (api *API) isAdmin(r *http.Request) bool {
+	token := bearerToken(r)
+	return api.AdminToken != "" && token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(api.AdminToken)) == 1
+}
+
+func (api *API) unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	api.clientError(w, http.StatusUnauthorized)
+}
+
+// bearerToken returns the bearer token from the Authorization header, or an
+// empty string if there isn't one
+func bearerToken(r *http.Request) string {
+	authorization := r.Header.Get("Authorization")
+	token := strings.TrimPrefix(authorization, "Bearer ")
+	if token == authorization {
+		return ""
+	}
+	return token
+}
+
 func (api *API) handleCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/websocket"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	tests := []struct {
+		adminToken    string
+		authorization string
+		status        int
+	}{
+		{"", "", http.StatusNotFound},
+		{"", "Bearer ", http.StatusNotFound},
+		{"hunter2", "", http.StatusUnauthorized},
+		{"hunter2", "Bearer hunter", http.StatusUnauthorized},
+		{"hunter2", "Basic hunter2", http.StatusUnauthorized},
+		{"hunter2", "hunter2", http.StatusUnauthorized},
+		{"hunter2", "Bearer hunter2", http.StatusOK},
+	}
+	for _, tt := range tests {
+		api := newTestAPI(nil)
+		api.AdminToken = tt.adminToken
+		handler := api.requireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		r := httptest.NewRequest(http.MethodGet, "/api/v2/admin/anomalies", nil)
+		if tt.authorization != "" {
+			r.Header.Set("Authorization", tt.authorization)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("token %q, authorization %q: got status %d; want %d", tt.adminToken, tt.authorization, w.Code, tt.status)
+		}
+	}
+}
+
+func TestAuthorizePlayers(t *testing.T) {
+	secret := []byte("secret")
+	expires := time.Now().Add(time.Hour)
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{"admin", "Bearer hunter2", http.StatusOK},
+		{"player in the race", "Bearer " + websocket.SignPlayerToken(secret, 2, expires), http.StatusOK},
+		{"player not in the race", "Bearer " + websocket.SignPlayerToken(secret, 3, expires), http.StatusUnauthorized},
+		{"expired", "Bearer " + websocket.SignPlayerToken(secret, 2, time.Now().Add(-time.Hour)), http.StatusUnauthorized},
+		{"wrong secret", "Bearer " + websocket.SignPlayerToken([]byte("other"), 2, expires), http.StatusUnauthorized},
+		{"no token", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPI(nil)
+			api.AdminToken = "hunter2"
+			api.PlayerSecret = secret
+			r := httptest.NewRequest(http.MethodPost, "/api/v2/race/start?id=test", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			if api.authorizePlayers(w, r, 1, 2) {
+				w.WriteHeader(http.StatusOK)
+			}
+			if w.Code != tt.status {
+				t.Errorf("got status %d; want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+	"github.com/alexwilkerson/ddstats-server/pkg/websocket"
+)
+
+const (
+	maxRaceIDLength = 64
+)
+
+func (api *API) createRace(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ID        string `json:"race_id"`
+		PlayerIDs []int  `json:"player_ids"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		api.clientMessage(w, http.StatusBadRequest, "malformed data")
+		return
+	}
+
+	if body.ID == "" || len(body.ID) > maxRaceIDLength {
+		api.clientMessage(w, http.StatusBadRequest, "race_id must be between 1 and 64 characters")
+		return
+	}
+
+	if !api.authorizePlayers(w, r, body.PlayerIDs...) {
+		return
+	}
+
+	_, err = api.db.Races.Select(body.ID)
+	if err == nil {
+		api.clientMessage(w, http.StatusConflict, websocket.ErrRaceExists.Error())
+		return
+	}
+	if !errors.Is(err, models.ErrNoRecord) {
+		api.serverError(w, err)
+		return
+	}
+
+	race, err := api.websocketHub.CreateRace(body.ID, body.PlayerIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, websocket.ErrRaceExists):
+			api.clientMessage(w, http.StatusConflict, err.Error())
+		case errors.Is(err, websocket.ErrRacePlayers):
+			api.clientMessage(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, websocket.ErrRaceLimit):
+			api.clientMessage(w, http.StatusTooManyRequests, err.Error())
+		default:
+			api.serverError(w, err)
+		}
+		return
+	}
+
+	api.writeJSON(w, struct {
+		Room string `json:"room"`
+		*websocket.Race
+	}{race.Room(), race})
+}
+
+func (api *API) startRace(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		api.clientMessage(w, http.StatusBadRequest, "id is required")
+		return
+	}
+
+	race, err := api.websocketHub.LiveRace(id)
+	if err != nil {
+		api.clientMessage(w, http.StatusNotFound, err.Error())
+		return
+	}
+	var playerIDs []int
+	for _, entry := range race.Entries {
+		playerIDs = append(playerIDs, entry.PlayerID)
+	}
+	if !api.authorizePlayers(w, r, playerIDs...) {
+		return
+	}
+
+	err = api.websocketHub.StartRace(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, websocket.ErrRaceNotFound):
+			api.clientMessage(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, websocket.ErrRaceStarted):
+			api.clientMessage(w, http.StatusConflict, err.Error())
+		default:
+			api.serverError(w, err)
+		}
+		return
+	}
+
+	api.clientMessage(w, http.StatusOK, "race started")
+}
+
+// getRace returns the live standings of a race which is still running,
+// otherwise the recorded result
+func (api *API) getRace(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		api.clientMessage(w, http.StatusBadRequest, "id is required")
+		return
+	}
+
+	race, err := api.websocketHub.LiveRace(id)
+	if err == nil {
+		api.writeJSON(w, struct {
+			Live bool `json:"live"`
+			*websocket.Race
+		}{true, race})
+		return
+	}
+
+	result, err := api.db.Races.Select(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			api.clientMessage(w, http.StatusNotFound, websocket.ErrRaceNotFound.Error())
+			return
+		}
+		api.serverError(w, err)
+		return
+	}
+
+	api.writeJSON(w, struct {
+		Live bool `json:"live"`
+		*models.Race
+	}{false, result})
+}
@@ -19,6 +19,7 @@ func (api *API) Routes(socketioServer *socketio.Server) http.Handler {
 	mux.Get("/api/v2/ddapi/get_user_by_id", http.HandlerFunc(api.ddGetUserByID))
 	mux.Get("/api/v2/ddapi/get_user_by_name", http.HandlerFunc(api.ddUserSearch))
 	mux.Get("/api/v2/ddapi/get_scores", http.HandlerFunc(api.ddGetScores))
+	mux.Get("/api/v2/ddapi/neighborhood", http.HandlerFunc(api.ddNeighborhood))
 
 	// ddstats api
 	mux.Post("/api/v2/submit_game", http.HandlerFunc(api.submitGame))
@@ -39,11 +40,26 @@ func (api *API) Routes(socketioServer *socketio.Server) http.Handler {
 	mux.Get("/api/v2/player", http.HandlerFunc(api.getPlayer))
 	mux.Get("/api/v2/player/update", http.HandlerFunc(api.playerUpdate))
 	mux.Get("/api/v2/player/live", http.HandlerFunc(api.playerLive))
+	mux.Get("/api/v2/player/sessions", http.HandlerFunc(api.getPlayerSessions))
+	mux.Get("/api/v2/player/history", http.HandlerFunc(api.getPlayerHistory))
+	mux.Get("/api/v2/player/notifications", http.HandlerFunc(api.getPlayerNotifications))
+	mux.Post("/api/v2/player/notifications", http.HandlerFunc(api.updatePlayerNotifications))
 	mux.Get("/api/v2/player/all", http.HandlerFunc(api.getPlayers))
 	mux.Get("/api/v2/motd", http.HandlerFunc(api.getMOTD))
 	mux.Get("/api/v2/releases", http.HandlerFunc(api.getReleases))
 	mux.Get("/api/v2/news", http.HandlerFunc(api.getNews))
 	mux.Get("/api/v2/daily", http.HandlerFunc(api.getDaily))
+	mux.Get("/api/v2/collector/status", http.HandlerFunc(api.getCollectorStatus))
+	mux.Get("/api/v2/trends", http.HandlerFunc(api.getTrends))
+	mux.Get("/api/v2/trends/compare", http.HandlerFunc(api.getTrendsCompare))
+	mux.Get("/api/v2/events", http.HandlerFunc(api.serveEvents))
+	mux.Get("/api/v2/race", http.HandlerFunc(api.getRace))
+	mux.Post("/api/v2/race", http.HandlerFunc(api.createRace))
+	mux.Post("/api/v2/race/start", http.HandlerFunc(api.startRace))
+
+	// admin
+	mux.Get("/api/v2/admin/anomalies", api.requireAdmin(http.HandlerFunc(api.getAnomalies)))
+	mux.Post("/api/v2/admin/anomalies/review", api.requireAdmin(http.HandlerFunc(api.reviewAnomaly)))
 
 	// these are here for now to be backward compatible
 	mux.Post("/api/get_motd", http.HandlerFunc(api.clientConnect))
@@ -0,0 +1,159 @@
+// Package catalog holds the game data which is shared by the rest of the
+// server, such as the death types, enemies and dagger tiers of each version of
+// Devil Daggers.
+package catalog
+
+// Dagger tier names, from lowest to highest
+const (
+	DefaultDagger = "default"
+	BronzeDagger  = "bronze"
+	SilverDagger  = "silver"
+	GoldDagger    = "gold"
+	DevilDagger   = "devil"
+)
+
+// DaggerTier is a dagger and the game time needed to earn it
+type DaggerTier struct {
+	Name     string  `json:"name"`
+	GameTime float64 `json:"game_time"`
+}
+
+// Version is the data of a version of the game
+type Version struct {
+	Name string `json:"name"`
+	// DeathTypes are indexed by the IDs the game and the DD API use
+	DeathTypes []string `json:"death_types"`
+	// Enemies are indexed the same way as the per enemy counts the game sends
+	Enemies []string `json:"enemies"`
+	// Daggers are ordered from lowest to highest, starting with the default
+	// dagger at a game time of 0
+	Daggers []DaggerTier `json:"daggers"`
+}
+
+// V3 is the third version of the game, which the DD API reports on
+var V3 = &Version{
+	Name: "V3",
+	DeathTypes: []string{
+		"FALLEN",
+		"SWARMED",
+		"IMPALED",
+		"GORED",
+		"INFESTED",
+		"OPENED",
+		"PURGED",
+		"DESECRATED",
+		"SACRIFICED",
+		"EVISCERATED",
+		"ANNIHILATED",
+		"INTOXICATED",
+		"ENVENMONATED",
+		"INCARNATED",
+		"DISCARNATED",
+		"BARBED",
+		"HAUNTED",
+	},
+	Enemies: []string{
+		"Squid I",
+		"Squid II",
+		"Squid III",
+		"Centipede",
+		"Gigapede",
+		"Ghostpede",
+		"Spider I",
+		"Spider II",
+		"Leviathan",
+		"The Orb",
+		"Thorn",
+		"Skull I",
+		"Skull II",
+		"Skull III",
+		"Skull IV",
+		"Spiderling",
+		"Spider Egg I",
+		"Spider Egg II",
+		"Transmuted Skull I",
+		"Transmuted Skull II",
+		"Transmuted Skull III",
+		"Transmuted Skull IV",
+	},
+	Daggers: []DaggerTier{
+		{DefaultDagger, 0},
+		{BronzeDagger, 60},
+		{SilverDagger, 120},
+		{GoldDagger, 250},
+		{DevilDagger, 500},
+	},
+}
+
+// Current is the version of the game being played
+var Current = V3
+
+// Versions are all of the versions in the catalog, oldest first
+var Versions = []*Version{V3}
+
+// Lookup returns the version with the name, or nil if there isn't one
+func Lookup(name string) *Version {
+	for _, v := range Versions {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// DeathType returns the name of the death type with the ID
+func (v *Version) DeathType(id int) (string, bool) {
+	if id < 0 || id >= len(v.DeathTypes) {
+		return "", false
+	}
+	return v.DeathTypes[id], true
+}
+
+// DeathTypeID returns the ID of the death type with the name
+func (v *Version) DeathTypeID(name string) (int, bool) {
+	for i, deathType := range v.DeathTypes {
+		if deathType == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Enemy returns the name of the enemy at the index
+func (v *Version) Enemy(i int) (string, bool) {
+	if i < 0 || i >= len(v.Enemies) {
+		return "", false
+	}
+	return v.Enemies[i], true
+}
+
+// DaggerTier returns the dagger tier with the name
+func (v *Version) DaggerTier(name string) (DaggerTier, bool) {
+	for _, tier := range v.Daggers {
+		if tier.Name == name {
+			return tier, true
+		}
+	}
+	return DaggerTier{}, false
+}
+
+// Dagger returns the highest dagger tier earned with the game time
+func (v *Version) Dagger(gameTime float64) DaggerTier {
+	var dagger DaggerTier
+	for _, tier := range v.Daggers {
+		if gameTime >= tier.GameTime {
+			dagger = tier
+		}
+	}
+	return dagger
+}
+
+// DaggerCrossed returns the highest dagger tier earned by improving from one
+// game time to another, and false if no new tier was earned
+func (v *Version) DaggerCrossed(from, to float64) (DaggerTier, bool) {
+	dagger := v.Dagger(to)
+	if dagger.GameTime == 0 || from >= dagger.GameTime {
+		return DaggerTier{}, false
+	}
+	return dagger, true
+}
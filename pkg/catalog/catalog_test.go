@@ -0,0 +1,110 @@
+package catalog
+
+import "testing"
+
+func TestDeathTypes(t *testing.T) {
+	name, ok := V3.DeathType(16)
+	if !ok || name != "HAUNTED" {
+		t.Errorf("DeathType(16) = %q, %v, want HAUNTED", name, ok)
+	}
+	if _, ok := V3.DeathType(len(V3.DeathTypes)); ok {
+		t.Error("DeathType past the end is ok")
+	}
+	if _, ok := V3.DeathType(-1); ok {
+		t.Error("DeathType(-1) is ok")
+	}
+	for i, name := range V3.DeathTypes {
+		if id, ok := V3.DeathTypeID(name); !ok || id != i {
+			t.Errorf("DeathTypeID(%q) = %d, %v, want %d", name, id, ok, i)
+		}
+	}
+	if _, ok := V3.DeathTypeID("STUBBED"); ok {
+		t.Error("DeathTypeID of an unknown death type is ok")
+	}
+}
+
+func TestDagger(t *testing.T) {
+	tests := []struct {
+		gameTime float64
+		want     string
+	}{
+		{0, DefaultDagger},
+		{59.9999, DefaultDagger},
+		{60, BronzeDagger},
+		{119.9, BronzeDagger},
+		{120, SilverDagger},
+		{250, GoldDagger},
+		{499.9999, GoldDagger},
+		{500, DevilDagger},
+		{1200, DevilDagger},
+	}
+	for _, tt := range tests {
+		if got := V3.Dagger(tt.gameTime); got.Name != tt.want {
+			t.Errorf("Dagger(%v) = %q, want %q", tt.gameTime, got.Name, tt.want)
+		}
+	}
+}
+
+func TestDaggerCrossed(t *testing.T) {
+	tests := []struct {
+		from, to float64
+		want     string
+		ok       bool
+	}{
+		{0, 30, "", false},
+		{30, 60, BronzeDagger, true},
+		{30, 130, SilverDagger, true},
+		{61, 119, "", false},
+		{130, 100, "", false},
+		{400, 520, DevilDagger, true},
+		{520, 600, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := V3.DaggerCrossed(tt.from, tt.to)
+		if got.Name != tt.want || ok != tt.ok {
+			t.Errorf("DaggerCrossed(%v, %v) = %q, %v, want %q, %v", tt.from, tt.to, got.Name, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestEnemies(t *testing.T) {
+	name, ok := V3.Enemy(8)
+	if !ok || name != "Leviathan" {
+		t.Errorf("Enemy(8) = %q, %v, want Leviathan", name, ok)
+	}
+	if _, ok := V3.Enemy(len(V3.Enemies)); ok {
+		t.Error("Enemy past the end is ok")
+	}
+	if _, ok := V3.Enemy(-1); ok {
+		t.Error("Enemy(-1) is ok")
+	}
+}
+
+func TestDaggerTier(t *testing.T) {
+	tier, ok := V3.DaggerTier(GoldDagger)
+	if !ok || tier.GameTime != 250 {
+		t.Errorf("DaggerTier(%s) = %+v, %v, want 250", GoldDagger, tier, ok)
+	}
+	if _, ok := V3.DaggerTier("platinum"); ok {
+		t.Error("DaggerTier(platinum) is ok")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	if Lookup("V3") != V3 {
+		t.Error("Lookup(V3) isn't V3")
+	}
+	if Lookup("V4") != nil {
+		t.Error("Lookup(V4) isn't nil")
+	}
+	for _, v := range Versions {
+		if len(v.Daggers) == 0 || v.Daggers[0].GameTime != 0 {
+			t.Errorf("%s doesn't start with a default dagger", v.Name)
+		}
+		for i := 1; i < len(v.Daggers); i++ {
+			if v.Daggers[i].GameTime <= v.Daggers[i-1].GameTime {
+				t.Errorf("%s daggers aren't in order", v.Name)
+			}
+		}
+	}
+}
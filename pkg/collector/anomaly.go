@@ -0,0 +1,55 @@
+package collector
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+)
+
+const (
+	// inactiveAfter is how long a player has to have been inactive for a jump
+	// in their game time to be flagged
+	inactiveAfter = 180 * 24 * time.Hour
+	// inactiveJump is how much a player returning from inactivity has to
+	// improve their game time by to be flagged
+	inactiveJump = 100.0
+)
+
+// detectAnomalies returns the rules the player's score breaks, given their
+// stats as of the last run, which are nil for a new player, and the world
+// record as of the start of the run. A world record of 0 isn't checked.
+func detectAnomalies(runID int, player *ddapi.Player, previous *models.CollectorPlayer, worldRecord float64, now time.Time) []*models.CollectorAnomaly {
+	var anomalies []*models.CollectorAnomaly
+	var previousGameTime float64
+	if previous != nil {
+		previousGameTime = previous.GameTime
+	}
+	flag := func(rule, detail string) {
+		anomalies = append(anomalies, &models.CollectorAnomaly{
+			CollectorRunID:    runID,
+			CollectorPlayerID: int(player.PlayerID),
+			Rule:              rule,
+			Detail:            detail,
+			GameTime:          player.GameTime,
+			PreviousGameTime:  previousGameTime,
+		})
+	}
+	improvement := player.GameTime - previousGameTime
+	if worldRecord > 0 && player.GameTime > worldRecord && improvement > 0 {
+		flag(models.AnomalyAboveWorldRecord, fmt.Sprintf("%.4fs is above the world record of %.4fs", player.GameTime, worldRecord))
+	}
+	if previous == nil || improvement <= 0 {
+		return anomalies
+	}
+	if int(player.OverallDeaths) <= previous.OverallDeaths {
+		flag(models.AnomalyNoNewDeaths, fmt.Sprintf("improved by %.4fs without dying", improvement))
+	}
+	if previous.LastActive.Valid && improvement >= inactiveJump {
+		if inactive := now.Sub(previous.LastActive.Time); inactive >= inactiveAfter {
+			flag(models.AnomalyInactiveJump, fmt.Sprintf("improved by %.4fs after %d days of inactivity", improvement, int(inactive.Hours()/24)))
+		}
+	}
+	return anomalies
+}
@@ -0,0 +1,131 @@
+package collector
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+)
+
+func TestDetectAnomalies(t *testing.T) {
+	now := time.Date(2020, 3, 4, 0, 0, 0, 0, time.UTC)
+	active := sql.NullTime{Time: now.Add(-24 * time.Hour), Valid: true}
+	inactive := sql.NullTime{Time: now.Add(-inactiveAfter), Valid: true}
+	tests := []struct {
+		name        string
+		player      *ddapi.Player
+		previous    *models.CollectorPlayer
+		worldRecord float64
+		want        []string
+	}{
+		{
+			name:     "improved with new deaths",
+			player:   &ddapi.Player{GameTime: 400, OverallDeaths: 11},
+			previous: &models.CollectorPlayer{GameTime: 100, OverallDeaths: 10, LastActive: active},
+		},
+		{
+			name:     "improved without dying",
+			player:   &ddapi.Player{GameTime: 120, OverallDeaths: 10},
+			previous: &models.CollectorPlayer{GameTime: 100, OverallDeaths: 10, LastActive: active},
+			want:     []string{models.AnomalyNoNewDeaths},
+		},
+		{
+			name:     "not improved without dying",
+			player:   &ddapi.Player{GameTime: 100, OverallDeaths: 10},
+			previous: &models.CollectorPlayer{GameTime: 100, OverallDeaths: 10, LastActive: inactive},
+		},
+		{
+			name:     "small jump after inactivity",
+			player:   &ddapi.Player{GameTime: 150, OverallDeaths: 11},
+			previous: &models.CollectorPlayer{GameTime: 100, OverallDeaths: 10, LastActive: inactive},
+		},
+		{
+			name:     "huge jump after inactivity",
+			player:   &ddapi.Player{GameTime: 200, OverallDeaths: 11},
+			previous: &models.CollectorPlayer{GameTime: 100, OverallDeaths: 10, LastActive: inactive},
+			want:     []string{models.AnomalyInactiveJump},
+		},
+		{
+			name:     "huge jump with unknown activity",
+			player:   &ddapi.Player{GameTime: 200, OverallDeaths: 11},
+			previous: &models.CollectorPlayer{GameTime: 100, OverallDeaths: 10},
+		},
+		{
+			name:        "above the world record",
+			player:      &ddapi.Player{GameTime: 1200, OverallDeaths: 11},
+			previous:    &models.CollectorPlayer{GameTime: 1000, OverallDeaths: 10, LastActive: active},
+			worldRecord: 1100,
+			want:        []string{models.AnomalyAboveWorldRecord},
+		},
+		{
+			name:        "world record holder not improved",
+			player:      &ddapi.Player{GameTime: 1100, OverallDeaths: 11},
+			previous:    &models.CollectorPlayer{GameTime: 1100, OverallDeaths: 10, LastActive: active},
+			worldRecord: 1100,
+		},
+		{
+			name:        "new player above the world record",
+			player:      &ddapi.Player{GameTime: 1200, OverallDeaths: 1},
+			worldRecord: 1100,
+			want:        []string{models.AnomalyAboveWorldRecord},
+		},
+		{
+			name:   "new player without a world record",
+			player: &ddapi.Player{GameTime: 1200, OverallDeaths: 1},
+		},
+		{
+			name:        "every rule",
+			player:      &ddapi.Player{GameTime: 1200, OverallDeaths: 10},
+			previous:    &models.CollectorPlayer{GameTime: 100, OverallDeaths: 10, LastActive: inactive},
+			worldRecord: 1100,
+			want:        []string{models.AnomalyAboveWorldRecord, models.AnomalyNoNewDeaths, models.AnomalyInactiveJump},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rules []string
+			for _, anomaly := range detectAnomalies(1, tt.player, tt.previous, tt.worldRecord, now) {
+				rules = append(rules, anomaly.Rule)
+			}
+			if !reflect.DeepEqual(rules, tt.want) {
+				t.Errorf("got %v; want %v", rules, tt.want)
+			}
+		})
+	}
+}
+
+// TestInactiveJumpAcrossRuns checks that a player who doesn't play for a
+// few runs keeps their last active time, so that a jump when they return is
+// flagged
+func TestInactiveJumpAcrossRuns(t *testing.T) {
+	lastActive := time.Date(2020, 3, 4, 0, 0, 0, 0, time.UTC)
+	player := &ddapi.Player{PlayerID: 1, Rank: 1, GameTime: 100, DeathType: "FALLEN", OverallDeaths: 10, OverallGameTime: 1000}
+	previous := map[int]*models.CollectorPlayer{1: toCollectorPlayer(player)}
+	previous[1].LastActive = sql.NullTime{Time: lastActive, Valid: true}
+	c := &Collector{}
+
+	idle := c.calculatePage(&models.CollectorRun{ID: 1, DeathTypes: map[string]int{}}, &ddapi.LeaderboardPage{Rank: 1, Leaderboard: &ddapi.Leaderboard{
+		Players: []*ddapi.Player{player},
+	}}, previous, lastActive.Add(inactiveAfter))
+	if got := idle.players[0].LastActive; !got.Valid || !got.Time.Equal(lastActive) {
+		t.Fatalf("inactive player's last active time is %v; want %v", got, lastActive)
+	}
+
+	returned := *player
+	returned.GameTime += inactiveJump
+	returned.OverallDeaths++
+	returned.OverallGameTime += returned.GameTime
+	batch := c.calculatePage(&models.CollectorRun{ID: 2, DeathTypes: map[string]int{}}, &ddapi.LeaderboardPage{Rank: 1, Leaderboard: &ddapi.Leaderboard{
+		Players: []*ddapi.Player{&returned},
+	}}, map[int]*models.CollectorPlayer{1: idle.players[0]}, lastActive.Add(inactiveAfter+24*time.Hour))
+	var rules []string
+	for _, anomaly := range batch.anomalies {
+		rules = append(rules, anomaly.Rule)
+	}
+	if want := []string{models.AnomalyInactiveJump}; !reflect.DeepEqual(rules, want) {
+		t.Errorf("got %v; want %v", rules, want)
+	}
+}
@@ -1,6 +1,8 @@
 package collector
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"log"
 	"time"
@@ -8,213 +10,416 @@ import (
 	"github.com/alexwilkerson/ddstats-server/pkg/models"
 	"github.com/jmoiron/sqlx"
 
+	"github.com/alexwilkerson/ddstats-server/pkg/catalog"
 	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
 
 	"github.com/alexwilkerson/ddstats-server/pkg/models/postgres"
 )
 
 const (
-	maxLimit int = 1000
+	// pageTimeout bounds how long a page of the leaderboard is waited for,
+	// retries included
+	pageTimeout = time.Minute
+	// DefaultConcurrency is how many pages of the leaderboard NewCollector
+	// fetches at once
+	DefaultConcurrency = 4
+	// DefaultSnapshotRetention is how long NewCollector keeps the player
+	// snapshots of every run, before keeping only those of the first run of
+	// every week
+	DefaultSnapshotRetention = 90 * 24 * time.Hour
 )
 
-const (
-	BronzeDaggerThreshold float64 = 60
-	SilverDaggerThreshold float64 = 120
-	GoldDaggerThreshold   float64 = 250
-	DevilDaggerThreshold  float64 = 500
-)
-
-const (
-	Fallen       = "FALLEN"
-	Swarmed      = "SWARMED"
-	Impaled      = "IMPALED"
-	Gored        = "GORED"
-	Infested     = "INFESTED"
-	Opened       = "OPENED"
-	Purged       = "PURGED"
-	Desecrated   = "DESECRATED"
-	Sacrificed   = "SACRIFICED"
-	Eviscerated  = "EVISCERATED"
-	Annihilated  = "ANNIHILATED"
-	Intoxicated  = "INTOXICATED"
-	Envenmonated = "ENVENMONATED"
-	Incarnated   = "INCARNATED"
-	Discarnated  = "DISCARNATED"
-	Barbed       = "BARBED"
-)
+// errStopped is returned by a run which was stopped before it finished
+var errStopped = errors.New("collector stopped")
 
 type Collector struct {
-	DDAPI                 *ddapi.API
-	DB                    *postgres.Postgres
-	infoLog               *log.Logger
-	errorLog              *log.Logger
-	totalPlayers          int
-	activePlayers         int
-	playersWithNewScores  int
-	playersWithNewRanks   int
-	playerImprovementTime float64
-	playerRankImprovement int
-	playerGameTime        float64
-	playerDeaths          int
-	playerGems            int
-	playerEnemiesKilled   int
-	playerDaggersHit      int
-	playerDaggersFired    int
-	quit                  chan struct{}
-	done                  chan struct{}
+	DDAPI *ddapi.API
+	DB    *postgres.Postgres
+	// Concurrency is how many pages of the leaderboard are fetched at once.
+	// Pages are still recorded one at a time, in order.
+	Concurrency int
+	// SnapshotRetention is how long the player snapshots of every run are
+	// kept. Older snapshots are downsampled to the first run of every week,
+	// or kept forever if it is 0.
+	SnapshotRetention time.Duration
+	infoLog           *log.Logger
+	errorLog          *log.Logger
+	// state is the progress of the run being collected
+	state models.CollectorRunState
+	quit  chan struct{}
+	done  chan struct{}
 }
 
 func NewCollector(ddAPI *ddapi.API, db *postgres.Postgres, infoLog, errorLog *log.Logger) *Collector {
 	return &Collector{
-		DDAPI:    ddAPI,
-		DB:       db,
-		infoLog:  infoLog,
-		errorLog: errorLog,
-		quit:     make(chan struct{}),
-		done:     make(chan struct{}),
+		DDAPI:             ddAPI,
+		DB:                db,
+		Concurrency:       DefaultConcurrency,
+		SnapshotRetention: DefaultSnapshotRetention,
+		infoLog:           infoLog,
+		errorLog:          errorLog,
+		quit:              make(chan struct{}),
+		done:              make(chan struct{}),
 	}
 }
 
+// Start runs the collector once, unless another collector is running, and
+// closes Done when it is finished
 func (c *Collector) Start() {
 	defer func() {
 		close(c.done)
 	}()
-	start := time.Now()
-	var leaderboard *ddapi.Leaderboard
-	var err error
-	var offset int
+	c.run(nil)
+}
+
+// collect records the leaderboard as a collector run, checkpointing the run
+// after every page so that it can be resumed if it fails or is stopped. The
+// unfinished run is resumed if there is one, and otherwise a new run is
+// started. It returns errStopped if the collector is stopped before the run is
+// finished.
+func (c *Collector) collect() error {
 	previousRun, err := c.DB.CollectorRuns.SelectLastRunID()
 	if err != nil {
-		c.errorLog.Printf("collector error: %v", err)
-		return
+		return err
 	}
-	tx, err := c.DB.DB.Beginx()
+	run, err := c.resumeOrCreateRun()
 	if err != nil {
-		c.errorLog.Printf("collector error: %v", err)
-		return
+		return err
 	}
-	runID, err := c.DB.CollectorRuns.CreateNew(tx)
-	if err != nil {
-		c.rollbackAndLogError(tx, err)
-		return
+	if c.state.NextRank > 1 {
+		c.infoLog.Printf("Resuming collector run %d from rank %d...", run.ID, c.state.NextRank)
 	}
-	run := models.CollectorRun{ID: runID}
-	for ok := true; ok; ok = leaderboard.PlayerCount > 0 {
+	it := c.DDAPI.IterateLeaderboard(context.Background(), ddapi.IteratorOptions{
+		Rank:        c.state.NextRank,
+		Concurrency: c.Concurrency,
+		PageTimeout: pageTimeout,
+		Progress: func(p ddapi.Progress) {
+			c.infoLog.Printf("collector progress: %d/%d players", p.NextRank-1, p.Total)
+		},
+	})
+	defer it.Close()
+	checkpoint := time.Now()
+	for it.Next() {
 		select {
 		case <-c.quit:
-			err = tx.Rollback()
-			if err != nil {
-				c.errorLog.Printf("collector rollback error: %v", err)
-			}
-			return
+			return errStopped
 		default:
-			leaderboard, err = c.DDAPI.GetLeaderboard(maxLimit, offset)
-			if err != nil {
-				c.rollbackAndLogError(tx, err)
-				return
-			}
-			// only run once
-			if offset == 0 {
-				initRun(&run, previousRun, leaderboard)
-			}
-			c.infoLog.Printf("collector offset: %d", offset)
-			for _, player := range leaderboard.Players {
-				select {
-				case <-c.quit:
-					c.infoLog.Println("Collector exiting prematurely. Rolling back database changes...")
-					err = tx.Rollback()
-					if err != nil {
-						c.errorLog.Printf("collector rollback error: %v", err)
-					}
-					return
-				default:
-					err := c.DB.ReplayPlayers.Upsert(int(player.PlayerID), player.PlayerName)
-					if err != nil {
-						c.rollbackAndLogError(tx, err)
-						return
-					}
-					switch player.DeathType {
-					case Fallen:
-						run.Fallen++
-					case Swarmed:
-						run.Swarmed++
-					case Impaled:
-						run.Impaled++
-					case Gored:
-						run.Gored++
-					case Infested:
-						run.Infested++
-					case Opened:
-						run.Opened++
-					case Purged:
-						run.Purged++
-					case Desecrated:
-						run.Desecrated++
-					case Sacrificed:
-						run.Sacrificed++
-					case Eviscerated:
-						run.Eviscerated++
-					case Annihilated:
-						run.Annihilated++
-					case Intoxicated:
-						run.Intoxicated++
-					case Envenmonated:
-						run.Envenmonated++
-					case Incarnated:
-						run.Incarnated++
-					case Discarnated:
-						run.Discarnated++
-					case Barbed:
-						run.Barbed++
-					}
-					previousPlayer, err := c.DB.CollectorPlayers.Select(int(player.PlayerID))
-					if err != nil && !errors.Is(err, models.ErrNoRecord) {
-						err = c.calculateNewPlayer(tx, &run, player)
-						return
-					}
-					var activePlayer bool
-					if errors.Is(err, models.ErrNoRecord) {
-						err = c.calculateNewPlayer(tx, &run, player)
-						activePlayer = true
-						if err != nil {
-							c.rollbackAndLogError(tx, err)
-							return
-						}
-					} else {
-						activePlayer, err = c.calculatePlayer(tx, &run, player, previousPlayer)
-						if err != nil {
-							c.rollbackAndLogError(tx, err)
-							return
-						}
-					}
-					if activePlayer {
-						lastActive := time.Now()
-						err = c.DB.CollectorPlayers.UpsertPlayer(tx, player, run.ID, &lastActive)
-					} else {
-						err = c.DB.CollectorPlayers.UpsertPlayer(tx, player, run.ID, nil)
-					}
-					if err != nil {
-						c.rollbackAndLogError(tx, err)
-						return
-					}
-					c.totalPlayers++
-				}
-			}
-			offset += leaderboard.PlayerCount
 		}
+		page := it.Page()
+		tx, err := c.DB.DB.Beginx()
+		if err != nil {
+			return err
+		}
+		// only run once
+		if page.Rank == 1 {
+			initRun(run, previousRun, page.Leaderboard)
+		}
+		err = c.collectPage(tx, run, page)
+		if err != nil {
+			return c.rollback(tx, err)
+		}
+		c.state.NextRank = it.NextRank()
+		c.state.RunTime += models.Duration(time.Since(checkpoint))
+		checkpoint = time.Now()
+		err = c.DB.CollectorRuns.Update(tx, run)
+		if err != nil {
+			return c.rollback(tx, err)
+		}
+		err = c.DB.CollectorRunStates.Upsert(tx, &c.state)
+		if err != nil {
+			return c.rollback(tx, err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+	if it.Err() != nil {
+		return it.Err()
 	}
-	c.compileRunStats(&run, previousRun)
-	run.RunTime = models.Duration(time.Since(start))
-	err = c.DB.CollectorRuns.Update(tx, &run)
+	return c.finishRun(run, previousRun)
+}
+
+// resumeOrCreateRun loads the unfinished run and its state, or creates a new
+// run if every run has finished
+func (c *Collector) resumeOrCreateRun() (*models.CollectorRun, error) {
+	state, err := c.DB.CollectorRunStates.SelectUnfinished()
+	if err == nil {
+		run, err := c.DB.CollectorRuns.Select(state.CollectorRunID)
+		if err != nil {
+			return nil, err
+		}
+		c.state = *state
+		return run, nil
+	}
+	if !errors.Is(err, models.ErrNoRecord) {
+		return nil, err
+	}
+
+	tx, err := c.DB.DB.Beginx()
 	if err != nil {
-		c.rollbackAndLogError(tx, err)
-		return
+		return nil, err
+	}
+	// the world record is taken before the run updates any players
+	worldRecord, err := c.DB.CollectorPlayers.SelectWorldRecord(tx)
+	if err != nil {
+		return nil, c.rollback(tx, err)
+	}
+	run, err := c.DB.CollectorRuns.CreateNew(tx)
+	if err != nil {
+		return nil, c.rollback(tx, err)
+	}
+	err = c.DB.PlayerSnapshots.CreatePartition(tx, run.TimeStamp)
+	if err != nil {
+		return nil, c.rollback(tx, err)
+	}
+	c.state = models.CollectorRunState{CollectorRunID: run.ID, NextRank: 1, WorldRecord: worldRecord}
+	err = c.DB.CollectorRunStates.Upsert(tx, &c.state)
+	if err != nil {
+		return nil, c.rollback(tx, err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	run.DeathTypes = map[string]int{}
+	return run, nil
+}
+
+// pageBatch is what a page of the leaderboard writes to the database
+type pageBatch struct {
+	replayPlayers []*models.ReplayPlayer
+	players       []*models.CollectorPlayer
+	newPlayers    []*models.CollectorNewPlayer
+	activePlayers []*models.CollectorActivePlayer
+	highScores    []*models.CollectorHighScore
+	snapshots     []*models.CollectorPlayerSnapshot
+	anomalies     []*models.CollectorAnomaly
+}
+
+// collectPage records the players on the page, fetching the players' previous
+// stats in one query and writing the page in batches
+func (c *Collector) collectPage(tx *sqlx.Tx, run *models.CollectorRun, page *ddapi.LeaderboardPage) error {
+	playerIDs := make([]int, 0, len(page.Players))
+	for _, player := range page.Players {
+		playerIDs = append(playerIDs, int(player.PlayerID))
+	}
+	previousPlayers, err := c.DB.CollectorPlayers.SelectMany(tx, playerIDs)
+	if err != nil {
+		return err
+	}
+	batch := c.calculatePage(run, page, previousPlayers, time.Now())
+	err = c.DB.ReplayPlayers.UpsertMany(tx, batch.replayPlayers)
+	if err != nil {
+		return err
+	}
+	// the other tables reference the players, so they are written first
+	err = c.DB.CollectorPlayers.UpsertMany(tx, batch.players)
+	if err != nil {
+		return err
+	}
+	err = c.DB.CollectorNewPlayers.InsertMany(tx, batch.newPlayers)
+	if err != nil {
+		return err
+	}
+	err = c.DB.CollectorActivePlayers.InsertMany(tx, batch.activePlayers)
+	if err != nil {
+		return err
+	}
+	err = c.DB.CollectorHighScores.InsertMany(tx, batch.highScores)
+	if err != nil {
+		return err
+	}
+	err = c.DB.PlayerSnapshots.InsertMany(tx, batch.snapshots)
+	if err != nil {
+		return err
+	}
+	return c.DB.CollectorAnomalies.InsertMany(tx, batch.anomalies)
+}
+
+// calculatePage adds the players on the page to the run and its state, and
+// returns what the page writes to the database. previousPlayers are the
+// players' stats as of the last run, by ID. A player who is on the page more
+// than once is only counted the first time.
+func (c *Collector) calculatePage(run *models.CollectorRun, page *ddapi.LeaderboardPage, previousPlayers map[int]*models.CollectorPlayer, now time.Time) *pageBatch {
+	batch := &pageBatch{}
+	seen := make(map[int]bool, len(page.Players))
+	for _, player := range page.Players {
+		playerID := int(player.PlayerID)
+		if seen[playerID] {
+			continue
+		}
+		seen[playerID] = true
+		batch.replayPlayers = append(batch.replayPlayers, &models.ReplayPlayer{ID: playerID, PlayerName: player.PlayerName})
+		run.DeathTypes[player.DeathType]++
+		previousPlayer, ok := previousPlayers[playerID]
+		batch.anomalies = append(batch.anomalies, detectAnomalies(run.ID, player, previousPlayer, c.state.WorldRecord, now)...)
+		var activePlayer bool
+		if ok {
+			activePlayer = c.calculatePlayer(batch, run, player, previousPlayer)
+		} else {
+			c.calculateNewPlayer(batch, run, player)
+			activePlayer = true
+		}
+		collectorPlayer := toCollectorPlayer(player)
+		switch {
+		case activePlayer:
+			collectorPlayer.LastActive = sql.NullTime{Time: now, Valid: true}
+		case ok:
+			// the player hasn't played since they were last active, which the
+			// inactive_jump rule is checked against
+			collectorPlayer.LastActive = previousPlayer.LastActive
+		}
+		batch.players = append(batch.players, collectorPlayer)
+		batch.snapshots = append(batch.snapshots, &models.CollectorPlayerSnapshot{
+			CollectorRunID:    run.ID,
+			TimeStamp:         run.TimeStamp,
+			CollectorPlayerID: playerID,
+			Rank:              collectorPlayer.Rank,
+			GameTime:          collectorPlayer.GameTime,
+			OverallDeaths:     collectorPlayer.OverallDeaths,
+			OverallGameTime:   collectorPlayer.OverallGameTime,
+		})
+		c.state.TotalPlayers++
+	}
+	return batch
+}
+
+func toCollectorPlayer(p *ddapi.Player) *models.CollectorPlayer {
+	return &models.CollectorPlayer{
+		ID:                   int(p.PlayerID),
+		PlayerName:           p.PlayerName,
+		Rank:                 int(p.Rank),
+		GameTime:             p.GameTime,
+		DeathType:            p.DeathType,
+		Gems:                 int(p.Gems),
+		DaggersHit:           int(p.DaggersHit),
+		DaggersFired:         int(p.DaggersFired),
+		EnemiesKilled:        int(p.EnemiesKilled),
+		OverallGameTime:      p.OverallGameTime,
+		OverallDeaths:        int(p.OverallDeaths),
+		OverallGems:          int(p.OverallGems),
+		OverallEnemiesKilled: int(p.OverallEnemiesKilled),
+		OverallDaggersHit:    int(p.OverallDaggersHit),
+		OverallDaggersFired:  int(p.OverallDaggersFired),
+	}
+}
+
+// finishRun finalizes the run's summary, which marks it as finished, and
+// removes its state
+func (c *Collector) finishRun(run, previousRun *models.CollectorRun) error {
+	tx, err := c.DB.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	c.compileRunStats(run, previousRun)
+	run.RunTime = c.state.RunTime
+	// a run is only finished once its run time is set, so it can't be 0
+	if run.RunTime == 0 {
+		run.RunTime = 1
+	}
+	err = c.DB.CollectorRuns.Update(tx, run)
+	if err != nil {
+		return c.rollback(tx, err)
+	}
+	err = c.DB.CollectorRunStates.Delete(tx, run.ID)
+	if err != nil {
+		return c.rollback(tx, err)
 	}
 	err = tx.Commit()
 	if err != nil {
-		c.errorLog.Printf("collector commit error: %v", err)
+		return err
 	}
-	c.infoLog.Printf("%d Players recorded to database...", c.totalPlayers)
+	c.infoLog.Printf("%d Players recorded to database...", c.state.TotalPlayers)
+	c.pruneSnapshots()
+	return nil
+}
+
+// pruneSnapshots downsamples the player snapshots older than
+// SnapshotRetention. Failing to is logged rather than failing the run.
+func (c *Collector) pruneSnapshots() {
+	if c.SnapshotRetention <= 0 {
+		return
+	}
+	dropped, err := c.DB.PlayerSnapshots.Prune(time.Now().Add(-c.SnapshotRetention))
+	if err != nil {
+		c.errorLog.Printf("collector snapshot pruning error: %v", err)
+	}
+	if dropped > 0 {
+		c.infoLog.Printf("Dropped the player snapshots of %d old runs...", dropped)
+	}
+}
+
+// DryRun calculates a run of the leaderboard the way collect does and returns
+// it, without writing anything. The previous run and the players' previous
+// stats are still read from the database.
+func (c *Collector) DryRun() (*models.CollectorRun, error) {
+	previousRun, err := c.DB.CollectorRuns.SelectLastRunID()
+	if err != nil {
+		return nil, err
+	}
+	// the transaction is only read from, and rolled back
+	tx, err := c.DB.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	worldRecord, err := c.DB.CollectorPlayers.SelectWorldRecord(tx)
+	if err != nil {
+		return nil, err
+	}
+	c.state = models.CollectorRunState{NextRank: 1, WorldRecord: worldRecord}
+	run := &models.CollectorRun{DeathTypes: map[string]int{}}
+	previousPlayers := func(playerIDs []int) (map[int]*models.CollectorPlayer, error) {
+		return c.DB.CollectorPlayers.SelectMany(tx, playerIDs)
+	}
+	err = c.calculateRun(run, previousRun, previousPlayers, time.Now(), nil)
+	if err != nil {
+		return nil, err
+	}
+	c.infoLog.Printf("%d Players calculated, nothing was written to the database...", c.state.TotalPlayers)
+	return run, nil
+}
+
+// calculateRun calculates the whole leaderboard into the run without writing
+// it. previousPlayers looks up the players' stats as of the previous run, and
+// page, if it isn't nil, is called with what each page would write.
+func (c *Collector) calculateRun(run, previousRun *models.CollectorRun, previousPlayers func(playerIDs []int) (map[int]*models.CollectorPlayer, error), now time.Time, page func(*pageBatch)) error {
+	it := c.DDAPI.IterateLeaderboard(context.Background(), ddapi.IteratorOptions{
+		Rank:        c.state.NextRank,
+		Concurrency: c.Concurrency,
+		PageTimeout: pageTimeout,
+	})
+	defer it.Close()
+	for it.Next() {
+		select {
+		case <-c.quit:
+			return errStopped
+		default:
+		}
+		leaderboardPage := it.Page()
+		if leaderboardPage.Rank == 1 {
+			initRun(run, previousRun, leaderboardPage.Leaderboard)
+		}
+		playerIDs := make([]int, 0, len(leaderboardPage.Players))
+		for _, player := range leaderboardPage.Players {
+			playerIDs = append(playerIDs, int(player.PlayerID))
+		}
+		previous, err := previousPlayers(playerIDs)
+		if err != nil {
+			return err
+		}
+		batch := c.calculatePage(run, leaderboardPage, previous, now)
+		if page != nil {
+			page(batch)
+		}
+		c.state.NextRank = it.NextRank()
+	}
+	if it.Err() != nil {
+		return it.Err()
+	}
+	c.compileRunStats(run, previousRun)
+	return nil
 }
 
 func (c *Collector) Stop() {
@@ -226,12 +431,14 @@ func (c *Collector) Done() chan struct{} {
 	return c.done
 }
 
-func (c *Collector) rollbackAndLogError(tx *sqlx.Tx, err error) {
-	c.errorLog.Printf("collector error: %v", err)
-	err = tx.Rollback()
-	if err != nil {
-		c.errorLog.Printf("collector rollback error: %v", err)
+// rollback rolls back the run's transaction and returns the error which
+// caused it
+func (c *Collector) rollback(tx *sqlx.Tx, err error) error {
+	rollbackErr := tx.Rollback()
+	if rollbackErr != nil {
+		c.errorLog.Printf("collector rollback error: %v", rollbackErr)
 	}
+	return err
 }
 
 func initRun(run *models.CollectorRun, previousRun *models.CollectorRun, leaderboard *ddapi.Leaderboard) {
@@ -256,151 +463,147 @@ func initRun(run *models.CollectorRun, previousRun *models.CollectorRun, leaderb
 
 func (c *Collector) compileRunStats(run *models.CollectorRun, previousRun *models.CollectorRun) {
 	run.NewPlayers = run.GlobalPlayers - previousRun.GlobalPlayers
-	run.ActivePlayers = c.activePlayers
+	run.ActivePlayers = c.state.ActivePlayers
 	run.InactivePlayers = run.GlobalPlayers - run.ActivePlayers
-	run.PlayersWithNewScores = c.playersWithNewScores
-	run.PlayersWithNewRanks = c.playersWithNewRanks
-	if c.playersWithNewScores != 0 {
-		run.AverageImprovementTime = c.playerImprovementTime / float64(c.playersWithNewScores)
+	run.PlayersWithNewScores = c.state.PlayersWithNewScores
+	run.PlayersWithNewRanks = c.state.PlayersWithNewRanks
+	if c.state.PlayersWithNewScores != 0 {
+		run.AverageImprovementTime = c.state.PlayerImprovementTime / float64(c.state.PlayersWithNewScores)
 	}
-	if c.playersWithNewRanks != 0 {
-		run.AverageRankImprovement = float64(c.playerRankImprovement) / float64(c.playersWithNewRanks)
+	if c.state.PlayersWithNewRanks != 0 {
+		run.AverageRankImprovement = float64(c.state.PlayerRankImprovement) / float64(c.state.PlayersWithNewRanks)
 	}
-	run.AverageGameTimePerActivePlayer = c.playerGameTime / float64(c.playerDeaths)
-	activePlayers := float64(c.activePlayers)
+	run.AverageGameTimePerActivePlayer = c.state.PlayerGameTime / float64(c.state.PlayerDeaths)
+	activePlayers := float64(c.state.ActivePlayers)
 	if activePlayers != 0 {
-		run.AverageDeathsPerActivePlayer = float64(c.playerDeaths) / activePlayers
-		run.AverageGemsPerActivePlayer = float64(c.playerGems) / activePlayers
-		run.AverageEnemiesKilledPerActivePlayer = float64(c.playerEnemiesKilled) / activePlayers
-		run.AverageDaggersHitPerActivePlayer = float64(c.playerDaggersHit) / activePlayers
-		run.AverageDaggersFiredPerActivePlayer = float64(c.playerDaggersFired) / activePlayers
+		run.AverageDeathsPerActivePlayer = float64(c.state.PlayerDeaths) / activePlayers
+		run.AverageGemsPerActivePlayer = float64(c.state.PlayerGems) / activePlayers
+		run.AverageEnemiesKilledPerActivePlayer = float64(c.state.PlayerEnemiesKilled) / activePlayers
+		run.AverageDaggersHitPerActivePlayer = float64(c.state.PlayerDaggersHit) / activePlayers
+		run.AverageDaggersFiredPerActivePlayer = float64(c.state.PlayerDaggersFired) / activePlayers
 		if run.AverageDaggersFiredPerActivePlayer != 0 {
 			run.AverageAccuracyPerActivePlayer = run.AverageDaggersHitPerActivePlayer / run.AverageDaggersFiredPerActivePlayer * 100
 		}
 	}
 }
 
-func (c *Collector) calculatePlayer(tx *sqlx.Tx, run *models.CollectorRun, fromDDAPI *ddapi.Player, fromDB *models.CollectorPlayer) (bool, error) {
+func (c *Collector) calculatePlayer(batch *pageBatch, run *models.CollectorRun, fromDDAPI *ddapi.Player, fromDB *models.CollectorPlayer) bool {
 	newDagger := calculateDaggers(run, fromDDAPI, fromDB)
 	sinceDeaths := int(fromDDAPI.OverallDeaths) - fromDB.OverallDeaths
 	sinceGameTime := float64(fromDDAPI.OverallGameTime) - fromDB.OverallGameTime
 	if sinceDeaths < 1 || sinceGameTime == 0 {
-		return false, nil
+		return false
 	}
 	rankImprovement := fromDB.Rank - int(fromDDAPI.Rank)
 	if rankImprovement > 0 {
-		c.playersWithNewRanks++
-		c.playerRankImprovement += rankImprovement
+		c.state.PlayersWithNewRanks++
+		c.state.PlayerRankImprovement += rankImprovement
 	} else {
 		rankImprovement = 0
 	}
-	c.activePlayers++
-	c.playerDeaths += sinceDeaths
+	c.state.ActivePlayers++
+	c.state.PlayerDeaths += sinceDeaths
 	gameTimeImprovement := float64(fromDDAPI.GameTime) - fromDB.GameTime
 	if gameTimeImprovement > 0 {
-		c.playersWithNewScores++
-		c.playerImprovementTime += gameTimeImprovement
+		c.state.PlayersWithNewScores++
+		c.state.PlayerImprovementTime += gameTimeImprovement
 		if newDagger {
-			c.DB.CollectorHighScores.Insert(tx, run.ID, int(fromDDAPI.PlayerID), float64(fromDDAPI.GameTime))
+			batch.highScores = append(batch.highScores, &models.CollectorHighScore{
+				CollectorRunID:    run.ID,
+				CollectorPlayerID: int(fromDDAPI.PlayerID),
+				Score:             float64(fromDDAPI.GameTime),
+			})
 		}
 	}
-	err := c.DB.CollectorActivePlayers.Insert(tx, run.ID, int(fromDDAPI.PlayerID), int(fromDDAPI.Rank), rankImprovement, float64(fromDDAPI.GameTime), gameTimeImprovement, sinceGameTime, sinceDeaths)
-	if err != nil {
-		return false, err
-	}
-	c.playerGameTime += sinceGameTime
-	c.playerDeaths += int(fromDDAPI.OverallDeaths) - fromDB.OverallDeaths
-	c.playerGems += int(fromDDAPI.OverallGems) - fromDB.OverallGems
-	c.playerEnemiesKilled += int(fromDDAPI.OverallEnemiesKilled) - fromDB.OverallEnemiesKilled
-	c.playerDaggersHit += int(fromDDAPI.OverallDaggersHit) - fromDB.OverallDaggersHit
-	c.playerDaggersFired += int(fromDDAPI.OverallDaggersFired) - fromDB.OverallDaggersFired
-	return true, nil
+	batch.activePlayers = append(batch.activePlayers, &models.CollectorActivePlayer{
+		CollectorRunID:      run.ID,
+		CollectorPlayerID:   int(fromDDAPI.PlayerID),
+		Rank:                int(fromDDAPI.Rank),
+		RankImprovement:     rankImprovement,
+		GameTime:            float64(fromDDAPI.GameTime),
+		GameTimeImprovement: gameTimeImprovement,
+		SinceGameTime:       sinceGameTime,
+		SinceDeaths:         float64(sinceDeaths),
+	})
+	c.state.PlayerGameTime += sinceGameTime
+	c.state.PlayerDeaths += int(fromDDAPI.OverallDeaths) - fromDB.OverallDeaths
+	c.state.PlayerGems += int(fromDDAPI.OverallGems) - fromDB.OverallGems
+	c.state.PlayerEnemiesKilled += int(fromDDAPI.OverallEnemiesKilled) - fromDB.OverallEnemiesKilled
+	c.state.PlayerDaggersHit += int(fromDDAPI.OverallDaggersHit) - fromDB.OverallDaggersHit
+	c.state.PlayerDaggersFired += int(fromDDAPI.OverallDaggersFired) - fromDB.OverallDaggersFired
+	return true
 }
 
-func (c *Collector) calculateNewPlayer(tx *sqlx.Tx, run *models.CollectorRun, p *ddapi.Player) error {
+func (c *Collector) calculateNewPlayer(batch *pageBatch, run *models.CollectorRun, p *ddapi.Player) {
 	calculateDaggers(run, p, nil)
-	err := c.DB.CollectorPlayers.NewPlayer(tx, int(p.PlayerID))
-	if err != nil {
-		return err
-	}
-	err = c.DB.CollectorNewPlayers.Insert(tx, run.ID, int(p.PlayerID), int(p.Rank), float64(p.GameTime))
-	if err != nil {
-		return err
-	}
+	batch.newPlayers = append(batch.newPlayers, &models.CollectorNewPlayer{
+		CollectorRunID:    run.ID,
+		CollectorPlayerID: int(p.PlayerID),
+		Rank:              int(p.Rank),
+		GameTime:          float64(p.GameTime),
+	})
 	overallDeaths := int(p.OverallDeaths)
 	if overallDeaths < 1 {
-		return nil
+		return
 	}
-	err = c.DB.CollectorActivePlayers.Insert(tx, run.ID, int(p.PlayerID), int(p.Rank), 0, float64(p.GameTime), 0, float64(p.OverallGameTime), overallDeaths)
-	if err != nil {
-		return err
+	batch.activePlayers = append(batch.activePlayers, &models.CollectorActivePlayer{
+		CollectorRunID:    run.ID,
+		CollectorPlayerID: int(p.PlayerID),
+		Rank:              int(p.Rank),
+		GameTime:          float64(p.GameTime),
+		SinceGameTime:     float64(p.OverallGameTime),
+		SinceDeaths:       float64(overallDeaths),
+	})
+	if catalog.Current.Dagger(p.GameTime).Name != catalog.DefaultDagger {
+		batch.highScores = append(batch.highScores, &models.CollectorHighScore{
+			CollectorRunID:    run.ID,
+			CollectorPlayerID: int(p.PlayerID),
+			Score:             float64(p.GameTime),
+		})
 	}
-	if p.GameTime >= BronzeDaggerThreshold {
-		err = c.DB.CollectorHighScores.Insert(tx, run.ID, int(p.PlayerID), float64(p.GameTime))
-		if err != nil {
-			return err
-		}
-	}
-	c.playerDeaths += overallDeaths
-	c.activePlayers++
+	c.state.PlayerDeaths += overallDeaths
+	c.state.ActivePlayers++
 	gameTime := float64(p.GameTime)
 	if gameTime > 0 {
-		c.playersWithNewScores++
-		c.playerImprovementTime += gameTime
-	}
-	c.playerGameTime += float64(p.OverallGameTime)
-	c.playerGems += int(p.OverallGems)
-	c.playerEnemiesKilled += int(p.OverallEnemiesKilled)
-	c.playerDaggersHit += int(p.OverallDaggersHit)
-	c.playerDaggersFired += int(p.OverallDaggersFired)
-	return nil
+		c.state.PlayersWithNewScores++
+		c.state.PlayerImprovementTime += gameTime
+	}
+	c.state.PlayerGameTime += float64(p.OverallGameTime)
+	c.state.PlayerGems += int(p.OverallGems)
+	c.state.PlayerEnemiesKilled += int(p.OverallEnemiesKilled)
+	c.state.PlayerDaggersHit += int(p.OverallDaggersHit)
+	c.state.PlayerDaggersFired += int(p.OverallDaggersFired)
 }
 
 func calculateDaggers(run *models.CollectorRun, fromDDAPI *ddapi.Player, fromDB *models.CollectorPlayer) bool {
 	gameTimeFromDDAPI := float64(fromDDAPI.GameTime)
-	switch {
-	case gameTimeFromDDAPI >= DevilDaggerThreshold:
+	switch catalog.Current.Dagger(gameTimeFromDDAPI).Name {
+	case catalog.DevilDagger:
 		run.GlobalDevilDaggers++
-	case gameTimeFromDDAPI >= GoldDaggerThreshold:
+	case catalog.GoldDagger:
 		run.GlobalGoldDaggers++
-	case gameTimeFromDDAPI >= SilverDaggerThreshold:
+	case catalog.SilverDagger:
 		run.GlobalSilverDaggers++
-	case gameTimeFromDDAPI >= BronzeDaggerThreshold:
+	case catalog.BronzeDagger:
 		run.GlobalBronzeDaggers++
 	default:
 		run.GlobalDefaultDaggers++
 	}
-	var newDagger bool
+	// if it's a new player, fromDB will be nil
+	var gameTimeFromDB float64
 	if fromDB != nil {
-		switch {
-		case fromDB.GameTime < DevilDaggerThreshold && gameTimeFromDDAPI >= DevilDaggerThreshold:
-			run.SinceDevilDaggers++
-			newDagger = true
-		case fromDB.GameTime < GoldDaggerThreshold && gameTimeFromDDAPI >= GoldDaggerThreshold:
-			run.SinceGoldDaggers++
-			newDagger = true
-		case fromDB.GameTime < SilverDaggerThreshold && gameTimeFromDDAPI >= SilverDaggerThreshold:
-			run.SinceSilverDaggers++
-			newDagger = true
-		case fromDB.GameTime < BronzeDaggerThreshold && gameTimeFromDDAPI >= BronzeDaggerThreshold:
-			run.SinceBronzeDaggers++
-			newDagger = true
-		}
-	} else { // if it's a new player, fromDB will be nil
-		switch {
-		case gameTimeFromDDAPI >= DevilDaggerThreshold:
-			run.SinceDevilDaggers++
-			newDagger = true
-		case gameTimeFromDDAPI >= GoldDaggerThreshold:
-			run.SinceGoldDaggers++
-			newDagger = true
-		case gameTimeFromDDAPI >= SilverDaggerThreshold:
-			run.SinceSilverDaggers++
-			newDagger = true
-		case gameTimeFromDDAPI >= BronzeDaggerThreshold:
-			run.SinceBronzeDaggers++
-			newDagger = true
-		}
+		gameTimeFromDB = fromDB.GameTime
+	}
+	dagger, newDagger := catalog.Current.DaggerCrossed(gameTimeFromDB, gameTimeFromDDAPI)
+	switch dagger.Name {
+	case catalog.DevilDagger:
+		run.SinceDevilDaggers++
+	case catalog.GoldDagger:
+		run.SinceGoldDaggers++
+	case catalog.SilverDagger:
+		run.SinceSilverDaggers++
+	case catalog.BronzeDagger:
+		run.SinceBronzeDaggers++
 	}
 	return newDagger
 }
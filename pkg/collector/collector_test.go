@@ -0,0 +1,150 @@
+package collector
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/catalog"
+	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
+	"github.com/alexwilkerson/ddstats-server/pkg/ddapi/ddapitest"
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+)
+
+// testLeaderboard returns n players ranked by game time, and their stats as
+// of a previous run. Every other player is new, and some of the others
+// haven't played since.
+func testLeaderboard(n int) ([]*ddapi.Player, map[int]*models.CollectorPlayer) {
+	r := rand.New(rand.NewSource(int64(n)))
+	players := make([]*ddapi.Player, n)
+	previous := make(map[int]*models.CollectorPlayer)
+	for i := range players {
+		deaths := uint64(r.Intn(1000) + 1)
+		p := &ddapi.Player{
+			PlayerID:             uint64(i + 1),
+			PlayerName:           fmt.Sprintf("player %d", i+1),
+			Rank:                 uint32(i + 1),
+			GameTime:             float64(n-i) * 1000 / float64(n),
+			DeathType:            catalog.Current.DeathTypes[r.Intn(len(catalog.Current.DeathTypes))],
+			Gems:                 uint32(r.Intn(500)),
+			DaggersHit:           uint32(r.Intn(1000)),
+			DaggersFired:         uint32(r.Intn(1000) + 1000),
+			EnemiesKilled:        uint32(r.Intn(1000)),
+			OverallDeaths:        deaths,
+			OverallGameTime:      float64(deaths) * 50,
+			OverallGems:          deaths * 20,
+			OverallEnemiesKilled: deaths * 30,
+			OverallDaggersHit:    deaths * 400,
+			OverallDaggersFired:  deaths * 1000,
+		}
+		players[i] = p
+		if i%2 == 1 {
+			continue
+		}
+		prev := toCollectorPlayer(p)
+		if i%3 != 0 {
+			played := r.Intn(int(deaths))
+			prev.Rank += r.Intn(100)
+			prev.GameTime = p.GameTime * r.Float64()
+			prev.OverallDeaths -= played
+			prev.OverallGameTime -= float64(played) * 50
+			prev.OverallGems -= played * 20
+			prev.OverallEnemiesKilled -= played * 30
+			prev.OverallDaggersHit -= played * 400
+			prev.OverallDaggersFired -= played * 1000
+		}
+		previous[prev.ID] = prev
+	}
+	return players, previous
+}
+
+// previousPlayersFrom looks up the players' previous stats in previous
+// rather than the database
+func previousPlayersFrom(previous map[int]*models.CollectorPlayer) func([]int) (map[int]*models.CollectorPlayer, error) {
+	return func(playerIDs []int) (map[int]*models.CollectorPlayer, error) {
+		players := make(map[int]*models.CollectorPlayer)
+		for _, id := range playerIDs {
+			if p, ok := previous[id]; ok {
+				players[id] = p
+			}
+		}
+		return players, nil
+	}
+}
+
+// crawl calculates the whole leaderboard the way collect does, without a
+// database
+func crawl(tb testing.TB, api *ddapi.API, concurrency int, previous map[int]*models.CollectorPlayer) (*Collector, *models.CollectorRun, []*pageBatch) {
+	now := time.Date(2020, 3, 4, 0, 0, 0, 0, time.UTC)
+	c := &Collector{DDAPI: api, Concurrency: concurrency}
+	run := &models.CollectorRun{ID: 1, DeathTypes: map[string]int{}}
+	var batches []*pageBatch
+	err := c.calculateRun(run, &models.CollectorRun{}, previousPlayersFrom(previous), now, func(batch *pageBatch) {
+		batches = append(batches, batch)
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return c, run, batches
+}
+
+func TestCrawlIsDeterministic(t *testing.T) {
+	players, previous := testLeaderboard(1000)
+	srv := ddapitest.NewServer(players...)
+	defer srv.Close()
+	srv.SetLatency(time.Millisecond)
+
+	serial, serialRun, serialBatches := crawl(t, srv.API(), 1, previous)
+	if serial.state.TotalPlayers != len(players) {
+		t.Fatalf("got %d players; want %d", serial.state.TotalPlayers, len(players))
+	}
+	var newPlayers int
+	for _, batch := range serialBatches {
+		newPlayers += len(batch.newPlayers)
+	}
+	if want := len(players) - len(previous); newPlayers != want {
+		t.Errorf("got %d new players; want %d", newPlayers, want)
+	}
+
+	for _, concurrency := range []int{2, 8} {
+		c, run, batches := crawl(t, srv.API(), concurrency, previous)
+		if c.state != serial.state {
+			t.Errorf("concurrency %d: state %+v; want %+v", concurrency, c.state, serial.state)
+		}
+		if !reflect.DeepEqual(run, serialRun) {
+			t.Errorf("concurrency %d: run %+v; want %+v", concurrency, run, serialRun)
+		}
+		if !reflect.DeepEqual(batches, serialBatches) {
+			t.Errorf("concurrency %d: batches differ from the serial crawl", concurrency)
+		}
+	}
+}
+
+func TestCalculatePageSkipsDuplicates(t *testing.T) {
+	players, _ := testLeaderboard(3)
+	page := &ddapi.LeaderboardPage{Rank: 1, Leaderboard: &ddapi.Leaderboard{
+		Players: []*ddapi.Player{players[0], players[1], players[0], players[2]},
+	}}
+	c := &Collector{}
+	run := &models.CollectorRun{DeathTypes: map[string]int{}}
+	batch := c.calculatePage(run, page, nil, time.Now())
+	if len(batch.players) != 3 || len(batch.replayPlayers) != 3 || c.state.TotalPlayers != 3 {
+		t.Errorf("got %d players, %d replay players and a total of %d; want 3", len(batch.players), len(batch.replayPlayers), c.state.TotalPlayers)
+	}
+}
+
+func BenchmarkCrawl(b *testing.B) {
+	players, previous := testLeaderboard(5000)
+	srv := ddapitest.NewServer(players...)
+	defer srv.Close()
+	srv.SetLatency(5 * time.Millisecond)
+	for _, concurrency := range []int{1, 4, 8} {
+		b.Run(fmt.Sprintf("concurrency %d", concurrency), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				crawl(b, srv.API(), concurrency, previous)
+			}
+		})
+	}
+}
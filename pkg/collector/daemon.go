@@ -0,0 +1,206 @@
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+	"gopkg.in/guregu/null.v3"
+)
+
+// resumeDelay is how long the daemon waits before resuming a run which
+// failed, so that it doesn't hammer the DD API while it is down
+const resumeDelay = 5 * time.Minute
+
+// errInterrupted is recorded as the last error of a run which was stopped
+// before it could record how it went
+var errInterrupted = errors.New("the collector stopped in the middle of the run")
+
+// DefaultSchedule runs the collector once a day at midnight UTC
+var DefaultSchedule = Schedule{Interval: 24 * time.Hour}
+
+// Schedule is when the collector runs in daemon mode: every Interval, starting
+// Offset after midnight UTC
+type Schedule struct {
+	Interval time.Duration
+	Offset   time.Duration
+}
+
+// Prev returns the last scheduled time at or before t
+func (s Schedule) Prev(t time.Time) time.Time {
+	return t.Add(-s.Offset).Truncate(s.Interval).Add(s.Offset)
+}
+
+// Next returns the first scheduled time after t
+func (s Schedule) Next(t time.Time) time.Time {
+	return s.Prev(t).Add(s.Interval)
+}
+
+// StartDaemon runs the collector on the schedule until it is stopped, and then
+// closes Done. If the collector hasn't run since the last scheduled time, for
+// example because it was down, it runs straight away to catch up. Only the
+// latest missed run is caught up, since the leaderboard can't be recorded as
+// it was in the past. A run which was left unfinished is resumed resumeDelay
+// after it was last attempted, and if another collector holds the lock it is
+// given resumeDelay to finish before the schedule is checked again.
+func (c *Collector) StartDaemon(schedule Schedule) {
+	defer func() {
+		close(c.done)
+	}()
+	c.clearStaleStatus()
+	var busyUntil time.Time
+	for {
+		next, err := c.nextRun(schedule, time.Now())
+		if err != nil {
+			c.errorLog.Printf("collector schedule error: %v", err)
+			next = schedule.Next(time.Now())
+		}
+		if next.Before(busyUntil) {
+			next = busyUntil
+		}
+		c.infoLog.Printf("Next collector run at %s", next.Format(time.RFC3339))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-c.quit:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if !c.run(&schedule) {
+			busyUntil = time.Now().Add(resumeDelay)
+		}
+		select {
+		case <-c.quit:
+			return
+		default:
+		}
+	}
+}
+
+// clearStaleStatus clears the running flag left in the collector's status by
+// a collector which stopped in the middle of a run. The flag is only stale if
+// no collector holds the lock.
+func (c *Collector) clearStaleStatus() {
+	unlock, err := c.DB.CollectorStatus.Lock(context.Background())
+	if err != nil {
+		if !errors.Is(err, models.ErrCollectorRunning) {
+			c.errorLog.Printf("collector lock error: %v", err)
+		}
+		return
+	}
+	defer func() {
+		err := unlock()
+		if err != nil {
+			c.errorLog.Printf("collector unlock error: %v", err)
+		}
+	}()
+	status, err := c.DB.CollectorStatus.Select()
+	if err != nil {
+		if !errors.Is(err, models.ErrNoRecord) {
+			c.errorLog.Printf("collector status error: %v", err)
+		}
+		return
+	}
+	if !status.Running {
+		return
+	}
+	c.infoLog.Println("The last collector run was interrupted, clearing its status...")
+	status.Running = false
+	status.LastError = errInterrupted.Error()
+	c.updateStatus(status)
+}
+
+// nextRun returns when the collector should next run. The collector's last
+// attempt is taken from its status, falling back on the last recorded run.
+func (c *Collector) nextRun(schedule Schedule, now time.Time) (time.Time, error) {
+	_, err := c.DB.CollectorRunStates.SelectUnfinished()
+	unfinished := err == nil
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		return time.Time{}, err
+	}
+	var lastRun time.Time
+	status, err := c.DB.CollectorStatus.Select()
+	switch {
+	case err == nil && status.LastStarted.Valid:
+		lastRun = status.LastStarted.Time
+	case err == nil || errors.Is(err, models.ErrNoRecord):
+		run, err := c.DB.CollectorRuns.SelectLastRunID()
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, err
+		}
+		if err == nil {
+			lastRun = run.TimeStamp
+		}
+	default:
+		return time.Time{}, err
+	}
+	if unfinished {
+		if resume := lastRun.Add(resumeDelay); resume.After(now) {
+			return resume, nil
+		}
+		return now, nil
+	}
+	if lastRun.Before(schedule.Prev(now)) {
+		return now, nil
+	}
+	return schedule.Next(now), nil
+}
+
+// run takes the collector lock, collects the leaderboard and records how it
+// went in the collector's status. The schedule, if any, sets the next run. It
+// returns false if another collector holds the lock.
+func (c *Collector) run(schedule *Schedule) bool {
+	unlock, err := c.DB.CollectorStatus.Lock(context.Background())
+	if err != nil {
+		if errors.Is(err, models.ErrCollectorRunning) {
+			c.infoLog.Println("Another collector is running, skipping this run...")
+			return false
+		}
+		c.errorLog.Printf("collector lock error: %v", err)
+		return true
+	}
+	defer func() {
+		err := unlock()
+		if err != nil {
+			c.errorLog.Printf("collector unlock error: %v", err)
+		}
+	}()
+
+	status, err := c.DB.CollectorStatus.Select()
+	if err != nil {
+		if !errors.Is(err, models.ErrNoRecord) {
+			c.errorLog.Printf("collector status error: %v", err)
+		}
+		status = &models.CollectorStatus{}
+	}
+	start := time.Now()
+	status.Running = true
+	status.LastStarted = null.TimeFrom(start)
+	status.NextRun = null.Time{}
+	if schedule != nil {
+		status.NextRun = null.TimeFrom(schedule.Next(start))
+	}
+	c.updateStatus(status)
+
+	err = c.collect()
+	status.Running = false
+	if err != nil {
+		c.errorLog.Printf("collector error: %v", err)
+		status.LastError = err.Error()
+	} else {
+		status.LastSuccess = null.TimeFrom(time.Now())
+		status.LastDuration = models.Duration(time.Since(start))
+		status.LastError = ""
+	}
+	c.updateStatus(status)
+	return true
+}
+
+func (c *Collector) updateStatus(status *models.CollectorStatus) {
+	err := c.DB.CollectorStatus.Upsert(status)
+	if err != nil {
+		c.errorLog.Printf("collector status error: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package collector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	at := func(s string) time.Time {
+		tm, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	tests := []struct {
+		name     string
+		schedule Schedule
+		now      string
+		prev     string
+		next     string
+	}{
+		{"daily", DefaultSchedule, "2020-03-04T13:00:00Z", "2020-03-04T00:00:00Z", "2020-03-05T00:00:00Z"},
+		{"daily at midnight", DefaultSchedule, "2020-03-04T00:00:00Z", "2020-03-04T00:00:00Z", "2020-03-05T00:00:00Z"},
+		{"daily with offset", Schedule{24 * time.Hour, 6 * time.Hour}, "2020-03-04T03:00:00Z", "2020-03-03T06:00:00Z", "2020-03-04T06:00:00Z"},
+		{"six hourly", Schedule{6 * time.Hour, 30 * time.Minute}, "2020-03-04T13:00:00Z", "2020-03-04T12:30:00Z", "2020-03-04T18:30:00Z"},
+		{"other time zone", DefaultSchedule, "2020-03-04T01:00:00+02:00", "2020-03-03T00:00:00Z", "2020-03-04T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := at(tt.now)
+			if got := tt.schedule.Prev(now); !got.Equal(at(tt.prev)) {
+				t.Errorf("Prev = %s; want %s", got, tt.prev)
+			}
+			if got := tt.schedule.Next(now); !got.Equal(at(tt.next)) {
+				t.Errorf("Next = %s; want %s", got, tt.next)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
+	"github.com/alexwilkerson/ddstats-server/pkg/ddapi/ddapitest"
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+)
+
+var update = flag.Bool("update", false, "rerecord the leaderboard in testdata and rewrite the golden files")
+
+// goldenRun is what the golden test compares: the run, as set by initRun and
+// compileRunStats, and the rows calculatePlayer and calculateNewPlayer write
+type goldenRun struct {
+	Run           *models.CollectorRun            `json:"run"`
+	State         models.CollectorRunState        `json:"state"`
+	NewPlayers    []*models.CollectorNewPlayer    `json:"new_players"`
+	ActivePlayers []*models.CollectorActivePlayer `json:"active_players"`
+	HighScores    []*models.CollectorHighScore    `json:"high_scores"`
+	Anomalies     []*models.CollectorAnomaly      `json:"anomalies"`
+}
+
+// TestGoldenRun replays the leaderboard recorded in testdata/leaderboard
+// through the collector and compares what it calculates with
+// testdata/run.golden. Run it with -update to rerecord the leaderboard from
+// the fake server and rewrite the golden file, after checking the diff.
+func TestGoldenRun(t *testing.T) {
+	dir := filepath.Join("testdata", "leaderboard")
+	goldenFile := filepath.Join("testdata", "run.golden")
+	players, previous := testLeaderboard(250)
+
+	api := &ddapi.API{Client: &http.Client{Transport: &ddapi.Replayer{Dir: dir}}}
+	if *update {
+		srv := ddapitest.NewServer(players...)
+		defer srv.Close()
+		err := os.RemoveAll(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.MkdirAll(dir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		api = srv.API()
+		api.Client = &http.Client{Transport: &ddapi.Recorder{Dir: dir, Transport: srv.Client().Transport}}
+	}
+
+	c := &Collector{DDAPI: api, state: models.CollectorRunState{WorldRecord: 900}}
+	run := &models.CollectorRun{ID: 2, DeathTypes: map[string]int{}}
+	previousRun := &models.CollectorRun{
+		ID:                  1,
+		GlobalPlayers:       200,
+		GlobalGameTime:      2000000,
+		GlobalDeaths:        40000,
+		GlobalGems:          800000,
+		GlobalEnemiesKilled: 1200000,
+		GlobalDaggersHit:    16000000,
+		GlobalDaggersFired:  40000000,
+	}
+	now := time.Date(2020, 3, 4, 0, 0, 0, 0, time.UTC)
+	golden := goldenRun{Run: run}
+	err := c.calculateRun(run, previousRun, previousPlayersFrom(previous), now, func(batch *pageBatch) {
+		golden.NewPlayers = append(golden.NewPlayers, batch.newPlayers...)
+		golden.ActivePlayers = append(golden.ActivePlayers, batch.activePlayers...)
+		golden.HighScores = append(golden.HighScores, batch.highScores...)
+		golden.Anomalies = append(golden.Anomalies, batch.anomalies...)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden.State = c.state
+	got, err := json.MarshalIndent(golden, "", "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+
+	if *update {
+		err := ioutil.WriteFile(goldenFile, got, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("the calculated run differs from %s, run the test with -update if the change is intended", goldenFile)
+	}
+}
@@ -0,0 +1,108 @@
+package ddapi
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// maxCacheEntries is the number of cached responses above which responses
+// which are too old to be returned, even when stale, are removed from the
+// cache. If none are, the oldest response is removed, so the cache never holds
+// more than maxCacheEntries responses.
+const maxCacheEntries = 10000
+
+type cacheKey struct {
+	endpoint string
+	n        int
+}
+
+type cacheEntry struct {
+	value   interface{}
+	fetched time.Time
+}
+
+// responseCache holds the players looked up by ID or rank, and the leaderboard
+// pages neighborhoods are built from. The zero value is empty and ready to use.
+type responseCache struct {
+	sync.Mutex
+	entries map[cacheKey]cacheEntry
+	// now is replaced in tests
+	now func() time.Time
+}
+
+func (c *responseCache) time() time.Time {
+	if c.now == nil {
+		return time.Now()
+	}
+	return c.now()
+}
+
+// cachedPlayer returns a copy of the cached player for the key if it is
+// fresher than CacheTTL, and otherwise fetches and caches it. If fetching
+// fails, a copy of the cached player is returned with Stale set, as long as it
+// expired less than StaleTTL ago. A player who isn't found is never stale, and
+// nor is one whose caller has given up.
+func (api *API) cachedPlayer(ctx context.Context, key cacheKey, fetch func() (*Player, error)) (*Player, error) {
+	if api.CacheTTL <= 0 {
+		return fetch()
+	}
+
+	entry, cached := api.cache.load(key)
+	age := api.cache.time().Sub(entry.fetched)
+	if cached && age < api.CacheTTL {
+		return copyPlayer(entry.value.(*Player), false), nil
+	}
+
+	player, err := fetch()
+	if err != nil {
+		if cached && age < api.CacheTTL+api.StaleTTL && !errors.Is(err, ErrPlayerNotFound) && ctx.Err() == nil {
+			return copyPlayer(entry.value.(*Player), true), nil
+		}
+		return nil, err
+	}
+	api.cache.store(key, copyPlayer(player, false), api.CacheTTL+api.StaleTTL)
+	return player, nil
+}
+
+func (c *responseCache) load(key cacheKey) (cacheEntry, bool) {
+	c.Lock()
+	defer c.Unlock()
+	entry, ok := c.entries[key]
+	return entry, ok
+}
+
+// store caches the value, first removing the entries older than maxAge, or
+// else the oldest entry, if the cache is full
+func (c *responseCache) store(key cacheKey, value interface{}, maxAge time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	now := c.time()
+	if c.entries == nil {
+		c.entries = make(map[cacheKey]cacheEntry)
+	}
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxCacheEntries {
+		var oldest cacheKey
+		var oldestFetched time.Time
+		for k, entry := range c.entries {
+			if now.Sub(entry.fetched) >= maxAge {
+				delete(c.entries, k)
+			} else if oldestFetched.IsZero() || entry.fetched.Before(oldestFetched) {
+				oldest, oldestFetched = k, entry.fetched
+			}
+		}
+		if len(c.entries) >= maxCacheEntries {
+			delete(c.entries, oldest)
+		}
+	}
+	c.entries[key] = cacheEntry{value: value, fetched: now}
+}
+
+// copyPlayer returns a copy of the player, so that callers can't modify the
+// cached player
+func copyPlayer(player *Player, stale bool) *Player {
+	p := *player
+	p.Stale = stale
+	return &p
+}
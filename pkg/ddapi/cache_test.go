@@ -0,0 +1,215 @@
+package ddapi
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testServer responds to every request with the player, or with a server
+// error if failing is set, and counts the requests
+type testServer struct {
+	*httptest.Server
+	player   *Player
+	failing  int32
+	requests int32
+	release  chan struct{}
+}
+
+func newTestServer(player *Player) *testServer {
+	s := &testServer{player: player}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.requests, 1)
+		if s.release != nil {
+			<-s.release
+		}
+		if atomic.LoadInt32(&s.failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write(EncodeUser(s.player))
+	}))
+	return s
+}
+
+func (s *testServer) api() *API {
+	return &API{
+		Client:   s.Client(),
+		BaseURL:  s.URL,
+		CacheTTL: time.Minute,
+		StaleTTL: time.Hour,
+	}
+}
+
+func TestUserByIDCache(t *testing.T) {
+	s := newTestServer(&Player{PlayerID: 21854, PlayerName: "xvlv", Rank: 3})
+	defer s.Close()
+	api := s.api()
+	now := time.Now()
+	api.cache.now = func() time.Time { return now }
+
+	player, err := api.UserByID(21854)
+	if err != nil {
+		t.Fatal(err)
+	}
+	player.PlayerName = "modified"
+	player, err = api.UserByID(21854)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if player.PlayerName != "xvlv" {
+		t.Errorf("got name %q; the cached player was modified", player.PlayerName)
+	}
+	if n := atomic.LoadInt32(&s.requests); n != 1 {
+		t.Fatalf("got %d requests; want 1", n)
+	}
+
+	// looking up by rank is cached separately
+	_, err = api.UserByRank(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&s.requests); n != 2 {
+		t.Fatalf("got %d requests; want 2", n)
+	}
+
+	now = now.Add(2 * time.Minute)
+	_, err = api.UserByID(21854)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&s.requests); n != 3 {
+		t.Fatalf("got %d requests after the player expired; want 3", n)
+	}
+}
+
+func TestUserByIDStale(t *testing.T) {
+	s := newTestServer(&Player{PlayerID: 21854, PlayerName: "xvlv"})
+	defer s.Close()
+	api := s.api()
+	now := time.Now()
+	api.cache.now = func() time.Time { return now }
+
+	_, err := api.UserByID(21854)
+	if err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&s.failing, 1)
+
+	now = now.Add(30 * time.Minute)
+	player, err := api.UserByID(21854)
+	if err != nil {
+		t.Fatalf("got error %v; want the stale player", err)
+	}
+	if !player.Stale || player.PlayerName != "xvlv" {
+		t.Errorf("got %+v; want the stale player", player)
+	}
+
+	now = now.Add(2 * time.Hour)
+	_, err = api.UserByID(21854)
+	if !errors.Is(err, ErrStatusCode) {
+		t.Errorf("got error %v; want %v once the player is too stale", err, ErrStatusCode)
+	}
+
+	atomic.StoreInt32(&s.failing, 0)
+	player, err = api.UserByID(21854)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if player.Stale {
+		t.Error("got a stale player after the DD API recovered")
+	}
+}
+
+func TestUserByIDNotFoundIsNotStale(t *testing.T) {
+	s := newTestServer(&Player{PlayerID: 21854, PlayerName: "xvlv"})
+	defer s.Close()
+	api := s.api()
+	now := time.Now()
+	api.cache.now = func() time.Time { return now }
+
+	_, err := api.UserByID(21854)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.player = nil
+	now = now.Add(2 * time.Minute)
+	_, err = api.UserByID(21854)
+	if !errors.Is(err, ErrPlayerNotFound) {
+		t.Errorf("got error %v; want %v", err, ErrPlayerNotFound)
+	}
+}
+
+func TestRequestsAreCoalesced(t *testing.T) {
+	s := newTestServer(&Player{PlayerID: 21854, PlayerName: "xvlv"})
+	s.release = make(chan struct{})
+	defer s.Close()
+	api := s.api()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			player, err := api.UserByID(21854)
+			if err != nil || player.PlayerName != "xvlv" {
+				t.Errorf("got %+v, %v", player, err)
+			}
+		}()
+	}
+	// give every call time to join the one in flight
+	time.Sleep(100 * time.Millisecond)
+	close(s.release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&s.requests); n != 1 {
+		t.Errorf("got %d requests; want 1", n)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	rl := newRateLimiter(10, 2)
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if d := rl.reserve(now); d != 0 {
+			t.Fatalf("got wait %v within the burst; want 0", d)
+		}
+	}
+	if d := rl.reserve(now); d != 100*time.Millisecond {
+		t.Errorf("got wait %v; want 100ms", d)
+	}
+	if d := rl.reserve(now); d != 200*time.Millisecond {
+		t.Errorf("got wait %v for the next request; want 200ms", d)
+	}
+	if d := rl.reserve(now.Add(time.Second)); d != 0 {
+		t.Errorf("got wait %v after refilling; want 0", d)
+	}
+}
+
+func TestCacheEvictsOldestWhenFull(t *testing.T) {
+	now := time.Date(2020, 3, 4, 0, 0, 0, 0, time.UTC)
+	c := &responseCache{now: func() time.Time { return now }}
+	for i := 0; i < maxCacheEntries; i++ {
+		c.store(cacheKey{endpoint: "user", n: i}, i, time.Hour)
+		now = now.Add(time.Millisecond)
+	}
+	c.store(cacheKey{endpoint: "user", n: maxCacheEntries}, maxCacheEntries, time.Hour)
+	if len(c.entries) != maxCacheEntries {
+		t.Errorf("cache holds %d entries; want %d", len(c.entries), maxCacheEntries)
+	}
+	if _, ok := c.load(cacheKey{endpoint: "user", n: 0}); ok {
+		t.Error("oldest entry wasn't evicted")
+	}
+	if _, ok := c.load(cacheKey{endpoint: "user", n: maxCacheEntries}); !ok {
+		t.Error("new entry wasn't cached")
+	}
+
+	// replacing a cached entry doesn't evict another
+	c.store(cacheKey{endpoint: "user", n: 5}, 5, time.Hour)
+	if _, ok := c.load(cacheKey{endpoint: "user", n: 1}); !ok {
+		t.Error("entry evicted when replacing another")
+	}
+}
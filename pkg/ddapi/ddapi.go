@@ -1,26 +1,43 @@
 package ddapi
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
-	"io/ioutil"
+	"fmt"
 	"math"
 	"net/http"
 	"net/url"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/catalog"
 )
 
 const (
+	// DefaultBaseURL is the base URL of the Devil Daggers backend
+	DefaultBaseURL = "http://dd.hasmodai.com/backend16"
+	// DefaultCacheTTL is how long NewAPI caches players for
+	DefaultCacheTTL = time.Minute
+	// DefaultStaleTTL is how long NewAPI keeps expired players for in case
+	// the DD API fails
+	DefaultStaleTTL = time.Hour
+	// DefaultMaxRetries is how many times NewAPI retries failed requests
+	DefaultMaxRetries = 3
+	// DefaultRequestsPerSecond and DefaultRequestBurst are the rate limit
+	// NewAPI sets for requests to the DD API
+	DefaultRequestsPerSecond = 10
+	DefaultRequestBurst      = 20
 	// EndpointGetUserByID is the endpoint to get a user by ID
-	EndpointGetUserByID = "http://dd.hasmodai.com/backend16/get_user_by_id_public.php"
+	EndpointGetUserByID = "/get_user_by_id_public.php"
 	// EndpointGetUserByRank is the endpoint to get a user by rank
-	EndpointGetUserByRank = "http://dd.hasmodai.com/backend16/get_user_by_rank_public.php"
+	EndpointGetUserByRank = "/get_user_by_rank_public.php"
 	// EndpointGetScores is the endpoint to get the leaderboard
-	EndpointGetScores = "http://dd.hasmodai.com/backend16/get_scores.php"
+	EndpointGetScores = "/get_scores.php"
 	// EndpointGetUserSearch is the endpoint to get search for users
-	EndpointGetUserSearch = "http://dd.hasmodai.com/backend16/get_user_search_public.php"
+	EndpointGetUserSearch = "/get_user_search_public.php"
 )
 
 var (
@@ -28,41 +45,87 @@ var (
 	ErrPlayerNotFound = errors.New("player not found")
 	// ErrNoPlayersFound is returned when user search produces no users
 	ErrNoPlayersFound = errors.New("no players found")
-	// ErrStatusCode is returned when the Devil Daggers server responds with an error
+	// ErrStatusCode is matched by every StatusError, returned when the Devil
+	// Daggers server responds with an error
 	ErrStatusCode = errors.New("error getting a response from the Devil Daggers API")
+	// ErrNetwork is matched by every NetworkError, returned when the Devil
+	// Daggers server could not be reached
+	ErrNetwork = errors.New("could not reach the Devil Daggers API")
+	// ErrDecode is matched by every DecodeError
+	ErrDecode = errors.New("could not decode the response from the Devil Daggers API")
 )
 
-// API is used as an abstraction and to inject the client into the ddapi package
+// DecodeError is returned when a response from the DD API is too short for
+// what it says it contains. It matches ErrDecode with errors.Is.
+type DecodeError struct {
+	// Field is what was being decoded
+	Field string
+	// Offset is where Field starts in the response
+	Offset int
+	// Length is the length of the response and Need the number of bytes
+	// needed from Offset
+	Length int
+	Need   int
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%v: %s needs %d bytes at offset %d, response is %d bytes", ErrDecode, e.Field, e.Need, e.Offset, e.Length)
+}
+
+// Is reports whether target is ErrDecode
+func (e *DecodeError) Is(target error) bool {
+	return target == ErrDecode
+}
+
+// API is used as an abstraction and to inject the client into the ddapi package.
+// BaseURL is where the endpoints are requested from, DefaultBaseURL if empty.
+// The zero value does not cache players or limit the rate of requests.
 type API struct {
-	Client *http.Client
+	Client  *http.Client
+	BaseURL string
+	// CacheTTL is how long players looked up by ID or rank are cached for
+	CacheTTL time.Duration
+	// StaleTTL is how long after expiring a cached player is returned if
+	// the DD API fails
+	StaleTTL time.Duration
+	// MaxRetries is how many times a request is retried after a timeout or
+	// a server error, with jittered exponential backoff
+	MaxRetries int
+	cache      responseCache
+	requests   requestGroup
+	limiter    *rateLimiter
 }
 
-// NewAPI returns an API struct
+// NewAPI returns an API struct which uses the Devil Daggers backend, with the
+// default cache and rate limit
 func NewAPI(client *http.Client) *API {
-	return &API{
-		Client: client,
+	api := &API{
+		Client:     client,
+		BaseURL:    DefaultBaseURL,
+		CacheTTL:   DefaultCacheTTL,
+		StaleTTL:   DefaultStaleTTL,
+		MaxRetries: DefaultMaxRetries,
 	}
+	api.SetRateLimit(DefaultRequestsPerSecond, DefaultRequestBurst)
+	return api
 }
 
-// DeathTypes as defined by the DD API
-var DeathTypes = []string{
-	"FALLEN",
-	"SWARMED",
-	"IMPALED",
-	"GORED",
-	"INFESTED",
-	"OPENED",
-	"PURGED",
-	"DESECRATED",
-	"SACRIFICED",
-	"EVISCERATED",
-	"ANNIHILATED",
-	"INTOXICATED",
-	"ENVENMONATED",
-	"INCARNATED",
-	"DISCARNATED",
-	"BARBED",
-	"HAUNTED",
+// SetRateLimit limits the requests made to the DD API to requestsPerSecond,
+// allowing bursts of up to burst requests. Requests wait until they are
+// allowed. A requestsPerSecond of 0 removes the limit.
+func (api *API) SetRateLimit(requestsPerSecond float64, burst int) {
+	if requestsPerSecond <= 0 {
+		api.limiter = nil
+		return
+	}
+	api.limiter = newRateLimiter(requestsPerSecond, float64(burst))
+}
+
+func (api *API) url(endpoint string) string {
+	if api.BaseURL == "" {
+		return DefaultBaseURL + endpoint
+	}
+	return strings.TrimSuffix(api.BaseURL, "/") + endpoint
 }
 
 // Player is the struct returned after parsing the binary data
@@ -86,6 +149,9 @@ type Player struct {
 	OverallDaggersHit      uint64  `json:"overall_daggers_hit"`
 	OverallDaggersFired    uint64  `json:"overall_daggers_fired"`
 	OverallAccuracy        float64 `json:"overall_accuracy"`
+	// Stale is set if the player was cached and could not be refreshed
+	// because the DD API failed
+	Stale bool `json:"stale,omitempty"`
 }
 
 // Leaderboard is a struct returned after being converted from bytes
@@ -103,65 +169,65 @@ type Leaderboard struct {
 	Players               []*Player `json:"players"`
 }
 
-// UserByID hits the backend DD API and returns a Player
+// UserByID hits the backend DD API and returns a Player. Players are cached
+// for CacheTTL, and a cached player is returned with Stale set if the DD API
+// fails once they have expired.
 func (api *API) UserByID(id int) (*Player, error) {
-	form := url.Values{"uid": {strconv.Itoa(id)}}
-	resp, err := api.Client.PostForm(EndpointGetUserByID, form)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, ErrStatusCode
-	}
+	return api.UserByIDContext(context.Background(), id)
+}
 
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
+// UserByIDContext is UserByID, giving up when the context is done
+func (api *API) UserByIDContext(ctx context.Context, id int) (*Player, error) {
+	return api.cachedPlayer(ctx, cacheKey{EndpointGetUserByID, id}, func() (*Player, error) {
+		bodyBytes, err := api.post(ctx, EndpointGetUserByID, url.Values{"uid": {strconv.Itoa(id)}})
+		if err != nil {
+			return nil, err
+		}
 
-	player, _, err := bytesToPlayer(bodyBytes, 19)
-	if err != nil {
-		return nil, err
-	}
+		player, _, err := bytesToPlayer(bodyBytes, userHeaderSize)
+		if err != nil {
+			return nil, err
+		}
 
-	if player.PlayerName == "" {
-		return nil, ErrPlayerNotFound
-	}
+		if player.PlayerName == "" {
+			return nil, ErrPlayerNotFound
+		}
 
-	return player, nil
+		return player, nil
+	})
 }
 
-// UserByRank hits the backend DD API and returns a Player
+// UserByRank hits the backend DD API and returns a Player. It is cached the
+// same way as UserByID.
 func (api *API) UserByRank(rank int) (*Player, error) {
-	form := url.Values{"rank": {strconv.Itoa(rank)}}
-	resp, err := api.Client.PostForm(EndpointGetUserByRank, form)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, ErrStatusCode
-	}
+	return api.UserByRankContext(context.Background(), rank)
+}
 
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
+// UserByRankContext is UserByRank, giving up when the context is done
+func (api *API) UserByRankContext(ctx context.Context, rank int) (*Player, error) {
+	return api.cachedPlayer(ctx, cacheKey{EndpointGetUserByRank, rank}, func() (*Player, error) {
+		bodyBytes, err := api.post(ctx, EndpointGetUserByRank, url.Values{"rank": {strconv.Itoa(rank)}})
+		if err != nil {
+			return nil, err
+		}
 
-	player, _, err := bytesToPlayer(bodyBytes, 19)
-	if err != nil {
-		return nil, err
-	}
+		player, _, err := bytesToPlayer(bodyBytes, userHeaderSize)
+		if err != nil {
+			return nil, err
+		}
 
-	return player, nil
+		return player, nil
+	})
 }
 
 // GetLeaderboard takes a limit and an offset, hits the backend DD API and returns
 // a Leaderboard struct
 func (api *API) GetLeaderboard(limit, offset int) (*Leaderboard, error) {
+	return api.GetLeaderboardContext(context.Background(), limit, offset)
+}
+
+// GetLeaderboardContext is GetLeaderboard, giving up when the context is done
+func (api *API) GetLeaderboardContext(ctx context.Context, limit, offset int) (*Leaderboard, error) {
 	// the DD API weirdly counts users starting from 1 but internally uses a 0 index
 	// this fix it to make it more readable for users.
 	if offset != 0 {
@@ -169,17 +235,7 @@ func (api *API) GetLeaderboard(limit, offset int) (*Leaderboard, error) {
 	}
 
 	form := url.Values{"user": {"0"}, "level": {"survival"}, "offset": {strconv.Itoa(offset)}}
-	resp, err := api.Client.PostForm(EndpointGetScores, form)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, ErrStatusCode
-	}
-
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	bodyBytes, err := api.post(ctx, EndpointGetScores, form)
 	if err != nil {
 		return nil, err
 	}
@@ -194,6 +250,11 @@ func (api *API) GetLeaderboard(limit, offset int) (*Leaderboard, error) {
 
 // UserSearch takes a user name and hits the backend DD API and returns a slice of Players
 func (api *API) UserSearch(name string) ([]*Player, error) {
+	return api.UserSearchContext(context.Background(), name)
+}
+
+// UserSearchContext is UserSearch, giving up when the context is done
+func (api *API) UserSearchContext(ctx context.Context, name string) ([]*Player, error) {
 	// The Devil Daggers API responds with no users found if the user name is
 	// longer than 16 characters. This truncates the name to 16 characters and
 	// does a partial match, hopefully finding the intended user. If not, will
@@ -202,18 +263,7 @@ func (api *API) UserSearch(name string) ([]*Player, error) {
 	if len(name) > 16 {
 		name = name[:16]
 	}
-	form := url.Values{"search": {name}}
-	resp, err := api.Client.PostForm(EndpointGetUserSearch, form)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, ErrStatusCode
-	}
-
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	bodyBytes, err := api.post(ctx, EndpointGetUserSearch, url.Values{"search": {name}})
 	if err != nil {
 		return nil, err
 	}
@@ -230,15 +280,40 @@ func (api *API) UserSearch(name string) ([]*Player, error) {
 	return players, nil
 }
 
-// BytesToPlayer takes a byte array and an initial offset
+const (
+	// userHeaderSize is the size of the header before the player record in
+	// the responses to lookups by ID or rank, and before the count of players
+	// in search results
+	userHeaderSize = 19
+	// leaderboardHeaderSize is the size of the header of a leaderboard page,
+	// which holds the global stats
+	leaderboardHeaderSize = 83
+	// playerRecordSize is the size of a player record, not counting the name.
+	// Only the first playerStatsSize bytes after the name are read.
+	playerRecordSize = 90
+	playerStatsSize  = 84
+	// unknownDeathType prefixes the ID of a death type missing from the
+	// catalog
+	unknownDeathType = "UNKNOWN_"
+)
+
+// bytesToPlayer takes a byte array and an initial offset
 // and returns a Player object. Will return an error if the
 // Player is not found
 func bytesToPlayer(b []byte, bytePosition int) (*Player, int, error) {
 	var player Player
 
+	err := checkLength(b, "player record", bytePosition, 2)
+	if err != nil {
+		return nil, 0, err
+	}
 	playerNameLength := uint8(b[bytePosition])
 
 	bytePosition += 2
+	err = checkLength(b, "player record", bytePosition, int(playerNameLength)+playerStatsSize)
+	if err != nil {
+		return nil, 0, err
+	}
 	player.PlayerName = strings.ToValidUTF8(string(b[bytePosition:bytePosition+int(playerNameLength)]), "?")
 	bytePosition += int(playerNameLength)
 	// just figured out this information manually...
@@ -255,10 +330,12 @@ func bytesToPlayer(b []byte, bytePosition int) (*Player, int, error) {
 	if player.DaggersFired > 0 {
 		player.Accuracy = roundToNearest(float64(player.DaggersHit)/float64(player.DaggersFired)*100, 2)
 	}
-	player.DeathType = DeathTypes[toUint16(b, bytePosition+32)]
+	player.DeathType = deathTypeName(int(toUint16(b, bytePosition+32)))
 	player.OverallGameTime = roundToNearest(float64(toUint64(b, bytePosition+60))/10000, 4)
 	player.OverallDeaths = toUint64(b, bytePosition+36)
-	player.OverallAverageGameTime = roundToNearest(player.OverallGameTime/float64(player.OverallDeaths), 4)
+	if player.OverallDeaths > 0 {
+		player.OverallAverageGameTime = roundToNearest(player.OverallGameTime/float64(player.OverallDeaths), 4)
+	}
 	player.OverallEnemiesKilled = toUint64(b, bytePosition+44)
 	player.OverallGems = toUint64(b, bytePosition+68)
 	player.OverallDaggersHit = toUint64(b, bytePosition+76)
@@ -270,16 +347,23 @@ func bytesToPlayer(b []byte, bytePosition int) (*Player, int, error) {
 	return &player, int(playerNameLength), nil
 }
 
-// GetScoresBytesToLeaderboard converts the byte array from the DD API
+// bytesToLeaderboard converts the byte array from the DD API
 // to a Leaderboard struct
 func bytesToLeaderboard(b []byte, limit int) (*Leaderboard, error) {
 	var leaderboard Leaderboard
 	leaderboard.Players = []*Player{} // init this so won't be nil
 
+	err := checkLength(b, "leaderboard header", 0, leaderboardHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+
 	leaderboard.GlobalDeaths = toUint64(b, 11)
 	leaderboard.GlobalEnemiesKilled = toUint64(b, 19)
 	leaderboard.GlobalGameTime = roundToNearest(float64(toUint64(b, 35))/1000, 4)
-	leaderboard.GlobalAverageGameTime = roundToNearest(leaderboard.GlobalGameTime/float64(leaderboard.GlobalDeaths), 4)
+	if leaderboard.GlobalDeaths > 0 {
+		leaderboard.GlobalAverageGameTime = roundToNearest(leaderboard.GlobalGameTime/float64(leaderboard.GlobalDeaths), 4)
+	}
 	leaderboard.GlobalGems = toUint64(b, 43)
 	leaderboard.GlobalDaggersHit = toUint64(b, 51)
 	leaderboard.GlobalDaggersFired = toUint64(b, 27)
@@ -293,38 +377,62 @@ func bytesToLeaderboard(b []byte, limit int) (*Leaderboard, error) {
 		leaderboard.PlayerCount = limit
 	}
 
-	offset := 83
+	offset := leaderboardHeaderSize
 	for i := 0; i < leaderboard.PlayerCount; i++ {
 		p, playerNameLength, err := bytesToPlayer(b, offset)
 		if err != nil {
-			return nil, ErrPlayerNotFound
+			return nil, err
 		}
-		offset += playerNameLength + 90
+		offset += playerNameLength + playerRecordSize
 		leaderboard.Players = append(leaderboard.Players, p)
 	}
 
 	return &leaderboard, nil
 }
 
-// UserSearchBytesToPlayers converts a byte array to a player slice
+// userSearchBytesToPlayers converts a byte array to a player slice
 func userSearchBytesToPlayers(b []byte) ([]*Player, error) {
+	err := checkLength(b, "search header", 0, userHeaderSize)
+	if err != nil {
+		return nil, err
+	}
 	playerCount := int(toUint16(b, 11))
 	if playerCount < 1 {
 		return nil, ErrNoPlayersFound
 	}
 	var players []*Player
-	offset := 19
+	offset := userHeaderSize
 	for i := 0; i < playerCount; i++ {
 		p, playerNameLength, err := bytesToPlayer(b, offset)
 		if err != nil {
-			return nil, ErrPlayerNotFound
+			return nil, err
 		}
-		offset += playerNameLength + 90
+		offset += playerNameLength + playerRecordSize
 		players = append(players, p)
 	}
 	return players, nil
 }
 
+// deathTypeName returns the name of the death type, or UNKNOWN_<id> for one
+// which isn't in the catalog yet, so that a death type added by a game update
+// doesn't stop the players who died to it from being decoded
+func deathTypeName(id int) string {
+	name, ok := catalog.Current.DeathType(id)
+	if !ok {
+		return fmt.Sprintf("%s%d", unknownDeathType, id)
+	}
+	return name
+}
+
+// checkLength returns a DecodeError if b is too short to read n bytes of what
+// from offset
+func checkLength(b []byte, what string, offset, n int) error {
+	if offset+n > len(b) {
+		return &DecodeError{Field: what, Offset: offset, Length: len(b), Need: n}
+	}
+	return nil
+}
+
 func toUint64(b []byte, offset int) uint64 {
 	return binary.LittleEndian.Uint64(b[offset : offset+8])
 }
@@ -0,0 +1,195 @@
+// Package ddapitest provides a fake Devil Daggers backend for tests. It serves
+// the same binary formats as dd.hasmodai.com from an in-memory list of players,
+// so anything which takes a *ddapi.API can be tested offline.
+package ddapitest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
+)
+
+// PageSize is the number of players the leaderboard endpoint returns at a time
+const PageSize = 100
+
+// Server is a fake Devil Daggers backend. It can be made flaky with FailNext
+// and SetLatency.
+type Server struct {
+	*httptest.Server
+	mu         sync.Mutex
+	players    []*ddapi.Player
+	requests   int
+	failures   int
+	failStatus int
+	latency    time.Duration
+}
+
+// NewServer starts a Server with the players on its leaderboard, ranked by
+// their Rank field. The caller should call Close when finished.
+func NewServer(players ...*ddapi.Player) *Server {
+	s := &Server{}
+	s.SetPlayers(players...)
+	mux := http.NewServeMux()
+	mux.HandleFunc(ddapi.EndpointGetUserByID, s.getUserByID)
+	mux.HandleFunc(ddapi.EndpointGetUserByRank, s.getUserByRank)
+	mux.HandleFunc(ddapi.EndpointGetScores, s.getScores)
+	mux.HandleFunc(ddapi.EndpointGetUserSearch, s.getUserSearch)
+	s.Server = httptest.NewServer(s.flaky(mux))
+	return s
+}
+
+// FailNext makes the next n requests fail with the status code
+func (s *Server) FailNext(n, statusCode int) {
+	s.mu.Lock()
+	s.failures = n
+	s.failStatus = statusCode
+	s.mu.Unlock()
+}
+
+// SetLatency delays every response by d, or until the request is canceled
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	s.latency = d
+	s.mu.Unlock()
+}
+
+// Requests returns the number of requests the server has received
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *Server) flaky(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests++
+		latency := s.latency
+		fail := s.failures > 0
+		failStatus := s.failStatus
+		if fail {
+			s.failures--
+		}
+		s.mu.Unlock()
+
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if fail {
+			http.Error(w, http.StatusText(failStatus), failStatus)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// API returns a ddapi.API which requests the server
+func (s *Server) API() *ddapi.API {
+	return &ddapi.API{
+		Client:  s.Client(),
+		BaseURL: s.URL,
+	}
+}
+
+// SetPlayers replaces the players on the leaderboard
+func (s *Server) SetPlayers(players ...*ddapi.Player) {
+	sorted := make([]*ddapi.Player, len(players))
+	copy(sorted, players)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Rank < sorted[j].Rank
+	})
+	s.mu.Lock()
+	s.players = sorted
+	s.mu.Unlock()
+}
+
+func (s *Server) find(match func(p *ddapi.Player) bool) *ddapi.Player {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.players {
+		if match(p) {
+			return p
+		}
+	}
+	return nil
+}
+
+func (s *Server) getUserByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PostFormValue("uid"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p := s.find(func(p *ddapi.Player) bool { return p.PlayerID == id })
+	w.Write(ddapi.EncodeUser(p))
+}
+
+func (s *Server) getUserByRank(w http.ResponseWriter, r *http.Request) {
+	rank, err := strconv.ParseUint(r.PostFormValue("rank"), 10, 32)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p := s.find(func(p *ddapi.Player) bool { return p.Rank == uint32(rank) })
+	w.Write(ddapi.EncodeUser(p))
+}
+
+func (s *Server) getScores(w http.ResponseWriter, r *http.Request) {
+	offset, err := strconv.Atoi(r.PostFormValue("offset"))
+	if err != nil || offset < 0 {
+		http.Error(w, "invalid offset", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	players := s.players
+	s.mu.Unlock()
+	page := []*ddapi.Player{}
+	if offset < len(players) {
+		page = players[offset:]
+	}
+	if len(page) > PageSize {
+		page = page[:PageSize]
+	}
+	w.Write(ddapi.EncodeLeaderboard(leaderboard(players, page)))
+}
+
+func (s *Server) getUserSearch(w http.ResponseWriter, r *http.Request) {
+	search := strings.ToLower(r.PostFormValue("search"))
+	var found []*ddapi.Player
+	s.mu.Lock()
+	for _, p := range s.players {
+		if strings.Contains(strings.ToLower(p.PlayerName), search) {
+			found = append(found, p)
+		}
+	}
+	s.mu.Unlock()
+	w.Write(ddapi.EncodeUserSearch(found))
+}
+
+// leaderboard returns a page of the leaderboard, with global stats totalled
+// from every player on it
+func leaderboard(players, page []*ddapi.Player) *ddapi.Leaderboard {
+	l := &ddapi.Leaderboard{
+		GlobalPlayerCount: uint32(len(players)),
+		Players:           page,
+	}
+	for _, p := range players {
+		l.GlobalDeaths += p.OverallDeaths
+		l.GlobalEnemiesKilled += p.OverallEnemiesKilled
+		l.GlobalGameTime += p.OverallGameTime
+		l.GlobalGems += p.OverallGems
+		l.GlobalDaggersFired += p.OverallDaggersFired
+		l.GlobalDaggersHit += p.OverallDaggersHit
+	}
+	return l
+}
@@ -0,0 +1,120 @@
+package ddapitest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
+)
+
+func testPlayer(id uint64, name string, rank uint32, gameTime float64) *ddapi.Player {
+	return &ddapi.Player{
+		PlayerID:               id,
+		PlayerName:             name,
+		Rank:                   rank,
+		GameTime:               gameTime,
+		EnemiesKilled:          1000,
+		Gems:                   300,
+		DaggersHit:             5000,
+		DaggersFired:           20000,
+		Accuracy:               25,
+		DeathType:              "IMPALED",
+		OverallGameTime:        123456.7891,
+		OverallAverageGameTime: 61.7284,
+		OverallEnemiesKilled:   100000,
+		OverallGems:            20000,
+		OverallDeaths:          2000,
+		OverallDaggersHit:      400000,
+		OverallDaggersFired:    1600000,
+		OverallAccuracy:        25,
+	}
+}
+
+func TestUserByID(t *testing.T) {
+	want := testPlayer(21854, "xvlv", 3, 1183.4567)
+	s := NewServer(testPlayer(1, "bintr", 1, 1200), want)
+	defer s.Close()
+
+	got, err := s.API().UserByID(21854)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v; want %+v", got, want)
+	}
+
+	_, err = s.API().UserByID(999)
+	if !errors.Is(err, ddapi.ErrPlayerNotFound) {
+		t.Errorf("got error %v; want %v", err, ddapi.ErrPlayerNotFound)
+	}
+}
+
+func TestUserByRank(t *testing.T) {
+	s := NewServer(testPlayer(1, "bintr", 1, 1200), testPlayer(21854, "xvlv", 2, 1183.4567))
+	defer s.Close()
+
+	got, err := s.API().UserByRank(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.PlayerID != 21854 {
+		t.Errorf("got player %d; want 21854", got.PlayerID)
+	}
+}
+
+func TestGetLeaderboard(t *testing.T) {
+	var players []*ddapi.Player
+	for i := 1; i <= 150; i++ {
+		players = append(players, testPlayer(uint64(1000+i), "player", uint32(i), 1000-float64(i)))
+	}
+	s := NewServer(players...)
+	defer s.Close()
+
+	leaderboard, err := s.API().GetLeaderboard(10, 101)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaderboard.PlayerCount != 10 || len(leaderboard.Players) != 10 {
+		t.Fatalf("got %d players; want 10", len(leaderboard.Players))
+	}
+	if got := leaderboard.Players[0].Rank; got != 101 {
+		t.Errorf("got first rank %d; want 101", got)
+	}
+	if leaderboard.GlobalPlayerCount != 150 {
+		t.Errorf("got global player count %d; want 150", leaderboard.GlobalPlayerCount)
+	}
+	if leaderboard.GlobalDeaths != 150*2000 {
+		t.Errorf("got global deaths %d; want %d", leaderboard.GlobalDeaths, 150*2000)
+	}
+
+	leaderboard, err = s.API().GetLeaderboard(100, 141)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaderboard.Players) != 10 {
+		t.Errorf("got %d players on the last page; want 10", len(leaderboard.Players))
+	}
+}
+
+func TestUserSearch(t *testing.T) {
+	s := NewServer(
+		testPlayer(3, "Cookie", 30, 900),
+		testPlayer(1, "cookiemonster", 10, 1000),
+		testPlayer(2, "bintr", 1, 1200),
+	)
+	defer s.Close()
+
+	players, err := s.API().UserSearch("cookie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(players) != 2 || players[0].PlayerID != 1 || players[1].PlayerID != 3 {
+		t.Errorf("got %+v; want players 1 and 3 ordered by rank", players)
+	}
+
+	_, err = s.API().UserSearch("nobody")
+	if !errors.Is(err, ddapi.ErrNoPlayersFound) {
+		t.Errorf("got error %v; want %v", err, ddapi.ErrNoPlayersFound)
+	}
+}
@@ -0,0 +1,86 @@
+package ddapi
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/catalog"
+)
+
+// EncodeUser encodes a player the way the DD API responds to a lookup by ID
+// or rank. A nil player is encoded the way it responds when there is no such
+// player.
+func EncodeUser(p *Player) []byte {
+	if p == nil {
+		return make([]byte, userHeaderSize+playerRecordSize)
+	}
+	return append(make([]byte, userHeaderSize), playerToBytes(p)...)
+}
+
+// EncodeLeaderboard encodes a leaderboard page the way the DD API responds to
+// get_scores. Every player in Players is encoded, PlayerCount is ignored.
+func EncodeLeaderboard(l *Leaderboard) []byte {
+	b := make([]byte, leaderboardHeaderSize)
+	binary.LittleEndian.PutUint64(b[11:], l.GlobalDeaths)
+	binary.LittleEndian.PutUint64(b[19:], l.GlobalEnemiesKilled)
+	binary.LittleEndian.PutUint64(b[27:], l.GlobalDaggersFired)
+	binary.LittleEndian.PutUint64(b[35:], uint64(math.Round(l.GlobalGameTime*1000)))
+	binary.LittleEndian.PutUint64(b[43:], l.GlobalGems)
+	binary.LittleEndian.PutUint64(b[51:], l.GlobalDaggersHit)
+	binary.LittleEndian.PutUint16(b[59:], uint16(len(l.Players)))
+	binary.LittleEndian.PutUint32(b[75:], l.GlobalPlayerCount)
+	for _, p := range l.Players {
+		b = append(b, playerToBytes(p)...)
+	}
+	return b
+}
+
+// EncodeUserSearch encodes players the way the DD API responds to a search
+func EncodeUserSearch(players []*Player) []byte {
+	b := make([]byte, userHeaderSize)
+	binary.LittleEndian.PutUint16(b[11:], uint16(len(players)))
+	for _, p := range players {
+		b = append(b, playerToBytes(p)...)
+	}
+	return b
+}
+
+// playerToBytes is the inverse of bytesToPlayer. The stats which bytesToPlayer
+// calculates, such as accuracy, are not encoded. Names longer than 255 bytes
+// are truncated. UNKNOWN_<id> death types are encoded as their ID and any
+// other unknown death type as FALLEN.
+func playerToBytes(p *Player) []byte {
+	name := p.PlayerName
+	if len(name) > math.MaxUint8 {
+		name = name[:math.MaxUint8]
+	}
+	b := make([]byte, len(name)+playerRecordSize)
+	b[0] = uint8(len(name))
+	copy(b[2:], name)
+	stats := b[2+len(name):]
+	binary.LittleEndian.PutUint32(stats[0:], p.Rank)
+	binary.LittleEndian.PutUint64(stats[4:], p.PlayerID)
+	binary.LittleEndian.PutUint32(stats[12:], uint32(math.Round(p.GameTime*10000)))
+	binary.LittleEndian.PutUint32(stats[16:], p.EnemiesKilled)
+	binary.LittleEndian.PutUint32(stats[20:], p.DaggersFired)
+	binary.LittleEndian.PutUint32(stats[24:], p.DaggersHit)
+	binary.LittleEndian.PutUint32(stats[28:], p.Gems)
+	binary.LittleEndian.PutUint16(stats[32:], deathTypeIndex(p.DeathType))
+	binary.LittleEndian.PutUint64(stats[36:], p.OverallDeaths)
+	binary.LittleEndian.PutUint64(stats[44:], p.OverallEnemiesKilled)
+	binary.LittleEndian.PutUint64(stats[52:], p.OverallDaggersFired)
+	binary.LittleEndian.PutUint64(stats[60:], uint64(math.Round(p.OverallGameTime*10000)))
+	binary.LittleEndian.PutUint64(stats[68:], p.OverallGems)
+	binary.LittleEndian.PutUint64(stats[76:], p.OverallDaggersHit)
+	return b
+}
+
+func deathTypeIndex(deathType string) uint16 {
+	id, ok := catalog.Current.DeathTypeID(deathType)
+	if !ok && strings.HasPrefix(deathType, unknownDeathType) {
+		id, _ = strconv.Atoi(strings.TrimPrefix(deathType, unknownDeathType))
+	}
+	return uint16(id)
+}
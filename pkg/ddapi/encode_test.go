@@ -0,0 +1,183 @@
+package ddapi
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/catalog"
+)
+
+// randomPlayer returns a player with random stats. The stats which are
+// calculated when decoding are left for the round trip to fill in.
+func randomPlayer(r *rand.Rand) *Player {
+	name := make([]byte, r.Intn(33))
+	for i := range name {
+		name[i] = byte('!' + r.Intn('~'-'!'))
+	}
+	return &Player{
+		PlayerID:             uint64(r.Int63n(1<<40)) + 1,
+		PlayerName:           string(name),
+		Rank:                 r.Uint32(),
+		GameTime:             float64(r.Uint32()) / 10000,
+		EnemiesKilled:        r.Uint32(),
+		Gems:                 r.Uint32(),
+		DaggersHit:           r.Uint32(),
+		DaggersFired:         r.Uint32(),
+		DeathType:            catalog.Current.DeathTypes[r.Intn(len(catalog.Current.DeathTypes))],
+		OverallGameTime:      float64(r.Int63n(1<<40)) / 10000,
+		OverallEnemiesKilled: r.Uint64(),
+		OverallGems:          r.Uint64(),
+		OverallDeaths:        uint64(r.Intn(3)),
+		OverallDaggersHit:    r.Uint64(),
+		OverallDaggersFired:  r.Uint64(),
+	}
+}
+
+// withoutCalculatedStats returns a copy of p with the stats which are not
+// encoded zeroed
+func withoutCalculatedStats(p *Player) Player {
+	c := *p
+	c.Accuracy = 0
+	c.OverallAccuracy = 0
+	c.OverallAverageGameTime = 0
+	return c
+}
+
+func TestPlayerRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		want := randomPlayer(r)
+		b := EncodeUser(want)
+		got, _, err := bytesToPlayer(b, userHeaderSize)
+		if err != nil {
+			t.Fatalf("decoding %+v: %v", want, err)
+		}
+		if !reflect.DeepEqual(withoutCalculatedStats(got), *want) {
+			t.Fatalf("got %+v; want %+v", got, want)
+		}
+		if !bytes.Equal(EncodeUser(got), b) {
+			t.Fatalf("re-encoding %+v changed the bytes", got)
+		}
+	}
+}
+
+func TestLeaderboardRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		want := &Leaderboard{
+			GlobalDeaths:        r.Uint64(),
+			GlobalEnemiesKilled: r.Uint64(),
+			GlobalGameTime:      float64(r.Int63n(1<<40)) / 1000,
+			GlobalGems:          r.Uint64(),
+			GlobalDaggersFired:  r.Uint64(),
+			GlobalDaggersHit:    r.Uint64(),
+			GlobalPlayerCount:   r.Uint32(),
+			Players:             []*Player{},
+		}
+		for j := r.Intn(101); j > 0; j-- {
+			want.Players = append(want.Players, randomPlayer(r))
+		}
+		b := EncodeLeaderboard(want)
+		got, err := bytesToLeaderboard(b, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.PlayerCount != len(want.Players) {
+			t.Fatalf("got %d players; want %d", got.PlayerCount, len(want.Players))
+		}
+		if got.GlobalDeaths != want.GlobalDeaths || got.GlobalGameTime != want.GlobalGameTime || got.GlobalPlayerCount != want.GlobalPlayerCount {
+			t.Fatalf("got %+v; want %+v", got, want)
+		}
+		for j := range got.Players {
+			if !reflect.DeepEqual(withoutCalculatedStats(got.Players[j]), *want.Players[j]) {
+				t.Fatalf("got player %+v; want %+v", got.Players[j], want.Players[j])
+			}
+		}
+		if !bytes.Equal(EncodeLeaderboard(got), b) {
+			t.Fatal("re-encoding the leaderboard changed the bytes")
+		}
+	}
+}
+
+func TestUserSearchRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	want := []*Player{randomPlayer(r), randomPlayer(r), randomPlayer(r)}
+	got, err := userSearchBytesToPlayers(EncodeUserSearch(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d players; want %d", len(got), len(want))
+	}
+	for i := range got {
+		if !reflect.DeepEqual(withoutCalculatedStats(got[i]), *want[i]) {
+			t.Errorf("got %+v; want %+v", got[i], want[i])
+		}
+	}
+
+	_, err = userSearchBytesToPlayers(EncodeUserSearch(nil))
+	if !errors.Is(err, ErrNoPlayersFound) {
+		t.Errorf("got error %v; want %v", err, ErrNoPlayersFound)
+	}
+}
+
+func TestDecodeUnknownDeathType(t *testing.T) {
+	b := EncodeUser(&Player{PlayerID: 1, PlayerName: "xvlv"})
+	b[userHeaderSize+2+len("xvlv")+32] = 200
+	player, _, err := bytesToPlayer(b, userHeaderSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if player.DeathType != "UNKNOWN_200" {
+		t.Errorf("got death type %q; want UNKNOWN_200", player.DeathType)
+	}
+	if !bytes.Equal(EncodeUser(player), b) {
+		t.Error("an unknown death type isn't encoded back to its ID")
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	user := EncodeUser(&Player{PlayerID: 1, PlayerName: "xvlv"})
+	leaderboard := EncodeLeaderboard(&Leaderboard{Players: []*Player{{PlayerID: 1, PlayerName: "xvlv"}}})
+
+	tests := []struct {
+		name   string
+		decode func() error
+	}{
+		{"empty user", func() error {
+			_, _, err := bytesToPlayer(nil, userHeaderSize)
+			return err
+		}},
+		{"short user", func() error {
+			_, _, err := bytesToPlayer(user[:len(user)-10], userHeaderSize)
+			return err
+		}},
+		{"short leaderboard header", func() error {
+			_, err := bytesToLeaderboard(leaderboard[:50], 100)
+			return err
+		}},
+		{"short leaderboard", func() error {
+			_, err := bytesToLeaderboard(leaderboard[:leaderboardHeaderSize+10], 100)
+			return err
+		}},
+		{"short search", func() error {
+			_, err := userSearchBytesToPlayers([]byte{1, 2, 3})
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.decode()
+			if !errors.Is(err, ErrDecode) {
+				t.Fatalf("got error %v; want %v", err, ErrDecode)
+			}
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("got error %T; want *DecodeError", err)
+			}
+		})
+	}
+}
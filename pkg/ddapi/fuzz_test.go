@@ -0,0 +1,79 @@
+//go:build go1.18
+// +build go1.18
+
+package ddapi
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// checkDecodeError fails if err is not one of the errors the decoders are
+// documented to return
+func checkDecodeError(t *testing.T, err error) {
+	if err != nil && !errors.Is(err, ErrDecode) && !errors.Is(err, ErrPlayerNotFound) && !errors.Is(err, ErrNoPlayersFound) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func FuzzBytesToPlayer(f *testing.F) {
+	f.Add(EncodeUser(&Player{PlayerID: 21854, PlayerName: "xvlv", GameTime: 1183.4567, DeathType: "GORED"}))
+	f.Add(EncodeUser(nil))
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		player, _, err := bytesToPlayer(b, userHeaderSize)
+		checkDecodeError(t, err)
+		if err != nil {
+			return
+		}
+		again, _, err := bytesToPlayer(EncodeUser(player), userHeaderSize)
+		if err != nil {
+			t.Fatalf("decoding re-encoded %+v: %v", player, err)
+		}
+		if *again != *player {
+			t.Fatalf("got %+v after re-encoding; want %+v", again, player)
+		}
+	})
+}
+
+func FuzzBytesToLeaderboard(f *testing.F) {
+	f.Add(EncodeLeaderboard(&Leaderboard{GlobalDeaths: 10, Players: []*Player{{PlayerID: 1, PlayerName: "bintr"}, {PlayerID: 2}}}), 100)
+	f.Add(EncodeLeaderboard(&Leaderboard{}), 100)
+	f.Add([]byte{}, 100)
+	f.Fuzz(func(t *testing.T, b []byte, limit int) {
+		leaderboard, err := bytesToLeaderboard(b, limit)
+		checkDecodeError(t, err)
+		if err != nil {
+			return
+		}
+		encoded := EncodeLeaderboard(leaderboard)
+		again, err := bytesToLeaderboard(encoded, limit)
+		if err != nil {
+			t.Fatalf("decoding re-encoded leaderboard: %v", err)
+		}
+		if !bytes.Equal(EncodeLeaderboard(again), encoded) {
+			t.Fatal("re-encoding the leaderboard changed the bytes")
+		}
+	})
+}
+
+func FuzzUserSearchBytesToPlayers(f *testing.F) {
+	f.Add(EncodeUserSearch([]*Player{{PlayerID: 1, PlayerName: "bintr"}, {PlayerID: 2, PlayerName: "xvlv"}}))
+	f.Add(EncodeUserSearch(nil))
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		players, err := userSearchBytesToPlayers(b)
+		checkDecodeError(t, err)
+		if err != nil {
+			return
+		}
+		again, err := userSearchBytesToPlayers(EncodeUserSearch(players))
+		if err != nil {
+			t.Fatalf("decoding re-encoded search: %v", err)
+		}
+		if len(again) != len(players) {
+			t.Fatalf("got %d players after re-encoding; want %d", len(again), len(players))
+		}
+	})
+}
@@ -0,0 +1,218 @@
+package ddapi
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// LeaderboardPage is a page of the leaderboard yielded by a
+// LeaderboardIterator
+type LeaderboardPage struct {
+	// Rank is the rank of the first player on the page
+	Rank int
+	*Leaderboard
+}
+
+// IteratorOptions configure a LeaderboardIterator
+type IteratorOptions struct {
+	// Rank is the rank to start from, 1 if 0. Passing the NextRank of an
+	// iterator which was stopped resumes where it left off.
+	Rank int
+	// Concurrency is how many pages are fetched at once, 1 if 0. Pages are
+	// still yielded in order.
+	Concurrency int
+	// PageTimeout bounds how long a page is waited for, retries included
+	PageTimeout time.Duration
+	// Progress is called with the progress of the iterator every time it
+	// yields a page
+	Progress func(Progress)
+}
+
+// Progress is the progress of a LeaderboardIterator
+type Progress struct {
+	// NextRank is the rank the iterator will continue from
+	NextRank int
+	// Players is the number of players yielded so far
+	Players int
+	// Total is the number of players on the leaderboard
+	Total int
+}
+
+// LeaderboardIterator yields the leaderboard page by page, starting from a
+// rank and ending after the last player. The first page is fetched on its own
+// to learn the size of the pages, and the pages after it are fetched up to
+// Concurrency at a time.
+//
+//	it := api.IterateLeaderboard(ctx, ddapi.IteratorOptions{})
+//	defer it.Close()
+//	for it.Next() {
+//		page := it.Page()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type LeaderboardIterator struct {
+	api      *API
+	ctx      context.Context
+	cancel   context.CancelFunc
+	options  IteratorOptions
+	page     *LeaderboardPage
+	err      error
+	done     bool
+	nextRank int
+	players  int
+	// pageSize and total are learned from the first page
+	pageSize int
+	total    int
+	// pending are the pages being fetched, in the order they are yielded,
+	// and dispatchRank is the rank of the next page to fetch
+	pending      []chan pageResult
+	dispatchRank int
+}
+
+type pageResult struct {
+	page *LeaderboardPage
+	err  error
+}
+
+// IterateLeaderboard returns an iterator over the leaderboard. The iterator
+// stops with the context's error if it is done, and must be closed.
+func (api *API) IterateLeaderboard(ctx context.Context, options IteratorOptions) *LeaderboardIterator {
+	if options.Rank < 1 {
+		options.Rank = 1
+	}
+	if options.Concurrency < 1 {
+		options.Concurrency = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &LeaderboardIterator{
+		api:      api,
+		ctx:      ctx,
+		cancel:   cancel,
+		options:  options,
+		nextRank: options.Rank,
+	}
+}
+
+// Next fetches the next page, returning false once there are no more pages or
+// an error occurred
+func (it *LeaderboardIterator) Next() bool {
+	if it.done || it.err != nil {
+		return false
+	}
+
+	var result pageResult
+	switch {
+	case it.pageSize == 0:
+		result = it.fetch(it.nextRank)
+	case len(it.pending) > 0:
+		result = <-it.pending[0]
+		it.pending = it.pending[1:]
+	default:
+		it.stop()
+		return false
+	}
+	if result.err != nil {
+		it.err = result.err
+		it.stop()
+		return false
+	}
+	page := result.page
+	if len(page.Players) == 0 {
+		it.stop()
+		return false
+	}
+
+	if it.pageSize == 0 {
+		it.pageSize = len(page.Players)
+		it.total = int(page.GlobalPlayerCount)
+		it.dispatchRank = page.Rank + it.pageSize
+	}
+	it.page = page
+	it.nextRank = page.Rank + len(page.Players)
+	it.players += len(page.Players)
+	// with nothing pending the next page can start right after this one,
+	// even if it was short
+	if len(it.pending) == 0 {
+		it.dispatchRank = it.nextRank
+	}
+	it.dispatch()
+
+	if it.options.Progress != nil {
+		it.options.Progress(Progress{
+			NextRank: it.nextRank,
+			Players:  it.players,
+			Total:    it.total,
+		})
+	}
+	return true
+}
+
+// dispatch starts fetching pages until Concurrency pages are pending, or the
+// rest of the leaderboard is being fetched
+func (it *LeaderboardIterator) dispatch() {
+	for len(it.pending) < it.options.Concurrency {
+		// the leaderboard may have grown since the first page, so one
+		// page past the end is fetched to make sure it has ended
+		if it.total > 0 && it.dispatchRank > it.total+it.pageSize {
+			return
+		}
+		c := make(chan pageResult, 1)
+		rank := it.dispatchRank
+		go func() {
+			c <- it.fetch(rank)
+		}()
+		it.pending = append(it.pending, c)
+		it.dispatchRank += it.pageSize
+	}
+}
+
+func (it *LeaderboardIterator) fetch(rank int) pageResult {
+	ctx := it.ctx
+	if it.options.PageTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, it.options.PageTimeout)
+		defer cancel()
+	}
+	page, err := it.api.leaderboardPage(ctx, rank)
+	return pageResult{page: page, err: err}
+}
+
+// leaderboardPage returns the whole page of the leaderboard starting at the rank
+func (api *API) leaderboardPage(ctx context.Context, rank int) (*LeaderboardPage, error) {
+	leaderboard, err := api.GetLeaderboardContext(ctx, math.MaxUint16, rank)
+	if err != nil {
+		return nil, err
+	}
+	return &LeaderboardPage{Rank: rank, Leaderboard: leaderboard}, nil
+}
+
+func (it *LeaderboardIterator) stop() {
+	it.done = true
+	it.page = nil
+	it.pending = nil
+	it.cancel()
+}
+
+// Page returns the page fetched by the last call to Next
+func (it *LeaderboardIterator) Page() *LeaderboardPage {
+	return it.page
+}
+
+// Err returns the error which stopped the iterator, if any
+func (it *LeaderboardIterator) Err() error {
+	return it.err
+}
+
+// NextRank returns the rank the iterator continues from. Passing it as the
+// Rank of a new iterator resumes this one.
+func (it *LeaderboardIterator) NextRank() int {
+	return it.nextRank
+}
+
+// Close stops the iterator and cancels the pages being fetched
+func (it *LeaderboardIterator) Close() {
+	it.stop()
+}
@@ -0,0 +1,133 @@
+package ddapi_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
+	"github.com/alexwilkerson/ddstats-server/pkg/ddapi/ddapitest"
+)
+
+func newLeaderboardServer(n int) *ddapitest.Server {
+	var players []*ddapi.Player
+	for i := 1; i <= n; i++ {
+		players = append(players, &ddapi.Player{
+			PlayerID:      uint64(i),
+			PlayerName:    fmt.Sprintf("player%d", i),
+			Rank:          uint32(i),
+			GameTime:      1000 - float64(i)/10,
+			OverallDeaths: 1,
+		})
+	}
+	return ddapitest.NewServer(players...)
+}
+
+// iterate returns the ranks yielded by the iterator
+func iterate(t *testing.T, it *ddapi.LeaderboardIterator) []int {
+	var ranks []int
+	for it.Next() {
+		page := it.Page()
+		for i, player := range page.Players {
+			if int(player.Rank) != page.Rank+i {
+				t.Fatalf("got rank %d at position %d of the page starting at %d", player.Rank, i, page.Rank)
+			}
+			ranks = append(ranks, int(player.Rank))
+		}
+	}
+	return ranks
+}
+
+func checkRanks(t *testing.T, ranks []int, from, to int) {
+	if len(ranks) != to-from+1 {
+		t.Fatalf("got %d players; want %d", len(ranks), to-from+1)
+	}
+	for i, rank := range ranks {
+		if rank != from+i {
+			t.Fatalf("got rank %d at %d; want %d", rank, i, from+i)
+		}
+	}
+}
+
+func TestIterateLeaderboard(t *testing.T) {
+	s := newLeaderboardServer(1050)
+	defer s.Close()
+
+	for _, concurrency := range []int{1, 4} {
+		t.Run(fmt.Sprint(concurrency), func(t *testing.T) {
+			var progress []ddapi.Progress
+			it := s.API().IterateLeaderboard(context.Background(), ddapi.IteratorOptions{
+				Concurrency: concurrency,
+				Progress: func(p ddapi.Progress) {
+					progress = append(progress, p)
+				},
+			})
+			defer it.Close()
+			ranks := iterate(t, it)
+			if it.Err() != nil {
+				t.Fatal(it.Err())
+			}
+			checkRanks(t, ranks, 1, 1050)
+			if len(progress) != 11 {
+				t.Fatalf("got %d progress reports; want 11", len(progress))
+			}
+			want := ddapi.Progress{NextRank: 1051, Players: 1050, Total: 1050}
+			if last := progress[len(progress)-1]; last != want {
+				t.Errorf("got progress %+v; want %+v", last, want)
+			}
+			if it.NextRank() != 1051 {
+				t.Errorf("got next rank %d; want 1051", it.NextRank())
+			}
+		})
+	}
+}
+
+func TestIterateLeaderboardResume(t *testing.T) {
+	s := newLeaderboardServer(350)
+	defer s.Close()
+	api := s.API()
+
+	it := api.IterateLeaderboard(context.Background(), ddapi.IteratorOptions{})
+	if !it.Next() {
+		t.Fatal(it.Err())
+	}
+	s.FailNext(1, http.StatusInternalServerError)
+	if it.Next() {
+		t.Fatal("got a page from a failing server")
+	}
+	if !errors.Is(it.Err(), ddapi.ErrStatusCode) {
+		t.Fatalf("got error %v; want %v", it.Err(), ddapi.ErrStatusCode)
+	}
+	it.Close()
+
+	it = api.IterateLeaderboard(context.Background(), ddapi.IteratorOptions{Rank: it.NextRank(), Concurrency: 2})
+	defer it.Close()
+	ranks := iterate(t, it)
+	if it.Err() != nil {
+		t.Fatal(it.Err())
+	}
+	checkRanks(t, ranks, ddapitest.PageSize+1, 350)
+}
+
+func TestIterateLeaderboardCanceled(t *testing.T) {
+	s := newLeaderboardServer(500)
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	it := s.API().IterateLeaderboard(ctx, ddapi.IteratorOptions{Concurrency: 3})
+	defer it.Close()
+	if !it.Next() {
+		t.Fatal(it.Err())
+	}
+	cancel()
+	for it.Next() {
+	}
+	if it.NextRank() > 501 {
+		t.Errorf("got next rank %d", it.NextRank())
+	}
+	if it.Err() != nil && !errors.Is(it.Err(), context.Canceled) {
+		t.Errorf("got error %v; want %v", it.Err(), context.Canceled)
+	}
+}
@@ -0,0 +1,119 @@
+package ddapi
+
+import (
+	"context"
+	"errors"
+)
+
+const (
+	// MaxNeighborhoodRadius is the most ranks a neighborhood can include on
+	// either side of the player
+	MaxNeighborhoodRadius = 50
+	// neighborhoodPageSize aligns the leaderboard pages neighborhoods are
+	// built from, so that players near each other share cached pages
+	neighborhoodPageSize = 100
+)
+
+// ErrInvalidRadius is returned when a neighborhood radius is out of range
+var ErrInvalidRadius = errors.New("radius must be between 1 and 50")
+
+// Neighborhood is a player and the players ranked around them
+type Neighborhood struct {
+	Player  *Player     `json:"player"`
+	Players []*Neighbor `json:"players"`
+}
+
+// Neighbor is a player in a neighborhood. GameTimeGap is how far ahead of the
+// neighborhood's player they are, and is negative if they are behind.
+type Neighbor struct {
+	*Player
+	GameTimeGap float64 `json:"game_time_gap"`
+}
+
+// Neighborhood returns the player and the players up to radius ranks above and
+// below them, including the player
+func (api *API) Neighborhood(playerID, radius int) (*Neighborhood, error) {
+	return api.NeighborhoodContext(context.Background(), playerID, radius)
+}
+
+// NeighborhoodContext is Neighborhood, giving up when the context is done
+func (api *API) NeighborhoodContext(ctx context.Context, playerID, radius int) (*Neighborhood, error) {
+	if radius < 1 || radius > MaxNeighborhoodRadius {
+		return nil, ErrInvalidRadius
+	}
+	player, err := api.UserByIDContext(ctx, playerID)
+	if err != nil {
+		return nil, err
+	}
+	if player.Rank == 0 {
+		return nil, ErrPlayerNotFound
+	}
+
+	rank := int(player.Rank)
+	from := rank - radius
+	if from < 1 {
+		from = 1
+	}
+	players, err := api.leaderboardRange(ctx, from, rank+radius)
+	if err != nil {
+		return nil, err
+	}
+	// the page may be fresher than the player, or the other way around, so
+	// the player is taken from the page if they are on it
+	for _, p := range players {
+		if p.PlayerID == player.PlayerID {
+			player = p
+		}
+	}
+
+	neighborhood := &Neighborhood{Player: player, Players: []*Neighbor{}}
+	for _, p := range players {
+		neighborhood.Players = append(neighborhood.Players, &Neighbor{
+			Player:      p,
+			GameTimeGap: roundToNearest(p.GameTime-player.GameTime, 4),
+		})
+	}
+	return neighborhood, nil
+}
+
+// leaderboardRange returns the players ranked from from to to, inclusive
+func (api *API) leaderboardRange(ctx context.Context, from, to int) ([]*Player, error) {
+	var players []*Player
+	start := (from-1)/neighborhoodPageSize*neighborhoodPageSize + 1
+	for start <= to {
+		page, err := api.cachedPage(ctx, start)
+		if err != nil {
+			return nil, err
+		}
+		if len(page.Players) == 0 {
+			break
+		}
+		for i, p := range page.Players {
+			if rank := start + i; rank >= from && rank <= to {
+				players = append(players, copyPlayer(p, false))
+			}
+		}
+		start += len(page.Players)
+	}
+	return players, nil
+}
+
+// cachedPage returns the page of the leaderboard starting at the rank, cached
+// for CacheTTL. The page must not be modified.
+func (api *API) cachedPage(ctx context.Context, rank int) (*LeaderboardPage, error) {
+	key := cacheKey{EndpointGetScores, rank}
+	if api.CacheTTL > 0 {
+		entry, cached := api.cache.load(key)
+		if cached && api.cache.time().Sub(entry.fetched) < api.CacheTTL {
+			return entry.value.(*LeaderboardPage), nil
+		}
+	}
+	page, err := api.leaderboardPage(ctx, rank)
+	if err != nil {
+		return nil, err
+	}
+	if api.CacheTTL > 0 {
+		api.cache.store(key, page, api.CacheTTL+api.StaleTTL)
+	}
+	return page, nil
+}
@@ -0,0 +1,82 @@
+package ddapi_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
+)
+
+func TestNeighborhood(t *testing.T) {
+	s := newLeaderboardServer(250)
+	defer s.Close()
+	api := s.API()
+	api.CacheTTL = time.Minute
+
+	tests := []struct {
+		name     string
+		playerID int
+		radius   int
+		from, to int
+	}{
+		{"top", 2, 3, 1, 5},
+		{"middle", 50, 2, 48, 52},
+		{"across pages", 99, 5, 94, 104},
+		{"bottom", 249, 5, 244, 250},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := api.Neighborhood(tt.playerID, tt.radius)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int(n.Player.PlayerID) != tt.playerID {
+				t.Errorf("got player %d; want %d", n.Player.PlayerID, tt.playerID)
+			}
+			if len(n.Players) != tt.to-tt.from+1 {
+				t.Fatalf("got %d players; want %d", len(n.Players), tt.to-tt.from+1)
+			}
+			for i, neighbor := range n.Players {
+				if int(neighbor.Rank) != tt.from+i {
+					t.Fatalf("got rank %d at %d; want %d", neighbor.Rank, i, tt.from+i)
+				}
+				// players in the test leaderboard are a tenth of a
+				// second apart
+				want := float64(tt.playerID-int(neighbor.Rank)) / 10
+				if diff := neighbor.GameTimeGap - want; diff > 1e-9 || diff < -1e-9 {
+					t.Errorf("got gap %v for rank %d; want %v", neighbor.GameTimeGap, neighbor.Rank, want)
+				}
+			}
+		})
+	}
+
+	// every page and player is cached by now
+	requests := s.Requests()
+	_, err := api.Neighborhood(100, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Requests() - requests; n != 1 {
+		t.Errorf("got %d requests for a neighborhood on cached pages; want 1 for the player", n)
+	}
+}
+
+func TestNeighborhoodErrors(t *testing.T) {
+	s := newLeaderboardServer(10)
+	defer s.Close()
+	api := s.API()
+
+	_, err := api.Neighborhood(1, 0)
+	if !errors.Is(err, ddapi.ErrInvalidRadius) {
+		t.Errorf("got error %v; want %v", err, ddapi.ErrInvalidRadius)
+	}
+	_, err = api.Neighborhood(1, ddapi.MaxNeighborhoodRadius+1)
+	if !errors.Is(err, ddapi.ErrInvalidRadius) {
+		t.Errorf("got error %v; want %v", err, ddapi.ErrInvalidRadius)
+	}
+	_, err = api.Neighborhood(11, 5)
+	if !errors.Is(err, ddapi.ErrPlayerNotFound) {
+		t.Errorf("got error %v; want %v", err, ddapi.ErrPlayerNotFound)
+	}
+}
@@ -0,0 +1,162 @@
+package ddapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Recorder is an http.RoundTripper which saves the raw leaderboard pages the
+// DD API responds with to Dir, so that they can be replayed by a Replayer.
+// Only the leaderboard is recorded, since it is all the collector reads.
+type Recorder struct {
+	Dir string
+	// Transport makes the requests, http.DefaultTransport if nil
+	Transport http.RoundTripper
+}
+
+// RoundTrip makes the request and records the response if it is a page of the
+// leaderboard
+func (rec *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := rec.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	name, _, body, err := recordingName(req)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		// the request's body was read to find its name, so it is sent with
+		// a copy
+		req = req.Clone(req.Context())
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil || name == "" || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	page, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	err = writeFileAtomic(filepath.Join(rec.Dir, name), page)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(page))
+	return resp, nil
+}
+
+// Replayer is an http.RoundTripper which serves the leaderboard pages saved by
+// a Recorder in Dir, without making any requests. Anything which wasn't
+// recorded is not found.
+type Replayer struct {
+	Dir string
+}
+
+// RoundTrip responds with the recorded page of the leaderboard
+func (rep *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	name, offset, _, err := recordingName(req)
+	if err != nil {
+		return nil, err
+	}
+	status := http.StatusOK
+	var page []byte
+	if name != "" {
+		page, err = ioutil.ReadFile(filepath.Join(rep.Dir, name))
+		if os.IsNotExist(err) {
+			page, err = rep.pastTheEnd(offset)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if page == nil {
+		status = http.StatusNotFound
+		page = []byte(http.StatusText(status))
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/octet-stream"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(page)),
+		ContentLength: int64(len(page)),
+		Request:       req,
+	}, nil
+}
+
+// pastTheEnd returns the empty page the DD API responds with for an offset
+// past the end of the recorded leaderboard, or nil if the offset isn't past
+// the end. The offsets requested after the last page depend on how many pages
+// are fetched at once, so they may not have been recorded.
+func (rep *Replayer) pastTheEnd(offset int) ([]byte, error) {
+	first, err := ioutil.ReadFile(filepath.Join(rep.Dir, recordingFile(0)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	err = checkLength(first, "leaderboard header", 0, leaderboardHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+	if offset < int(toUint32(first, 75)) {
+		return nil, nil
+	}
+	// the header of the first page, with no players
+	page := make([]byte, leaderboardHeaderSize)
+	copy(page, first)
+	binary.LittleEndian.PutUint16(page[59:], 0)
+	return page, nil
+}
+
+// recordingName returns the name of the file a leaderboard request is recorded
+// in, which is empty for any other request, the offset requested and the
+// request's body if it was read
+func recordingName(req *http.Request) (string, int, []byte, error) {
+	if !strings.HasSuffix(req.URL.Path, EndpointGetScores) || req.Body == nil {
+		return "", 0, nil, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", 0, nil, err
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return "", 0, body, err
+	}
+	offset, err := strconv.Atoi(form.Get("offset"))
+	if err != nil || offset < 0 {
+		return "", 0, body, fmt.Errorf("invalid leaderboard offset %q", form.Get("offset"))
+	}
+	return recordingFile(offset), offset, body, nil
+}
+
+func recordingFile(offset int) string {
+	return fmt.Sprintf("scores_%d.bin", offset)
+}
+
+// writeFileAtomic writes the file under a temporary name and renames it, so
+// that an interrupted recording doesn't leave half a page behind
+func writeFileAtomic(name string, data []byte) error {
+	tmp := name + ".tmp"
+	err := ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
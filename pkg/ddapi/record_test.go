@@ -0,0 +1,75 @@
+package ddapi_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	srv := newLeaderboardServer(250)
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "ddapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	recording := srv.API()
+	recording.Client = &http.Client{Transport: &ddapi.Recorder{Dir: dir, Transport: srv.Client().Transport}}
+	it := recording.IterateLeaderboard(context.Background(), ddapi.IteratorOptions{Concurrency: 2})
+	recorded := iterate(t, it)
+	it.Close()
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	// the user lookups aren't recorded
+	_, err = recording.UserByID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the page past the end is recorded too
+	if len(files) != 4 {
+		t.Errorf("recorded %v; want 4 pages", files)
+	}
+
+	srv.Close()
+	replaying := &ddapi.API{Client: &http.Client{Transport: &ddapi.Replayer{Dir: dir}}}
+	// fetching one page at a time asks for a different page past the end
+	it = replaying.IterateLeaderboard(context.Background(), ddapi.IteratorOptions{})
+	replayed := iterate(t, it)
+	it.Close()
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(replayed, recorded) {
+		t.Errorf("replayed %d players; want the %d recorded", len(replayed), len(recorded))
+	}
+
+	leaderboard, err := replaying.GetLeaderboard(100, 1001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaderboard.Players) != 0 || leaderboard.GlobalPlayerCount != 250 {
+		t.Errorf("replayed %d players of %d past the end; want 0 of 250", len(leaderboard.Players), leaderboard.GlobalPlayerCount)
+	}
+	_, err = replaying.GetLeaderboard(100, 151)
+	if !errors.Is(err, ddapi.ErrStatusCode) {
+		t.Errorf("replaying a page which wasn't recorded returned %v; want %v", err, ddapi.ErrStatusCode)
+	}
+	_, err = replaying.UserByID(1)
+	if !errors.Is(err, ddapi.ErrStatusCode) {
+		t.Errorf("replaying a user lookup returned %v; want %v", err, ddapi.ErrStatusCode)
+	}
+}
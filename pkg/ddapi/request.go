@@ -0,0 +1,266 @@
+package ddapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// retryBaseDelay is the delay before the first retry, which doubles for
+	// every retry after it up to retryMaxDelay. The delays are jittered
+	// between half and all of their length.
+	retryBaseDelay = 100 * time.Millisecond
+	retryMaxDelay  = 2 * time.Second
+)
+
+// StatusError is returned when the DD API responds with a status other than
+// 200 OK. It matches ErrStatusCode with errors.Is.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%v: %d %s", ErrStatusCode, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Is reports whether target is ErrStatusCode
+func (e *StatusError) Is(target error) bool {
+	return target == ErrStatusCode
+}
+
+// NetworkError is returned when a request to the DD API fails before a
+// response is read, or while it is being read. It matches ErrNetwork with
+// errors.Is and unwraps to the error from the http client.
+type NetworkError struct {
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrNetwork, e.Err)
+}
+
+// Is reports whether target is ErrNetwork
+func (e *NetworkError) Is(target error) bool {
+	return target == ErrNetwork
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports whether the request timed out
+func (e *NetworkError) Timeout() bool {
+	var netErr net.Error
+	return errors.As(e.Err, &netErr) && netErr.Timeout()
+}
+
+// retryable reports whether a request which failed with err should be retried
+func retryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	var networkErr *NetworkError
+	return errors.As(err, &networkErr) && networkErr.Timeout()
+}
+
+// backoff returns how long to wait before the retry after attempt
+func backoff(attempt int) time.Duration {
+	d := retryMaxDelay
+	if attempt < 16 && retryBaseDelay<<uint(attempt) < retryMaxDelay {
+		d = retryBaseDelay << uint(attempt)
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// sleep waits for d, returning early with the context's error if it is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// post sends the form to the endpoint and returns the body of the response.
+// Identical requests which are made while one is in flight share its response,
+// which must not be modified. Every lookup is idempotent, so failed requests
+// are retried up to MaxRetries times.
+func (api *API) post(ctx context.Context, endpoint string, form url.Values) ([]byte, error) {
+	key := endpoint + "?" + form.Encode()
+	for {
+		body, err, canceled := api.requests.do(ctx, key, func() ([]byte, error) {
+			return api.postWithRetries(ctx, endpoint, form)
+		})
+		// the request in flight was given up on by whoever made it, so
+		// this one is made again if its own caller is still waiting
+		if canceled && ctx.Err() == nil {
+			continue
+		}
+		return body, err
+	}
+}
+
+func (api *API) postWithRetries(ctx context.Context, endpoint string, form url.Values) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		body, err := api.postOnce(ctx, endpoint, form)
+		if err == nil || attempt >= api.MaxRetries || !retryable(err) {
+			return body, err
+		}
+		err = sleep(ctx, backoff(attempt))
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// postOnce sends the request, after waiting for the rate limiter if the API
+// has one
+func (api *API) postOnce(ctx context.Context, endpoint string, form url.Values) ([]byte, error) {
+	if api.limiter != nil {
+		err := api.limiter.wait(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, api.url(endpoint), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := api.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &NetworkError{Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &NetworkError{Err: err}
+	}
+	return body, nil
+}
+
+// requestGroup coalesces identical requests which are in flight at the same
+// time into one. The zero value is ready to use.
+type requestGroup struct {
+	sync.Mutex
+	requests map[string]*request
+}
+
+type request struct {
+	done     chan struct{}
+	body     []byte
+	err      error
+	canceled bool
+}
+
+// do calls fn and returns its result, unless a call with the same key is
+// already in flight, in which case it waits for that call and returns its
+// result instead. canceled is set if the context of the caller which made the
+// call was done by the time it returned. Callers stop waiting when their own
+// context is done.
+func (g *requestGroup) do(ctx context.Context, key string, fn func() ([]byte, error)) (body []byte, err error, canceled bool) {
+	g.Lock()
+	if g.requests == nil {
+		g.requests = make(map[string]*request)
+	}
+	if r, ok := g.requests[key]; ok {
+		g.Unlock()
+		select {
+		case <-r.done:
+			return r.body, r.err, r.canceled
+		case <-ctx.Done():
+			return nil, ctx.Err(), false
+		}
+	}
+	r := &request{done: make(chan struct{})}
+	g.requests[key] = r
+	g.Unlock()
+
+	r.body, r.err = fn()
+	r.canceled = ctx.Err() != nil
+
+	g.Lock()
+	delete(g.requests, key)
+	g.Unlock()
+	close(r.done)
+	return r.body, r.err, r.canceled
+}
+
+// rateLimiter is a token bucket shared by every request the API makes, which
+// refills at rate tokens per second up to burst tokens
+type rateLimiter struct {
+	sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate, burst float64) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+	}
+}
+
+// reserve takes a token from the bucket and returns how long to wait until the
+// token is available. Tokens can be borrowed, so that waiting requests are
+// allowed in the order they were made.
+func (rl *rateLimiter) reserve(now time.Time) time.Duration {
+	rl.Lock()
+	defer rl.Unlock()
+	if !rl.last.IsZero() {
+		rl.tokens += now.Sub(rl.last).Seconds() * rl.rate
+		if rl.tokens > rl.burst {
+			rl.tokens = rl.burst
+		}
+	}
+	rl.last = now
+	rl.tokens--
+	if rl.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-rl.tokens / rl.rate * float64(time.Second))
+}
+
+// wait blocks until a request is allowed or the context is done
+func (rl *rateLimiter) wait(ctx context.Context) error {
+	if d := rl.reserve(time.Now()); d > 0 {
+		return sleep(ctx, d)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package ddapi_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
+	"github.com/alexwilkerson/ddstats-server/pkg/ddapi/ddapitest"
+)
+
+func newFlakyServer() (*ddapitest.Server, *ddapi.API) {
+	s := ddapitest.NewServer(&ddapi.Player{PlayerID: 21854, PlayerName: "xvlv", Rank: 3})
+	api := s.API()
+	api.MaxRetries = 3
+	return s, api
+}
+
+func TestRetryServerErrors(t *testing.T) {
+	s, api := newFlakyServer()
+	defer s.Close()
+
+	s.FailNext(2, http.StatusBadGateway)
+	player, err := api.UserByID(21854)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if player.PlayerName != "xvlv" {
+		t.Errorf("got %+v", player)
+	}
+	if n := s.Requests(); n != 3 {
+		t.Errorf("got %d requests; want 3", n)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	s, api := newFlakyServer()
+	defer s.Close()
+
+	s.FailNext(10, http.StatusServiceUnavailable)
+	_, err := api.GetLeaderboard(10, 1)
+	if !errors.Is(err, ddapi.ErrStatusCode) {
+		t.Fatalf("got error %v; want %v", err, ddapi.ErrStatusCode)
+	}
+	var statusErr *ddapi.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("got error %v; want status %d", err, http.StatusServiceUnavailable)
+	}
+	if n := s.Requests(); n != 4 {
+		t.Errorf("got %d requests; want 4", n)
+	}
+}
+
+func TestNoRetryClientErrors(t *testing.T) {
+	s, api := newFlakyServer()
+	defer s.Close()
+
+	s.FailNext(1, http.StatusBadRequest)
+	_, err := api.UserSearch("xvlv")
+	if !errors.Is(err, ddapi.ErrStatusCode) {
+		t.Fatalf("got error %v; want %v", err, ddapi.ErrStatusCode)
+	}
+	if n := s.Requests(); n != 1 {
+		t.Errorf("got %d requests; want 1", n)
+	}
+}
+
+func TestRetryTimeouts(t *testing.T) {
+	s, api := newFlakyServer()
+	defer s.Close()
+	api.Client.Timeout = 50 * time.Millisecond
+
+	s.SetLatency(300 * time.Millisecond)
+	_, err := api.UserByRank(3)
+	if !errors.Is(err, ddapi.ErrNetwork) {
+		t.Fatalf("got error %v; want %v", err, ddapi.ErrNetwork)
+	}
+	if n := s.Requests(); n != 4 {
+		t.Errorf("got %d requests; want 4", n)
+	}
+}
+
+func TestContextCanceled(t *testing.T) {
+	s, api := newFlakyServer()
+	defer s.Close()
+
+	s.SetLatency(300 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := api.UserByIDContext(ctx, 21854)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v; want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("took %v to give up", elapsed)
+	}
+	if n := s.Requests(); n != 1 {
+		t.Errorf("got %d requests; want 1", n)
+	}
+}
+
+func TestNetworkErrorClass(t *testing.T) {
+	s, api := newFlakyServer()
+	s.Close()
+
+	_, err := api.UserByID(21854)
+	if !errors.Is(err, ddapi.ErrNetwork) {
+		t.Fatalf("got error %v; want %v", err, ddapi.ErrNetwork)
+	}
+	if errors.Is(err, ddapi.ErrStatusCode) || errors.Is(err, ddapi.ErrDecode) {
+		t.Errorf("got error %v in more than one class", err)
+	}
+}
@@ -47,6 +47,8 @@ func (d *Discord) registerCommands() {
 	d.commandHelp()
 	d.commandMe()
 	d.commandRegister()
+	d.commandNotify()
+	d.commandAround()
 }
 
 func fieldsFromPlayer(player *ddapi.Player) []*discordgo.MessageEmbedField {
@@ -0,0 +1,82 @@
+package discord
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const aroundRadius = 5
+
+func (d *Discord) commandAround() {
+	command := Command{
+		name:        "around",
+		cooldown:    5 * time.Second,
+		description: fmt.Sprintf("Show who is ranked just above and below a player on the Devil Daggers leaderboard. Without a player ID, shows the players around you if you have used %sregister.", prefix),
+		usage:       "[player id]",
+		aliases:     []string{"neighbors", "neighbours"},
+		getEmbed: func(m *discordgo.MessageCreate, args ...string) *discordgo.MessageEmbed {
+			var id int
+			if len(args) == 0 {
+				discordUser, err := d.DB.DiscordUsers.Select(m.Author.ID)
+				if err != nil {
+					if errors.Is(err, models.ErrNoDiscordUserFound) {
+						return errorEmbed(fmt.Sprintf("Include a Player ID, or register with `%sregister [player id]` first. %s", prefix, m.Author.Mention()))
+					}
+					d.errorLog.Printf("%v", err)
+					return errorEmbed(fmt.Sprintf("Database error while trying to retrieve user ID %q. %s", m.Author.ID, m.Author.Mention()))
+				}
+				id = discordUser.DDID
+			} else {
+				var err error
+				id, err = strconv.Atoi(args[0])
+				if err != nil {
+					return errorEmbed(fmt.Sprintf("Player ID must be an integer. %s", m.Author.Mention()))
+				}
+			}
+			neighborhood, err := d.ddAPI.Neighborhood(id, aroundRadius)
+			if err != nil {
+				if errors.Is(err, ddapi.ErrStatusCode) || errors.Is(err, ddapi.ErrNetwork) {
+					d.errorLog.Printf("%v", err)
+					return errorEmbed(fmt.Sprintf("Unable to access the Devil Daggers API. %s", m.Author.Mention()))
+				}
+				if errors.Is(err, ddapi.ErrPlayerNotFound) {
+					return errorEmbed(fmt.Sprintf("No players were found for Player ID %d. %s", id, m.Author.Mention()))
+				}
+				d.errorLog.Printf("%v", err)
+				return errorEmbed(fmt.Sprintf("Some error occurred while calling !around. %s", m.Author.Mention()))
+			}
+			return &discordgo.MessageEmbed{
+				Title:       fmt.Sprintf("Around %s (%d)", neighborhood.Player.PlayerName, neighborhood.Player.PlayerID),
+				Description: describeNeighborhood(neighborhood),
+				Color:       defaultColor,
+				Footer: &discordgo.MessageEmbedFooter{
+					Text:    "ddstats.com",
+					IconURL: iconURL,
+				},
+			}
+		},
+	}
+	command.register(d)
+}
+
+// describeNeighborhood lists the players in the neighborhood, with the gap
+// between each of them and the neighborhood's player
+func describeNeighborhood(neighborhood *ddapi.Neighborhood) string {
+	var b strings.Builder
+	for _, neighbor := range neighborhood.Players {
+		if neighbor.PlayerID == neighborhood.Player.PlayerID {
+			fmt.Fprintf(&b, "**`#%d` %s %.4fs**\n", neighbor.Rank, neighbor.PlayerName, neighbor.GameTime)
+			continue
+		}
+		fmt.Fprintf(&b, "`#%d` %s %.4fs (%+.4fs)\n", neighbor.Rank, neighbor.PlayerName, neighbor.GameTime, neighbor.GameTimeGap)
+	}
+	return b.String()
+}
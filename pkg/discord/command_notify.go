@@ -0,0 +1,120 @@
+package discord
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func (d *Discord) commandNotify() {
+	command := Command{
+		name:        "notify",
+		cooldown:    5 * time.Second,
+		description: fmt.Sprintf("Shows or sets the game times at which your live runs are announced. You must use %sregister [player id] first. Give a spawnset name to set a rule for that spawnset only, or `reset` to go back to the default of %g seconds.", prefix, models.DefaultNotificationMilestone),
+		usage:       "[reset | [spawnset] [milestones...] [daggers on|off]]",
+		getEmbed: func(m *discordgo.MessageCreate, args ...string) *discordgo.MessageEmbed {
+			discordUser, err := d.DB.DiscordUsers.Select(m.Author.ID)
+			if err != nil {
+				if errors.Is(err, models.ErrNoDiscordUserFound) {
+					return errorEmbed(fmt.Sprintf("In order to use the `%snotify` command, you must first register using `%sregister [player id]`. %s", prefix, prefix, m.Author.Mention()))
+				}
+				d.errorLog.Printf("%v", err)
+				return errorEmbed(fmt.Sprintf("Database error while trying to retrieve user ID %q. %s", m.Author.ID, m.Author.Mention()))
+			}
+			preferences, err := d.DB.NotificationRules.Select(discordUser.DDID)
+			if err != nil {
+				d.errorLog.Printf("%v", err)
+				return errorEmbed(fmt.Sprintf("Database error while trying to retrieve your notifications. %s", m.Author.Mention()))
+			}
+
+			if len(args) > 0 {
+				if len(args) == 1 && args[0] == "reset" {
+					preferences.Rules = nil
+				} else {
+					spawnset, milestones, daggers, err := parseNotifyArgs(args)
+					if err != nil {
+						return errorEmbed(fmt.Sprintf("%s. %s", err, m.Author.Mention()))
+					}
+					setNotificationRule(preferences, spawnset, milestones, daggers)
+				}
+				err = preferences.Validate()
+				if err != nil {
+					return errorEmbed(fmt.Sprintf("%s. %s", err, m.Author.Mention()))
+				}
+				err = d.DB.NotificationRules.Replace(preferences)
+				if err != nil {
+					d.errorLog.Printf("%v", err)
+					return errorEmbed(fmt.Sprintf("Database error while trying to save your notifications. %s", m.Author.Mention()))
+				}
+			}
+
+			return &discordgo.MessageEmbed{
+				Title:       "Notifications",
+				Description: fmt.Sprintf("Live runs of Player ID `%d` are announced at:\n%s\n%s", discordUser.DDID, describeNotificationRules(preferences), m.Author.Mention()),
+				Color:       defaultColor,
+				Footer: &discordgo.MessageEmbedFooter{
+					Text:    "ddstats.com",
+					IconURL: iconURL,
+				},
+			}
+		},
+	}
+	command.register(d)
+}
+
+// setNotificationRule updates the rule for the spawnset, creating it if it
+// doesn't exist. The milestones are only replaced if any were given.
+func setNotificationRule(preferences *models.NotificationPreferences, spawnset string, milestones []float64, daggers *bool) {
+	var rule *models.NotificationRule
+	for _, r := range preferences.Rules {
+		if strings.EqualFold(r.Spawnset, spawnset) {
+			rule = r
+			break
+		}
+	}
+	if rule == nil {
+		rule = &models.NotificationRule{
+			PlayerID:   preferences.PlayerID,
+			Spawnset:   spawnset,
+			Milestones: []float64{models.DefaultNotificationMilestone},
+		}
+		preferences.Rules = append(preferences.Rules, rule)
+	}
+	if len(milestones) > 0 {
+		rule.Milestones = milestones
+	}
+	if daggers != nil {
+		rule.DaggerTiers = *daggers
+	}
+}
+
+func describeNotificationRules(preferences *models.NotificationPreferences) string {
+	if len(preferences.Rules) == 0 {
+		return fmt.Sprintf("`%gs` (default)", models.DefaultNotificationMilestone)
+	}
+	var lines []string
+	for _, rule := range preferences.Rules {
+		name := rule.Spawnset
+		if name == "" {
+			name = "any spawnset"
+		}
+		milestones := make([]string, 0, len(rule.Milestones)+1)
+		for _, milestone := range rule.Milestones {
+			milestones = append(milestones, strconv.FormatFloat(milestone, 'f', -1, 64)+"s")
+		}
+		if rule.DaggerTiers {
+			milestones = append(milestones, "dagger times")
+		}
+		if len(milestones) == 0 {
+			milestones = append(milestones, "never")
+		}
+		lines = append(lines, fmt.Sprintf("%s: `%s`", name, strings.Join(milestones, ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -20,10 +20,10 @@ func (d *Discord) commandTop() {
 			leaderboard, err := d.ddAPI.GetLeaderboard(10, 0)
 			if err != nil {
 				if errors.Is(err, ddapi.ErrStatusCode) {
-					d.errorLog.Printf("%w", err)
+					d.errorLog.Printf("%v", err)
 					return errorEmbed(fmt.Sprintf("Unable to access the Devil Daggers API. %s", m.Author.Mention()))
 				}
-				d.errorLog.Printf("%w", err)
+				d.errorLog.Printf("%v", err)
 				return nil
 			}
 			// fields := make([]*discordgo.MessageEmbedField, 10)
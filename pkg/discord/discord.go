@@ -5,6 +5,7 @@ import (
 	"log"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/alexwilkerson/ddstats-server/pkg/models/postgres"
 
@@ -18,6 +19,12 @@ import (
 const (
 	ddstatsChannelName = "ddstats"
 	prefix             = "."
+	// anomalyPollInterval is how often the anomalies flagged by the collector
+	// are checked for, since the collector runs as a separate process
+	anomalyPollInterval = time.Minute
+	// maxAnomalyAnnouncements is how many anomalies are announced at a time,
+	// so that a run which flags a lot of them doesn't flood the channels
+	maxAnomalyAnnouncements = 5
 )
 
 type Discord struct {
@@ -68,6 +75,7 @@ func (d *Discord) Start() error {
 		return err
 	}
 	go d.listenForNotifications()
+	go d.listenForAnomalies()
 	return nil
 }
 
@@ -97,9 +105,13 @@ func (d *Discord) listenForNotifications() {
 					}
 				}()
 			case *websocket.PlayerAboveThreshold:
+				title := fmt.Sprintf("%s is above %g!", v.PlayerName, v.GameTime)
+				if v.Dagger != "" {
+					title = fmt.Sprintf("%s reached the %s dagger at %gs!", v.PlayerName, v.Dagger, v.GameTime)
+				}
 				go func() {
 					err := d.broadcast(&discordgo.MessageEmbed{
-						Title:       fmt.Sprintf("%s is above 1000!", v.PlayerName),
+						Title:       title,
 						Description: fmt.Sprintf("Watch on [DDStats](https://ddstats.com/players/%d) or [DDLive](https://ddstats.live/#x3y1&ppid=%[1]d)", v.PlayerID),
 					})
 					if err != nil {
@@ -135,6 +147,45 @@ func (d *Discord) listenForNotifications() {
 	}
 }
 
+// listenForAnomalies announces the anomalies flagged by the collector as they
+// are found
+func (d *Discord) listenForAnomalies() {
+	ticker := time.NewTicker(anomalyPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := d.announceAnomalies()
+			if err != nil {
+				d.errorLog.Printf("%+v", err)
+			}
+		case <-d.quit:
+			return
+		}
+	}
+}
+
+// announceAnomalies broadcasts the anomalies which haven't been announced.
+// Anomalies are claimed before they are broadcast, so they aren't announced
+// twice even if broadcasting fails. A failed broadcast is logged and the rest
+// of the batch is still announced.
+func (d *Discord) announceAnomalies() error {
+	anomalies, err := d.DB.CollectorAnomalies.ClaimUnannounced(maxAnomalyAnnouncements)
+	if err != nil {
+		return err
+	}
+	for _, anomaly := range anomalies {
+		err := d.broadcast(&discordgo.MessageEmbed{
+			Title:       fmt.Sprintf("%s's score of %.4fs was flagged for review", anomaly.CollectorPlayerName, anomaly.GameTime),
+			Description: fmt.Sprintf("%s\nPlayer on [DDStats](https://ddstats.com/players/%d)", anomaly.Detail, anomaly.CollectorPlayerID),
+		})
+		if err != nil {
+			d.errorLog.Printf("announcing anomaly %d: %v", anomaly.ID, err)
+		}
+	}
+	return nil
+}
+
 func (d *Discord) broadcast(embed *discordgo.MessageEmbed) error {
 	embed.Color = defaultColor
 	embed.Footer = &discordgo.MessageEmbedFooter{
@@ -1,5 +1,11 @@
 package discord
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 func startsWith(source, pattern string) bool {
 	if len(source) < len(pattern) || len(source) < 1 {
 		return false
@@ -9,3 +15,35 @@ func startsWith(source, pattern string) bool {
 	}
 	return true
 }
+
+// parseNotifyArgs parses the arguments of the notify command, which take the
+// form [spawnset name] [milestones...] [daggers on|off]. The spawnset is empty
+// for the player's default rule, and daggers is nil if it wasn't given.
+func parseNotifyArgs(args []string) (spawnset string, milestones []float64, daggers *bool, err error) {
+	if n := len(args); n >= 2 && args[n-2] == "daggers" {
+		var on bool
+		switch args[n-1] {
+		case "on":
+			on = true
+		case "off":
+			on = false
+		default:
+			return "", nil, nil, fmt.Errorf("daggers must be followed by on or off")
+		}
+		daggers = &on
+		args = args[:n-2]
+	}
+	var name []string
+	for _, arg := range args {
+		milestone, parseErr := strconv.ParseFloat(arg, 64)
+		if parseErr != nil {
+			if len(milestones) > 0 {
+				return "", nil, nil, fmt.Errorf("the spawnset name must come before the milestones")
+			}
+			name = append(name, arg)
+			continue
+		}
+		milestones = append(milestones, milestone)
+	}
+	return strings.Join(name, " "), milestones, daggers, nil
+}
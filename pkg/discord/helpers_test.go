@@ -1,7 +1,11 @@
 package discord
 
 import (
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
 )
 
 func TestStartsWith(t *testing.T) {
@@ -27,3 +31,57 @@ func TestStartsWith(t *testing.T) {
 		})
 	}
 }
+
+func TestParseNotifyArgs(t *testing.T) {
+	on, off := true, false
+	tests := []struct {
+		args           string
+		wantSpawnset   string
+		wantMilestones []float64
+		wantDaggers    *bool
+		wantErr        bool
+	}{
+		{"500 1000", "", []float64{500, 1000}, nil, false},
+		{"pacifist 100", "pacifist", []float64{100}, nil, false},
+		{"level one 200 300 daggers on", "level one", []float64{200, 300}, &on, false},
+		{"daggers off", "", nil, &off, false},
+		{"500 pacifist", "", nil, nil, true},
+		{"daggers maybe", "", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			spawnset, milestones, daggers, err := parseNotifyArgs(strings.Fields(tt.args))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v; want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if spawnset != tt.wantSpawnset {
+				t.Errorf("got spawnset %q; want %q", spawnset, tt.wantSpawnset)
+			}
+			if !reflect.DeepEqual(milestones, tt.wantMilestones) {
+				t.Errorf("got milestones %v; want %v", milestones, tt.wantMilestones)
+			}
+			if (daggers == nil) != (tt.wantDaggers == nil) || (daggers != nil && *daggers != *tt.wantDaggers) {
+				t.Errorf("got daggers %v; want %v", daggers, tt.wantDaggers)
+			}
+		})
+	}
+}
+
+func TestDescribeNeighborhood(t *testing.T) {
+	player := &ddapi.Player{PlayerID: 2, PlayerName: "xvlv", Rank: 2, GameTime: 1100}
+	neighborhood := &ddapi.Neighborhood{
+		Player: player,
+		Players: []*ddapi.Neighbor{
+			{Player: &ddapi.Player{PlayerID: 1, PlayerName: "bintr", Rank: 1, GameTime: 1200.5}, GameTimeGap: 100.5},
+			{Player: player},
+			{Player: &ddapi.Player{PlayerID: 3, PlayerName: "cookie", Rank: 3, GameTime: 1000}, GameTimeGap: -100},
+		},
+	}
+	want := "`#1` bintr 1200.5000s (+100.5000s)\n**`#2` xvlv 1100.0000s**\n`#3` cookie 1000.0000s (-100.0000s)\n"
+	if got := describeNeighborhood(neighborhood); got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,362 @@
+// Package live owns the players connected to the server through the ddstats
+// client, no matter which transport they are connected with. It computes
+// their status, records their play sessions, recovers their unsubmitted games
+// and decides which notifications their runs trigger. Transports such as
+// socket.io are thin adapters which translate their events into calls to a
+// Service.
+package live
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+	"github.com/alexwilkerson/ddstats-server/pkg/models/postgres"
+	"github.com/alexwilkerson/ddstats-server/pkg/websocket"
+)
+
+const (
+	StatusLoggedIn        = "Logged In"
+	StatusNotConnected    = "Not Connected"
+	StatusConnecting      = "Connecting"
+	StatusAlive           = "Alive"
+	StatusWatchingAReplay = "Watching A Replay"
+	StatusInMainMenu      = "In Main Menu"
+	StatusInDaggerLobby   = "In Dagger Lobby"
+	StatusDead            = "Dead"
+)
+
+var (
+	ErrInvalidPlayerID = errors.New("invalid player ID")
+	ErrNotLoggedIn     = errors.New("connection is not logged in")
+	ErrAlreadyLoggedIn = errors.New("connection is already logged in as another player")
+	ErrPlayerMismatch  = errors.New("player ID does not match the logged in player")
+	ErrRateLimited     = errors.New("update rate limit exceeded")
+)
+
+// staleSweepInterval is how often play sessions left open by instances which
+// have crashed or been restarted are ended
+const staleSweepInterval = websocket.PresenceTTL
+
+// Service keeps track of every live player, keyed by the ID of the
+// connection they logged in with
+type Service struct {
+	infoLog      *log.Logger
+	errorLog     *log.Logger
+	websocketHub *websocket.Hub
+	ddAPI        *ddapi.API
+	db           *postgres.Postgres
+	players      *sync.Map
+	quit         chan struct{}
+}
+
+type gameSubmitted struct {
+	PlayerID int `json:"player_id"`
+	GameID   int `json:"game_id"`
+}
+
+// NewService returns a Service which broadcasts to the websocket hub
+func NewService(infoLog, errorLog *log.Logger, websocketHub *websocket.Hub, ddAPI *ddapi.API, db *postgres.Postgres) *Service {
+	return &Service{
+		infoLog:      infoLog,
+		errorLog:     errorLog,
+		websocketHub: websocketHub,
+		ddAPI:        ddAPI,
+		db:           db,
+		players:      &sync.Map{},
+		quit:         make(chan struct{}),
+	}
+}
+
+// Start is intended to be run in a go routine, and ends the stale play
+// sessions once every staleSweepInterval until the service is closed. A
+// session is stale once its connection hasn't been seen in the live table for
+// websocket.PresenceTTL, since every instance refreshes the rows of the
+// players connected to it.
+func (svc *Service) Start() {
+	ticker := time.NewTicker(staleSweepInterval)
+	defer ticker.Stop()
+	for {
+		svc.endStalePlaySessions()
+		select {
+		case <-ticker.C:
+		case <-svc.quit:
+			return
+		}
+	}
+}
+
+// Close stops the service's sweep
+func (svc *Service) Close() {
+	close(svc.quit)
+}
+
+func (svc *Service) endStalePlaySessions() {
+	ended, err := svc.db.PlaySessions.EndStale(websocket.PresenceTTL)
+	if err != nil {
+		svc.errorLog.Printf("live end stale play sessions: %v", err)
+		return
+	}
+	if ended > 0 {
+		svc.infoLog.Printf("Ended %d stale play sessions", ended)
+	}
+}
+
+func (svc *Service) player(sid string) (*player, error) {
+	v, ok := svc.players.Load(sid)
+	if !ok {
+		return nil, ErrNotLoggedIn
+	}
+	return v.(*player), nil
+}
+
+// Login logs the connection in as the player. Logging in again as the same
+// player does nothing, and the transport should close the connection if an
+// error is returned.
+func (svc *Service) Login(sid string, playerID int) error {
+	start := time.Now()
+	// -1 is sent when there is an error in the client
+	if playerID < 1 {
+		return ErrInvalidPlayerID
+	}
+
+	if player, err := svc.player(sid); err == nil {
+		player.Lock()
+		loggedInAs := player.PlayerID
+		player.Unlock()
+		if loggedInAs != playerID {
+			return ErrAlreadyLoggedIn
+		}
+		return nil
+	}
+
+	p, err := svc.ddAPI.UserByID(playerID)
+	if err != nil {
+		return err
+	}
+
+	newPlayer := newPlayer(sid, p)
+	svc.players.Store(sid, newPlayer)
+
+	err = svc.db.Players.UpsertDDPlayer(p)
+	if err != nil {
+		return err
+	}
+
+	playSessionID, err := svc.db.PlaySessions.Start(int(p.PlayerID), sid)
+	if err != nil {
+		svc.errorLog.Printf("live login: %v", err)
+	} else {
+		newPlayer.Lock()
+		newPlayer.playSession = &playSession{id: playSessionID, event: models.PlaySessionLogin}
+		newPlayer.Unlock()
+	}
+
+	svc.websocketHub.RegisterPlayer <- newPlayer.websocketPlayer
+
+	svc.broadcast(newPlayer.PlayerID, "submit", struct{}{})
+
+	svc.infoLog.Println(playerID)
+	svc.infoLog.Println("duration:", time.Since(start))
+	return nil
+}
+
+// Logout removes the connection's player. The recovery of their last run is
+// left pending, since a client which crashes is logged out too.
+func (svc *Service) Logout(sid string) error {
+	player, err := svc.player(sid)
+	if err != nil {
+		return err
+	}
+	player.Lock()
+	defer player.Unlock()
+	svc.broadcast(player.PlayerID, "submit", struct{}{})
+	svc.players.Delete(sid)
+	svc.websocketHub.UnregisterPlayer <- player.websocketPlayer
+	if player.playSession != nil {
+		err = svc.db.PlaySessions.End(player.playSession.id)
+		if err != nil {
+			svc.errorLog.Printf("live logout: %v", err)
+		}
+	}
+	return nil
+}
+
+// UpdateStatus sets the status which the client reported for the player
+func (svc *Service) UpdateStatus(sid string, playerID int, status string) error {
+	player, err := svc.player(sid)
+	if err != nil {
+		return err
+	}
+	player.Lock()
+	err = svc.checkUpdate(sid, player, "status", playerID)
+	if err != nil {
+		player.Unlock()
+		return err
+	}
+	svc.recordStatus(player, status, player.GameTime)
+	player.websocketPlayer.Lock()
+	player.websocketPlayer.Status = status
+	player.websocketPlayer.Unlock()
+	player.Unlock()
+
+	svc.broadcast(player.PlayerID, "status", status)
+	return nil
+}
+
+// UpdateState applies a state update from any transport or version of the
+// client to the live player and broadcasts it to the website
+func (svc *Service) UpdateState(sid string, st *State) error {
+	if st.PlayerID < 1 {
+		return ErrInvalidPlayerID
+	}
+	player, err := svc.player(sid)
+	if err != nil {
+		return err
+	}
+	player.Lock()
+	err = svc.checkUpdate(sid, player, "state", st.PlayerID)
+	if err != nil {
+		player.Unlock()
+		return err
+	}
+	st.Status = player.status()
+	svc.bufferState(player, st)
+	if st.GameTime < player.GameTime {
+		player.notifiedGameTime = 0
+		player.bestTimeNotified = false
+	}
+	player.GameTime = st.GameTime
+	player.DeathType = st.DeathType
+	player.IsReplay = st.IsReplay
+	status := player.status()
+	svc.recordStatus(player, status, st.GameTime)
+	player.websocketPlayer.Lock()
+	player.websocketPlayer.GameTime = st.GameTime
+	player.websocketPlayer.Status = status
+	player.websocketPlayer.Unlock()
+	playerID, playerName := player.PlayerID, player.PlayerName
+	player.Unlock()
+
+	// the broadcasts and the database are waited on without the player
+	// locked, so that they never hold up the hub reading the player
+	message, err := websocket.NewMessage(strconv.Itoa(playerID), "submit", st)
+	if err != nil {
+		return err
+	}
+	svc.websocketHub.Broadcast <- message
+	svc.websocketHub.UpdateRaces(&websocket.RaceState{
+		PlayerID:      playerID,
+		PlayerName:    playerName,
+		GameTime:      st.GameTime,
+		Gems:          st.Gems,
+		EnemiesKilled: st.EnemiesKilled,
+		DeathType:     st.DeathType,
+		IsReplay:      st.IsReplay,
+	})
+
+	var milestones []models.Milestone
+	if !st.IsReplay && st.NotifyAboveThreshold {
+		milestones = svc.milestones(player, st.Spawnset)
+	}
+	player.Lock()
+	notifications := player.stateNotifications(st, milestones)
+	player.Unlock()
+	for _, notification := range notifications {
+		svc.notify(playerID, notification)
+	}
+	return nil
+}
+
+// GameSubmitted is called when the client has submitted the player's game, so
+// that the website, races and Discord are told about it
+func (svc *Service) GameSubmitted(sid string, gameID int, notifyPlayerBest, notifyAboveThreshold bool) error {
+	player, err := svc.player(sid)
+	if err != nil {
+		return err
+	}
+	player.Lock()
+	playerID := player.PlayerID
+	player.Unlock()
+	game, err := svc.db.Games.Get(gameID)
+	if err != nil {
+		svc.errorLog.Printf("live game submitted: %v", err)
+		return err
+	}
+	if game.PlayerID != playerID {
+		svc.errorLog.Printf("live game submitted from %s: game %d belongs to player %d, not %d", sid, gameID, game.PlayerID, playerID)
+		return ErrPlayerMismatch
+	}
+	player.Lock()
+	player.cancelRecovery()
+	player.Unlock()
+
+	svc.websocketHub.SubmitRaceGame(&websocket.RaceGame{
+		PlayerID:  playerID,
+		GameID:    gameID,
+		GameTime:  game.GameTime,
+		DeathType: game.DeathType,
+		IsReplay:  game.ReplayPlayerID != 0,
+	})
+
+	// submit new game notification to website
+	svc.broadcastToAll(playerID, "game_submitted", gameSubmitted{
+		PlayerID: playerID,
+		GameID:   gameID,
+	})
+
+	var milestones []models.Milestone
+	if game.ReplayPlayerID == 0 && notifyAboveThreshold {
+		milestones = svc.milestones(player, game.Spawnset)
+	}
+	player.Lock()
+	notifications := player.submissionNotifications(game, milestones, notifyPlayerBest)
+	player.Unlock()
+	for _, notification := range notifications {
+		svc.notify(playerID, notification)
+	}
+	return nil
+}
+
+// checkUpdate logs and returns an error if an update claiming to be from
+// playerID should be rejected. Rate limited updates are only logged once until
+// an update is accepted again. Must be called with the player locked.
+func (svc *Service) checkUpdate(sid string, player *player, update string, playerID int) error {
+	err := player.checkUpdate(playerID, time.Now())
+	if err == nil {
+		player.limiter.limited = false
+		return nil
+	}
+	if errors.Is(err, ErrRateLimited) {
+		if player.limiter.limited {
+			return err
+		}
+		player.limiter.limited = true
+	}
+	svc.errorLog.Printf("live %s update rejected from %s (logged in as %d, sent %d): %v", update, sid, player.PlayerID, playerID, err)
+	return err
+}
+
+// broadcast sends a message to the website viewers of the player
+func (svc *Service) broadcast(playerID int, function string, v interface{}) {
+	message, err := websocket.NewMessage(strconv.Itoa(playerID), function, v)
+	if err != nil {
+		svc.errorLog.Printf("live %s: %v", function, err)
+		return
+	}
+	svc.websocketHub.Broadcast <- message
+}
+
+// broadcastToAll sends a message about the player to every website viewer
+func (svc *Service) broadcastToAll(playerID int, function string, v interface{}) {
+	message, err := websocket.NewMessage(strconv.Itoa(playerID), function, v)
+	if err != nil {
+		svc.errorLog.Printf("live %s: %v", function, err)
+		return
+	}
+	svc.websocketHub.BroadcastToAll <- message
+}
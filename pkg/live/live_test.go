@@ -0,0 +1,179 @@
+package live
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
+	"github.com/alexwilkerson/ddstats-server/pkg/websocket"
+)
+
+func newTestService() *Service {
+	logger := log.New(ioutil.Discard, "", 0)
+	return NewService(logger, logger, websocket.NewHub(nil), nil, nil)
+}
+
+// loginTestPlayer stores a logged in player for the connection without going
+// through Login, which needs the database and the dd API
+func loginTestPlayer(svc *Service, sid string, playerID int) *player {
+	p := newPlayer(sid, &ddapi.Player{PlayerID: uint64(playerID)})
+	svc.players.Store(sid, p)
+	return p
+}
+
+func broadcastCount(hub *websocket.Hub) int {
+	n := 0
+	for {
+		select {
+		case <-hub.Broadcast:
+			n++
+		default:
+			return n
+		}
+	}
+}
+
+func TestUpdateStateRejectsSpoofedPlayer(t *testing.T) {
+	svc := newTestService()
+	loginTestPlayer(svc, "1", 10)
+
+	err := svc.UpdateState("1", &State{PlayerID: 20, GameTime: 5})
+	if !errors.Is(err, ErrPlayerMismatch) {
+		t.Fatalf("got error %v; want %v", err, ErrPlayerMismatch)
+	}
+	if n := broadcastCount(svc.websocketHub); n != 0 {
+		t.Fatalf("got %d broadcasts for a spoofed player; want 0", n)
+	}
+
+	err = svc.UpdateState("1", &State{PlayerID: 10, GameTime: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := broadcastCount(svc.websocketHub); n != 1 {
+		t.Fatalf("got %d broadcasts for the logged in player; want 1", n)
+	}
+}
+
+// TestUpdateStateUnlocksBeforeBroadcast checks that a full broadcast channel
+// doesn't leave the player locked, which would hold up the hub reading it
+func TestUpdateStateUnlocksBeforeBroadcast(t *testing.T) {
+	svc := newTestService()
+	p := loginTestPlayer(svc, "1", 10)
+	for len(svc.websocketHub.Broadcast) < cap(svc.websocketHub.Broadcast) {
+		svc.websocketHub.Broadcast <- &websocket.Message{}
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- svc.UpdateState("1", &State{PlayerID: 10, GameTime: 5})
+	}()
+	locked := make(chan struct{})
+	go func() {
+		// the update has been applied once the game time is set
+		for {
+			p.Lock()
+			gameTime := p.GameTime
+			p.Unlock()
+			if gameTime == 5 {
+				close(locked)
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("player stayed locked while waiting to broadcast")
+	}
+	broadcastCount(svc.websocketHub)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdateStatusRejectsSpoofedPlayer(t *testing.T) {
+	svc := newTestService()
+	loginTestPlayer(svc, "1", 10)
+
+	err := svc.UpdateStatus("1", 20, StatusDead)
+	if !errors.Is(err, ErrPlayerMismatch) {
+		t.Fatalf("got error %v; want %v", err, ErrPlayerMismatch)
+	}
+	if n := broadcastCount(svc.websocketHub); n != 0 {
+		t.Fatalf("got %d broadcasts for a spoofed player; want 0", n)
+	}
+}
+
+func TestUpdateNotLoggedIn(t *testing.T) {
+	svc := newTestService()
+	err := svc.UpdateState("1", &State{PlayerID: 10})
+	if !errors.Is(err, ErrNotLoggedIn) {
+		t.Fatalf("got error %v; want %v", err, ErrNotLoggedIn)
+	}
+}
+
+func TestUpdateStateRateLimit(t *testing.T) {
+	svc := newTestService()
+	loginTestPlayer(svc, "1", 10)
+
+	for i := 0; i < stateUpdateBurst*2; i++ {
+		svc.UpdateState("1", &State{PlayerID: 10, GameTime: float64(i)})
+	}
+	if n := broadcastCount(svc.websocketHub); n != stateUpdateBurst {
+		t.Fatalf("got %d broadcasts; want %d", n, stateUpdateBurst)
+	}
+}
+
+func TestRateLimiterRefills(t *testing.T) {
+	rl := newRateLimiter(2, 2)
+	now := time.Now()
+	if !rl.allow(now) || !rl.allow(now) {
+		t.Fatal("burst was not allowed")
+	}
+	if rl.allow(now) {
+		t.Fatal("allowed more than the burst")
+	}
+	if !rl.allow(now.Add(500 * time.Millisecond)) {
+		t.Fatal("bucket did not refill")
+	}
+}
+
+func TestLoginAsAnotherPlayer(t *testing.T) {
+	svc := newTestService()
+	loginTestPlayer(svc, "1", 10)
+
+	err := svc.Login("1", 11)
+	if !errors.Is(err, ErrAlreadyLoggedIn) {
+		t.Fatalf("got error %v; want %v", err, ErrAlreadyLoggedIn)
+	}
+	err = svc.Login("1", 10)
+	if err != nil {
+		t.Fatalf("got error %v logging in again as the same player", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		deathType int
+		isReplay  bool
+		want      string
+	}{
+		{-2, false, StatusInMainMenu},
+		{-1, false, StatusAlive},
+		{-1, true, StatusWatchingAReplay},
+		{0, false, StatusDead},
+		{5, true, StatusDead},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			p := &player{DeathType: tt.deathType, IsReplay: tt.isReplay}
+			if got := p.status(); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package live
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+	"github.com/alexwilkerson/ddstats-server/pkg/websocket"
+)
+
+const (
+	// notificationsTTL is how long a player's notification preferences are
+	// cached before being reloaded at the start of a run, so that changes made
+	// through the API or Discord apply without logging in again
+	notificationsTTL = time.Minute
+	// defaultSpawnset is the name of the spawnset of the unmodified game, which
+	// is used for live runs when the client doesn't send a spawnset
+	defaultSpawnset = "v3"
+)
+
+// notifications caches the milestones which apply to a player's runs
+type notifications struct {
+	loaded     time.Time
+	spawnset   string
+	milestones []models.Milestone
+}
+
+// milestones returns the player's notification milestones for runs on the
+// spawnset, reloading them if they are stale or for another spawnset. If they
+// can't be loaded, the default milestone is used. Must be called without the
+// player locked, since reloading them queries the database.
+func (svc *Service) milestones(player *player, spawnset string) []models.Milestone {
+	if spawnset == "" {
+		spawnset = defaultSpawnset
+	}
+	player.Lock()
+	n, playerID := player.notifications, player.PlayerID
+	player.Unlock()
+	if n != nil && strings.EqualFold(n.spawnset, spawnset) && time.Since(n.loaded) < notificationsTTL {
+		return n.milestones
+	}
+
+	preferences, err := svc.db.NotificationRules.Select(playerID)
+	if err != nil {
+		svc.errorLog.Printf("live notifications for player %d: %v", playerID, err)
+		preferences = &models.NotificationPreferences{PlayerID: playerID}
+	}
+	rule := preferences.Rule(spawnset)
+	var spawnsetTimes *models.Spawnset
+	if rule.DaggerTiers {
+		spawnsetTimes, err = svc.db.Spawnsets.Select(spawnset)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			svc.errorLog.Printf("live notifications for player %d: %v", playerID, err)
+		}
+	}
+	n = &notifications{
+		loaded:     time.Now(),
+		spawnset:   spawnset,
+		milestones: rule.Resolve(spawnsetTimes),
+	}
+	player.Lock()
+	player.notifications = n
+	player.Unlock()
+	return n.milestones
+}
+
+// stateNotifications returns the notifications triggered by a live state: the
+// player passing their best time, and passing one of their milestones. At most
+// one of each is sent per run. Must be called with the player locked, after
+// the state has been applied.
+func (p *player) stateNotifications(st *State, milestones []models.Milestone) []interface{} {
+	var notifications []interface{}
+	if st.IsReplay {
+		return nil
+	}
+	if st.NotifyPlayerBest && !p.bestTimeNotified && st.GameTime > p.BestGameTime {
+		p.bestTimeNotified = true
+		notifications = append(notifications, &websocket.PlayerBestReached{
+			PlayerID:         p.PlayerID,
+			PlayerName:       p.PlayerName,
+			PreviousGameTime: p.BestGameTime,
+		})
+	}
+	if st.NotifyAboveThreshold {
+		milestone, crossed := models.Crossed(milestones, p.notifiedGameTime, st.GameTime)
+		p.notifiedGameTime = st.GameTime
+		if crossed {
+			notifications = append(notifications, &websocket.PlayerAboveThreshold{
+				PlayerID:   p.PlayerID,
+				PlayerName: p.PlayerName,
+				GameTime:   milestone.GameTime,
+				Dagger:     milestone.Dagger,
+			})
+		}
+	}
+	return notifications
+}
+
+// submissionNotifications returns the notifications triggered by a submitted
+// game: a new best time, and a death after reaching any of the milestones.
+// Must be called with the player locked.
+func (p *player) submissionNotifications(game *models.GameWithName, milestones []models.Milestone, notifyPlayerBest bool) []interface{} {
+	var notifications []interface{}
+	if game.ReplayPlayerID != 0 {
+		return nil
+	}
+	if notifyPlayerBest && game.GameTime > p.BestGameTime {
+		notifications = append(notifications, &websocket.PlayerBestSubmitted{
+			PlayerName:       p.PlayerName,
+			GameID:           game.ID,
+			GameTime:         game.GameTime,
+			PreviousGameTime: p.BestGameTime,
+		})
+	}
+	if _, reached := models.Crossed(milestones, -1, game.GameTime); reached {
+		notifications = append(notifications, &websocket.PlayerAboveThresholdSubmitted{
+			PlayerName: p.PlayerName,
+			GameID:     game.ID,
+			GameTime:   game.GameTime,
+			DeathType:  game.DeathType,
+		})
+	}
+	return notifications
+}
+
+// notify sends a notification to Discord and to every website viewer
+func (svc *Service) notify(playerID int, notification interface{}) {
+	var function string
+	switch notification.(type) {
+	case *websocket.PlayerBestReached:
+		function = "past_personal_best_broadcast"
+	case *websocket.PlayerAboveThreshold:
+		function = "past_threshold_broadcast"
+	case *websocket.PlayerBestSubmitted:
+		function = "new_personal_best_broadcast"
+	case *websocket.PlayerAboveThresholdSubmitted:
+		function = "death_past_threshold_broadcast"
+	default:
+		svc.errorLog.Printf("live notify: unknown notification %T", notification)
+		return
+	}
+	svc.websocketHub.DiscordBroadcast <- notification
+	svc.broadcastToAll(playerID, function, notification)
+}
@@ -0,0 +1,90 @@
+package live
+
+import (
+	"testing"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+	"github.com/alexwilkerson/ddstats-server/pkg/websocket"
+)
+
+func TestStateNotifications(t *testing.T) {
+	milestones := []models.Milestone{{GameTime: 100}, {GameTime: 120, Dagger: "silver"}}
+	p := &player{PlayerID: 10, PlayerName: "xvlv", BestGameTime: 110}
+	update := func(gameTime float64) []interface{} {
+		if gameTime < p.GameTime {
+			p.notifiedGameTime = 0
+			p.bestTimeNotified = false
+		}
+		p.GameTime = gameTime
+		return p.stateNotifications(&State{GameTime: gameTime, DeathType: -1, NotifyPlayerBest: true, NotifyAboveThreshold: true}, milestones)
+	}
+
+	if got := update(50); len(got) != 0 {
+		t.Fatalf("got %d notifications at 50s; want 0", len(got))
+	}
+	got := update(101)
+	if len(got) != 1 {
+		t.Fatalf("got %d notifications at 101s; want 1", len(got))
+	}
+	if n, ok := got[0].(*websocket.PlayerAboveThreshold); !ok || n.GameTime != 100 {
+		t.Errorf("got %+v; want the 100s milestone", got[0])
+	}
+	if got := update(105); len(got) != 0 {
+		t.Fatalf("got %d notifications at 105s; want 0", len(got))
+	}
+	got = update(121)
+	if len(got) != 2 {
+		t.Fatalf("got %d notifications at 121s; want 2", len(got))
+	}
+	if _, ok := got[0].(*websocket.PlayerBestReached); !ok {
+		t.Errorf("got %T; want the best time notification first", got[0])
+	}
+	if n, ok := got[1].(*websocket.PlayerAboveThreshold); !ok || n.Dagger != "silver" {
+		t.Errorf("got %+v; want the silver dagger", got[1])
+	}
+	if got := update(130); len(got) != 0 {
+		t.Fatalf("got %d notifications at 130s; want 0", len(got))
+	}
+
+	// a new run notifies again
+	update(0)
+	if got := update(112); len(got) != 2 {
+		t.Fatalf("got %d notifications in the next run; want 2", len(got))
+	}
+
+	replay := p.stateNotifications(&State{GameTime: 500, IsReplay: true, NotifyPlayerBest: true, NotifyAboveThreshold: true}, milestones)
+	if len(replay) != 0 {
+		t.Errorf("got %d notifications for a replay; want 0", len(replay))
+	}
+}
+
+func TestSubmissionNotifications(t *testing.T) {
+	milestones := []models.Milestone{{GameTime: 100}}
+	p := &player{PlayerID: 10, PlayerName: "xvlv", BestGameTime: 110}
+	game := func(gameTime float64) *models.GameWithName {
+		return &models.GameWithName{Game: models.Game{ID: 1, PlayerID: 10, GameTime: gameTime}}
+	}
+
+	if got := p.submissionNotifications(game(90), milestones, true); len(got) != 0 {
+		t.Fatalf("got %d notifications for 90s; want 0", len(got))
+	}
+	if got := p.submissionNotifications(game(105), milestones, true); len(got) != 1 {
+		t.Fatalf("got %d notifications for 105s; want 1", len(got))
+	}
+	got := p.submissionNotifications(game(115), milestones, true)
+	if len(got) != 2 {
+		t.Fatalf("got %d notifications for 115s; want 2", len(got))
+	}
+	if n, ok := got[0].(*websocket.PlayerBestSubmitted); !ok || n.PreviousGameTime != 110 {
+		t.Errorf("got %+v; want a new best beating 110s", got[0])
+	}
+	if got := p.submissionNotifications(game(115), nil, false); len(got) != 0 {
+		t.Fatalf("got %d notifications for 115s without notifying bests; want 0", len(got))
+	}
+
+	replay := game(500)
+	replay.ReplayPlayerID = 20
+	if got := p.submissionNotifications(replay, milestones, true); len(got) != 0 {
+		t.Errorf("got %d notifications for a replay; want 0", len(got))
+	}
+}
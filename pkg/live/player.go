@@ -0,0 +1,110 @@
+package live
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
+	"github.com/alexwilkerson/ddstats-server/pkg/websocket"
+)
+
+const (
+	// stateUpdatesPerSecond is the sustained rate of state and status
+	// updates allowed per connection. The client sends one per second.
+	stateUpdatesPerSecond = 4
+	stateUpdateBurst      = 8
+)
+
+type player struct {
+	sync.Mutex
+	websocketPlayer  *websocket.PlayerWithLock
+	PlayerID         int
+	PlayerName       string
+	BestGameTime     float64
+	GameTime         float64
+	DeathType        int
+	IsReplay         bool
+	bestTimeNotified bool
+	notifiedGameTime float64
+	notifications    *notifications
+	limiter          *rateLimiter
+	playSession      *playSession
+	run              runBuffer
+	pendingRecovery  *time.Timer
+}
+
+func newPlayer(sid string, p *ddapi.Player) *player {
+	return &player{
+		websocketPlayer: &websocket.PlayerWithLock{
+			Player: websocket.Player{ID: int(p.PlayerID), Name: p.PlayerName, Status: StatusLoggedIn},
+			SID:    sid,
+		},
+		PlayerID:     int(p.PlayerID),
+		PlayerName:   p.PlayerName,
+		BestGameTime: p.GameTime,
+		DeathType:    -2, // IN MENU
+		limiter:      newRateLimiter(stateUpdatesPerSecond, stateUpdateBurst),
+	}
+}
+
+// checkUpdate returns an error if an update claiming to be from playerID
+// should be rejected. Must be called with the player locked.
+func (p *player) checkUpdate(playerID int, now time.Time) error {
+	if playerID != p.PlayerID {
+		return ErrPlayerMismatch
+	}
+	if !p.limiter.allow(now) {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+func (p *player) status() string {
+	var status string
+	switch {
+	case p.DeathType >= 0:
+		status = StatusDead
+	case p.DeathType == -2:
+		status = StatusInMainMenu
+	case p.DeathType == -1 && p.IsReplay == true:
+		status = StatusWatchingAReplay
+	default:
+		status = StatusAlive
+	}
+	return status
+}
+
+// rateLimiter is a token bucket which refills at rate tokens per second up to
+// burst tokens. It is not safe for concurrent use, and is guarded by the lock
+// of the player it belongs to.
+type rateLimiter struct {
+	rate    float64
+	burst   float64
+	tokens  float64
+	last    time.Time
+	limited bool
+}
+
+func newRateLimiter(rate, burst float64) *rateLimiter {
+	return &rateLimiter{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+	}
+}
+
+// allow takes a token from the bucket, returning false if none are left
+func (rl *rateLimiter) allow(now time.Time) bool {
+	if !rl.last.IsZero() {
+		rl.tokens += now.Sub(rl.last).Seconds() * rl.rate
+		if rl.tokens > rl.burst {
+			rl.tokens = rl.burst
+		}
+	}
+	rl.last = now
+	if rl.tokens < 1 {
+		return false
+	}
+	rl.tokens--
+	return true
+}
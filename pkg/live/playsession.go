@@ -0,0 +1,69 @@
+package live
+
+import (
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+)
+
+// playSession tracks the last event recorded in a connection's play session,
+// so that only transitions are written to the database
+type playSession struct {
+	id       int
+	event    string
+	gameTime float64
+}
+
+// playSessionEvent returns the play session event which a status transitions
+// to, or an empty string if the status is not recorded
+func playSessionEvent(status string) string {
+	switch status {
+	case StatusAlive:
+		return models.PlaySessionRunStart
+	case StatusDead:
+		return models.PlaySessionDeath
+	case StatusInMainMenu, StatusInDaggerLobby:
+		return models.PlaySessionMenu
+	case StatusWatchingAReplay:
+		return models.PlaySessionReplay
+	}
+	return ""
+}
+
+// recordStatus adds an event to the player's play session if their status has
+// changed since the last event. A run which restarts without a death in
+// between is recorded as a death at the last game time of the run. Must be
+// called with the player locked.
+func (svc *Service) recordStatus(player *player, status string, gameTime float64) {
+	ps := player.playSession
+	if ps == nil {
+		return
+	}
+	event := playSessionEvent(status)
+	if event == "" {
+		return
+	}
+	if event == models.PlaySessionRunStart && ps.event == models.PlaySessionRunStart {
+		if gameTime >= ps.gameTime {
+			ps.gameTime = gameTime
+			return
+		}
+		svc.addPlaySessionEvent(ps, models.PlaySessionDeath, ps.gameTime)
+	}
+	if event == ps.event {
+		return
+	}
+	// a death is only recorded at the end of a run that was seen starting
+	if event == models.PlaySessionDeath && ps.event != models.PlaySessionRunStart {
+		ps.event = event
+		return
+	}
+	svc.addPlaySessionEvent(ps, event, gameTime)
+}
+
+func (svc *Service) addPlaySessionEvent(ps *playSession, event string, gameTime float64) {
+	ps.event = event
+	ps.gameTime = gameTime
+	err := svc.db.PlaySessions.AddEvent(ps.id, event, gameTime)
+	if err != nil {
+		svc.errorLog.Printf("live play session %d: %v", ps.id, err)
+	}
+}
@@ -0,0 +1,182 @@
+package live
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+)
+
+const (
+	// recoveryTimeout is how long the server waits after a death for the
+	// client to submit the game before recovering it from the live states
+	recoveryTimeout = 30 * time.Second
+	// maxRunStates caps the number of states buffered for a single run, one
+	// per second of game time
+	maxRunStates = 7200
+)
+
+// errUnknownSpawnset is returned for a run on a spawnset whose survival hash
+// isn't known
+var errUnknownSpawnset = errors.New("unknown spawnset")
+
+// runBuffer holds one live state per second of game time of the current run,
+// so that the run can be recovered if the client never submits it
+type runBuffer struct {
+	states []*State
+}
+
+// add buffers the state if it is at least a second of game time after the
+// last one. The state of a death is always buffered.
+func (rb *runBuffer) add(st *State) {
+	if n := len(rb.states); n > 0 {
+		last := rb.states[n-1]
+		if st.GameTime < last.GameTime {
+			rb.reset()
+		} else if int(st.GameTime) <= int(last.GameTime) && st.DeathType < 0 {
+			return
+		}
+	}
+	if len(rb.states) >= maxRunStates {
+		return
+	}
+	rb.states = append(rb.states, st)
+}
+
+func (rb *runBuffer) reset() {
+	rb.states = nil
+}
+
+// submittedGame builds a game from the buffered states in the form the client
+// would have submitted it
+func (rb *runBuffer) submittedGame(playerID int) *models.SubmittedGame {
+	if len(rb.states) == 0 {
+		return nil
+	}
+	last := rb.states[len(rb.states)-1]
+	game := &models.SubmittedGame{
+		PlayerID:       playerID,
+		Granularity:    1,
+		GameTime:       last.GameTime,
+		Gems:           last.Gems,
+		LevelTwoTime:   last.LevelTwoTime,
+		LevelThreeTime: last.LevelThreeTime,
+		LevelFourTime:  last.LevelFourTime,
+		LeviDownTime:   last.LeviDownTime,
+		OrbDownTime:    last.OrbDownTime,
+		HomingDaggers:  last.HomingDaggers,
+		DaggersFired:   last.DaggersFired,
+		DaggersHit:     last.DaggersHit,
+		EnemiesAlive:   last.EnemiesAlive,
+		EnemiesKilled:  last.EnemiesKilled,
+		DeathType:      last.DeathType,
+		Source:         models.GameSourceLiveRecovered,
+	}
+	for _, st := range rb.states {
+		game.GameTimeSlice = append(game.GameTimeSlice, st.GameTime)
+		game.GemsSlice = append(game.GemsSlice, st.Gems)
+		game.HomingDaggersSlice = append(game.HomingDaggersSlice, st.HomingDaggers)
+		game.DaggersFiredSlice = append(game.DaggersFiredSlice, st.DaggersFired)
+		game.DaggersHitSlice = append(game.DaggersHitSlice, st.DaggersHit)
+		game.EnemiesAliveSlice = append(game.EnemiesAliveSlice, st.EnemiesAlive)
+		game.EnemiesKilledSlice = append(game.EnemiesKilledSlice, st.EnemiesKilled)
+		if st.HomingDaggers > game.HomingMax {
+			game.HomingMax = st.HomingDaggers
+			game.HomingMaxTime = st.GameTime
+		}
+		if st.EnemiesAlive > game.EnemiesAliveMax {
+			game.EnemiesAliveMax = st.EnemiesAlive
+			game.EnemiesAliveMaxTime = st.GameTime
+		}
+	}
+	return game
+}
+
+// bufferState adds the state to the player's run and schedules the recovery
+// of the run if the state is a death. Must be called with the player locked
+// and before the player's death type is updated.
+func (svc *Service) bufferState(player *player, st *State) {
+	if st.IsReplay {
+		player.run.reset()
+		return
+	}
+	if st.DeathType < 0 {
+		player.run.add(st)
+		return
+	}
+	if player.DeathType >= 0 || len(player.run.states) == 0 {
+		return
+	}
+	player.run.add(st)
+	game := player.run.submittedGame(player.PlayerID)
+	player.run.reset()
+	if player.pendingRecovery != nil {
+		player.pendingRecovery.Stop()
+	}
+	diedAt := time.Now()
+	playerID, playerName, spawnset := player.PlayerID, player.PlayerName, st.Spawnset
+	player.pendingRecovery = time.AfterFunc(recoveryTimeout, func() {
+		svc.recoverGame(playerID, playerName, spawnset, game, diedAt)
+	})
+}
+
+// cancelRecovery stops the recovery of the player's last run, because the
+// client has submitted it. Must be called with the player locked.
+func (player *player) cancelRecovery() {
+	if player.pendingRecovery != nil {
+		player.pendingRecovery.Stop()
+		player.pendingRecovery = nil
+	}
+}
+
+// recoverGame inserts a game rebuilt from live states, unless the client has
+// submitted the run without telling the socket.io server. The game is played
+// on the spawnset the live states were sent with, and its source marks it as
+// recovered.
+func (svc *Service) recoverGame(playerID int, playerName, spawnset string, game *models.SubmittedGame, diedAt time.Time) {
+	submitted, err := svc.db.Games.SubmittedSince(playerID, game.GameTime, diedAt.Add(-recoveryTimeout))
+	if err != nil {
+		svc.errorLog.Printf("live recover game for player %d: %v", playerID, err)
+		return
+	}
+	if submitted {
+		return
+	}
+	game.SurvivalHash, err = svc.survivalHash(spawnset)
+	if err != nil {
+		svc.errorLog.Printf("live recover game for player %d on spawnset %q: %v", playerID, spawnset, err)
+		return
+	}
+	gameID, err := svc.db.SubmittedGames.Insert(game)
+	if err != nil {
+		svc.errorLog.Printf("live recover game for player %d: %v", playerID, err)
+		return
+	}
+	svc.infoLog.Printf("recovered game %d (%.4fs) for %s (%d) from live states", gameID, game.GameTime, playerName, playerID)
+
+	svc.broadcastToAll(playerID, "game_recovered", gameSubmitted{
+		PlayerID: playerID,
+		GameID:   gameID,
+	})
+}
+
+// survivalHash returns the survival hash of the spawnset with the name, or an
+// empty hash for the default spawnset, whose hash SubmittedGames.Insert fills
+// in. A
+// spawnset which isn't in the spawnset table can't be recovered, since its
+// hash isn't known.
+func (svc *Service) survivalHash(spawnset string) (string, error) {
+	if spawnset == "" || strings.EqualFold(spawnset, defaultSpawnset) {
+		return "", nil
+	}
+	s, err := svc.db.Spawnsets.Select(spawnset)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", errUnknownSpawnset
+	}
+	if err != nil {
+		return "", err
+	}
+	return s.SurvivalHash, nil
+}
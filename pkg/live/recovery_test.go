@@ -0,0 +1,70 @@
+package live
+
+import (
+	"testing"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+)
+
+func TestRunBuffer(t *testing.T) {
+	var rb runBuffer
+	rb.add(&State{GameTime: 0.2, DeathType: -1, Gems: 1})
+	rb.add(&State{GameTime: 0.7, DeathType: -1, Gems: 2})
+	rb.add(&State{GameTime: 1.1, DeathType: -1, Gems: 3, HomingDaggers: 5, EnemiesAlive: 9})
+	rb.add(&State{GameTime: 2.3, DeathType: -1, Gems: 4, HomingDaggers: 2, EnemiesAlive: 12})
+	rb.add(&State{GameTime: 2.5, DeathType: 4, Gems: 4})
+
+	game := rb.submittedGame(10)
+	if len(game.GameTimeSlice) != 4 {
+		t.Fatalf("got %d states; want 4", len(game.GameTimeSlice))
+	}
+	if game.GameTime != 2.5 || game.DeathType != 4 || game.PlayerID != 10 {
+		t.Errorf("got game time %v, death type %d, player %d", game.GameTime, game.DeathType, game.PlayerID)
+	}
+	if game.HomingMax != 5 || game.HomingMaxTime != 1.1 || game.EnemiesAliveMax != 12 || game.EnemiesAliveMaxTime != 2.3 {
+		t.Errorf("got maxima %+v", game)
+	}
+	if game.Source != models.GameSourceLiveRecovered {
+		t.Errorf("got source %q; want %q", game.Source, models.GameSourceLiveRecovered)
+	}
+
+	// a restart without a death starts a new run
+	rb.add(&State{GameTime: 0.1, DeathType: -1})
+	if len(rb.states) != 1 {
+		t.Errorf("got %d states after a restart; want 1", len(rb.states))
+	}
+}
+
+func TestBufferStateSchedulesRecovery(t *testing.T) {
+	svc := newTestService()
+	p := &player{PlayerID: 10, DeathType: -1}
+
+	svc.bufferState(p, &State{GameTime: 1, DeathType: -1})
+	svc.bufferState(p, &State{GameTime: 2, DeathType: -1})
+	if p.pendingRecovery != nil {
+		t.Fatal("recovery scheduled before a death")
+	}
+
+	svc.bufferState(p, &State{GameTime: 2.5, DeathType: 1})
+	if p.pendingRecovery == nil {
+		t.Fatal("recovery not scheduled after a death")
+	}
+	if len(p.run.states) != 0 {
+		t.Errorf("got %d buffered states after a death; want 0", len(p.run.states))
+	}
+
+	p.cancelRecovery()
+	if p.pendingRecovery != nil {
+		t.Error("recovery not cancelled")
+	}
+}
+
+func TestSurvivalHashDefaultSpawnset(t *testing.T) {
+	svc := newTestService()
+	for _, spawnset := range []string{"", "v3", "V3"} {
+		hash, err := svc.survivalHash(spawnset)
+		if err != nil || hash != "" {
+			t.Errorf("got hash %q, error %v for spawnset %q; want the default", hash, err, spawnset)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package live
+
+// State is a live state update, no matter which transport or version of the
+// client it was received from. It is also what is broadcast to the website.
+type State struct {
+	PlayerID             int     `json:"player_id"`
+	GameTime             float64 `json:"game_time"`
+	Gems                 int     `json:"gems"`
+	HomingDaggers        int     `json:"homing_daggers"`
+	EnemiesAlive         int     `json:"enemies_alive"`
+	EnemiesKilled        int     `json:"enemies_killed"`
+	DaggersHit           int     `json:"daggers_hit"`
+	DaggersFired         int     `json:"daggers_fired"`
+	LevelTwoTime         float64 `json:"level_two_time"`
+	LevelThreeTime       float64 `json:"level_three_time"`
+	LevelFourTime        float64 `json:"level_four_time"`
+	LeviDownTime         float64 `json:"levi_down_time"`
+	OrbDownTime          float64 `json:"orb_down_time"`
+	DeathType            int     `json:"death_type"`
+	IsReplay             bool    `json:"is_replay"`
+	Status               string  `json:"status"`
+	TotalGems            int     `json:"total_gems,omitempty"`
+	LevelGems            int     `json:"level_gems,omitempty"`
+	GemsDespawned        int     `json:"gems_despawned,omitempty"`
+	GemsEaten            int     `json:"gems_eaten,omitempty"`
+	DaggersEaten         int     `json:"daggers_eaten,omitempty"`
+	PerEnemyAliveCount   []int   `json:"per_enemy_alive_count,omitempty"`
+	PerEnemyKillCount    []int   `json:"per_enemy_kill_count,omitempty"`
+	Spawnset             string  `json:"spawnset,omitempty"`
+	NotifyPlayerBest     bool    `json:"-"`
+	NotifyAboveThreshold bool    `json:"-"`
+}
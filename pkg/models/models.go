@@ -1,12 +1,20 @@
 package models
 
 import (
+	"bytes"
 	"database/sql"
 	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/alexwilkerson/ddstats-server/pkg/catalog"
+	"github.com/lib/pq"
 	"gopkg.in/guregu/null.v3"
 )
 
@@ -15,6 +23,14 @@ var ErrNoRecord = errors.New("no record found")
 var ErrNoDiscordUserFound = errors.New("no entry associated with that discord ID")
 var ErrDiscordUserVerified = errors.New("discord user is verified so cannot update their values")
 
+// Game sources record how a game got into the database
+const (
+	GameSourceClient = "client"
+	// GameSourceLiveRecovered games were rebuilt from the live states of a run
+	// whose client never submitted it, and are replaced by a later submission
+	GameSourceLiveRecovered = "live_recovered"
+)
+
 //Game record representation
 type Game struct {
 	ID                   int         `json:"id" db:"id"`
@@ -53,6 +69,7 @@ type Game struct {
 	IsReplay             bool        `json:"is_replay" db:"is_replay"`
 	PerEnemyAliveCount   []int16     `json:"per_enemy_alive_count,omitempty" db:"per_enemy_alive_count"`
 	PerEnemyKillCount    []int16     `json:"per_enemy_kill_count,omitempty" db:"per_enemy_kill_count"`
+	Source               string      `json:"source,omitempty" db:"source"`
 }
 
 // GameWithName is game with player_name included
@@ -85,6 +102,257 @@ type Player struct {
 	OverallAccuracy        float64    `json:"overall_accuracy" db:"overall_accuracy"`
 }
 
+// LivePlayer is a row from the live table, which tracks the presence of
+// players connected through the ddstats client
+type LivePlayer struct {
+	PlayerID   int       `json:"player_id" db:"player_id"`
+	PlayerName string    `json:"player_name" db:"player_name"`
+	SID        string    `json:"-" db:"sid"`
+	Status     string    `json:"status" db:"status"`
+	GameTime   float64   `json:"game_time" db:"game_time"`
+	LoggedIn   time.Time `json:"logged_in" db:"logged_in"`
+	LastSeen   time.Time `json:"last_seen" db:"last_seen"`
+}
+
+// Race is the result of a versus race between several live players
+type Race struct {
+	ID       string        `json:"race_id" db:"id"`
+	Created  time.Time     `json:"created" db:"created"`
+	Started  time.Time     `json:"started" db:"started"`
+	Finished time.Time     `json:"finished" db:"finished"`
+	Players  []*RacePlayer `json:"players"`
+}
+
+// RacePlayer is one player's result in a race
+type RacePlayer struct {
+	RaceID     string  `json:"-" db:"race_id"`
+	PlayerID   int     `json:"player_id" db:"player_id"`
+	PlayerName string  `json:"player_name" db:"player_name"`
+	GameID     int     `json:"game_id" db:"game_id"`
+	GameTime   float64 `json:"game_time" db:"game_time"`
+	Place      int     `json:"place" db:"place"`
+}
+
+// Play session events, recorded as the status of a connected player changes
+const (
+	PlaySessionLogin    = "login"
+	PlaySessionLogout   = "logout"
+	PlaySessionRunStart = "run_start"
+	PlaySessionDeath    = "death"
+	PlaySessionMenu     = "menu"
+	PlaySessionReplay   = "replay"
+)
+
+const (
+	// ShortDeathGameTime is the game time below which a death counts towards
+	// a streak of short deaths
+	ShortDeathGameTime = 30.0
+	// TiltStreak is the number of short deaths in a row after which a session
+	// is flagged as tilted
+	TiltStreak = 5
+)
+
+// PlaySession is the timeline of a single ddstats client connection, from
+// login to logout
+type PlaySession struct {
+	ID       int                 `json:"id" db:"id"`
+	PlayerID int                 `json:"player_id" db:"player_id"`
+	SID      string              `json:"-" db:"sid"`
+	Started  time.Time           `json:"started" db:"started"`
+	Ended    null.Time           `json:"ended" db:"ended"`
+	Events   []*PlaySessionEvent `json:"events"`
+	PlaySessionSummary
+}
+
+// PlaySessionEvent is a single transition in a play session
+type PlaySessionEvent struct {
+	PlaySessionID int       `json:"-" db:"play_session_id"`
+	Event         string    `json:"event" db:"event"`
+	GameTime      float64   `json:"game_time" db:"game_time"`
+	At            time.Time `json:"at" db:"at"`
+}
+
+// PlaySessionSummary holds the totals of a play session, all times are in
+// seconds
+type PlaySessionSummary struct {
+	Runs             int     `json:"runs"`
+	Deaths           int     `json:"deaths"`
+	BestGameTime     float64 `json:"best_game_time"`
+	ActiveTime       float64 `json:"active_time"`
+	MenuTime         float64 `json:"menu_time"`
+	ReplayTime       float64 `json:"replay_time"`
+	ShortDeathStreak int     `json:"short_death_streak"`
+	Tilted           bool    `json:"tilted"`
+}
+
+// Summarize computes the summary of the session from its events, which must be
+// in order. The last event of a session which hasn't ended lasts until now.
+func (ps *PlaySession) Summarize(now time.Time) {
+	var summary PlaySessionSummary
+	streak := 0
+	for i, event := range ps.Events {
+		end := now
+		if i+1 < len(ps.Events) {
+			end = ps.Events[i+1].At
+		} else if ps.Ended.Valid {
+			end = ps.Ended.Time
+		}
+		duration := end.Sub(event.At).Seconds()
+		if duration < 0 {
+			duration = 0
+		}
+		switch event.Event {
+		case PlaySessionRunStart:
+			summary.Runs++
+			summary.ActiveTime += duration
+		case PlaySessionMenu:
+			summary.MenuTime += duration
+		case PlaySessionReplay:
+			summary.ReplayTime += duration
+		case PlaySessionDeath:
+			summary.Deaths++
+			if event.GameTime > summary.BestGameTime {
+				summary.BestGameTime = event.GameTime
+			}
+			if event.GameTime < ShortDeathGameTime {
+				streak++
+			} else {
+				streak = 0
+			}
+			if streak > summary.ShortDeathStreak {
+				summary.ShortDeathStreak = streak
+			}
+		}
+	}
+	summary.Tilted = summary.ShortDeathStreak >= TiltStreak
+	ps.PlaySessionSummary = summary
+}
+
+const (
+	// DefaultNotificationMilestone is the only milestone of players who haven't
+	// set any notification rules
+	DefaultNotificationMilestone = 1000.0
+	// MinNotificationMilestone is the earliest milestone allowed, so that
+	// players can't have every run they play announced
+	MinNotificationMilestone  = 100.0
+	MaxNotificationRules      = 10
+	MaxNotificationMilestones = 10
+	maxNotificationSpawnset   = 64
+)
+
+// ErrInvalidNotificationRule is returned when notification preferences fail
+// validation
+var ErrInvalidNotificationRule = errors.New("invalid notification rule")
+
+// NotificationRule holds the game times at which a player's live runs on a
+// spawnset are announced. The rule with an empty spawnset applies to every
+// spawnset without a rule of its own.
+type NotificationRule struct {
+	PlayerID    int             `json:"-" db:"player_id"`
+	Spawnset    string          `json:"spawnset" db:"spawnset"`
+	Milestones  pq.Float64Array `json:"milestones" db:"milestones"`
+	DaggerTiers bool            `json:"dagger_tiers" db:"dagger_tiers"`
+}
+
+// NotificationPreferences are all of a player's notification rules
+type NotificationPreferences struct {
+	PlayerID int                 `json:"player_id"`
+	Rules    []*NotificationRule `json:"rules"`
+}
+
+// Milestone is a game time at which a notification is sent. Dagger is set if
+// the milestone comes from the dagger times of the spawnset.
+type Milestone struct {
+	GameTime float64 `json:"game_time"`
+	Dagger   string  `json:"dagger,omitempty"`
+}
+
+// Rule returns the rule for the spawnset, falling back to the player's default
+// rule and then to DefaultNotificationMilestone
+func (np *NotificationPreferences) Rule(spawnset string) *NotificationRule {
+	var defaultRule *NotificationRule
+	for _, rule := range np.Rules {
+		if rule.Spawnset != "" && strings.EqualFold(rule.Spawnset, spawnset) {
+			return rule
+		}
+		if rule.Spawnset == "" {
+			defaultRule = rule
+		}
+	}
+	if defaultRule != nil {
+		return defaultRule
+	}
+	return &NotificationRule{
+		PlayerID:   np.PlayerID,
+		Milestones: pq.Float64Array{DefaultNotificationMilestone},
+	}
+}
+
+// Validate returns an error wrapping ErrInvalidNotificationRule if the
+// preferences can't be stored
+func (np *NotificationPreferences) Validate() error {
+	if len(np.Rules) > MaxNotificationRules {
+		return fmt.Errorf("%w: at most %d rules are allowed", ErrInvalidNotificationRule, MaxNotificationRules)
+	}
+	seen := make(map[string]bool)
+	for _, rule := range np.Rules {
+		spawnset := strings.ToLower(rule.Spawnset)
+		if seen[spawnset] {
+			return fmt.Errorf("%w: more than one rule for spawnset %q", ErrInvalidNotificationRule, rule.Spawnset)
+		}
+		seen[spawnset] = true
+		if len(rule.Spawnset) > maxNotificationSpawnset {
+			return fmt.Errorf("%w: spawnset must be at most %d characters", ErrInvalidNotificationRule, maxNotificationSpawnset)
+		}
+		if len(rule.Milestones) > MaxNotificationMilestones {
+			return fmt.Errorf("%w: at most %d milestones are allowed per rule", ErrInvalidNotificationRule, MaxNotificationMilestones)
+		}
+		for _, milestone := range rule.Milestones {
+			if math.IsNaN(milestone) || math.IsInf(milestone, 0) || milestone < MinNotificationMilestone {
+				return fmt.Errorf("%w: milestones must be numbers of at least %g seconds", ErrInvalidNotificationRule, MinNotificationMilestone)
+			}
+		}
+	}
+	return nil
+}
+
+// Resolve returns the rule's milestones in ascending order, including the
+// dagger times of the spawnset if the rule has DaggerTiers set. spawnset may
+// be nil if it is not known.
+func (nr *NotificationRule) Resolve(spawnset *Spawnset) []Milestone {
+	milestones := make([]Milestone, 0, len(nr.Milestones)+4)
+	for _, gameTime := range nr.Milestones {
+		milestones = append(milestones, Milestone{GameTime: gameTime})
+	}
+	if nr.DaggerTiers && spawnset != nil {
+		for _, tier := range []Milestone{
+			{spawnset.BronzeDaggerTime, "bronze"},
+			{spawnset.SilverDaggerTime, "silver"},
+			{spawnset.GoldDaggerTime, "gold"},
+			{spawnset.DevilDaggerTime, "devil"},
+		} {
+			if tier.GameTime > 0 {
+				milestones = append(milestones, tier)
+			}
+		}
+	}
+	sort.SliceStable(milestones, func(i, j int) bool {
+		return milestones[i].GameTime < milestones[j].GameTime
+	})
+	return milestones
+}
+
+// Crossed returns the highest of the ascending milestones which is after from
+// and no later than to, and false if none are
+func Crossed(milestones []Milestone, from, to float64) (Milestone, bool) {
+	for i := len(milestones) - 1; i >= 0; i-- {
+		if milestones[i].GameTime <= to {
+			return milestones[i], milestones[i].GameTime > from
+		}
+	}
+	return Milestone{}, false
+}
+
 type ReplayPlayer struct {
 	ID         int    `db:"id"`
 	PlayerName string `db:"player_name"`
@@ -185,6 +453,7 @@ type SubmittedGame struct {
 	ReplayPlayerID      int       `json:"replayPlayerID"`
 	Version             string    `json:"version"`
 	SurvivalHash        string    `json:"survivalHash"`
+	Source              string    `json:"-"`
 }
 
 // SubmittedGameV2 is used to decode the JSON struct that comes in when a player
@@ -256,6 +525,48 @@ type News struct {
 	Body      string    `json:"body" db:"body"`
 }
 
+// DeathTypeCounts counts players by death type. It is encoded as a JSON
+// object in the order of catalog.Current.DeathTypes, followed by any death
+// types which aren't in the catalog in alphabetical order, so that charts show
+// the death types in the game's order.
+type DeathTypeCounts map[string]int
+
+// MarshalJSON encodes the counts in the order of the catalog's death types
+func (dtc DeathTypeCounts) MarshalJSON() ([]byte, error) {
+	if dtc == nil {
+		return []byte("null"), nil
+	}
+	names := make([]string, 0, len(dtc))
+	for _, name := range catalog.Current.DeathTypes {
+		if _, ok := dtc[name]; ok {
+			names = append(names, name)
+		}
+	}
+	others := make([]string, 0, len(dtc)-len(names))
+	for name := range dtc {
+		if _, ok := catalog.Current.DeathTypeID(name); !ok {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, name := range append(names, others...) {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.WriteString(strconv.Itoa(dtc[name]))
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
 type CollectorRun struct {
 	ID                                  int       `json:"-" db:"id"`
 	TimeStamp                           time.Time `json:"time_stamp" db:"time_stamp"`
@@ -298,22 +609,8 @@ type CollectorRun struct {
 	SinceSilverDaggers                  int       `json:"since_silver_daggers" db:"since_silver_daggers"`
 	SinceGoldDaggers                    int       `json:"since_gold_daggers" db:"since_gold_daggers"`
 	SinceDevilDaggers                   int       `json:"since_devil_daggers" db:"since_devil_daggers"`
-	Fallen                              int       `json:"fallen" db:"fallen"`
-	Swarmed                             int       `json:"swarmed" db:"swarmed"`
-	Impaled                             int       `json:"impaled" db:"impaled"`
-	Gored                               int       `json:"gored" db:"gored"`
-	Infested                            int       `json:"infested" db:"infested"`
-	Opened                              int       `json:"opened" db:"opened"`
-	Purged                              int       `json:"purged" db:"purged"`
-	Desecrated                          int       `json:"desecrated" db:"desecrated"`
-	Sacrificed                          int       `json:"sacrificed" db:"sacrificed"`
-	Eviscerated                         int       `json:"eviscerated" db:"eviscerated"`
-	Annihilated                         int       `json:"annihilated" db:"annihilated"`
-	Intoxicated                         int       `json:"intoxicated" db:"intoxicated"`
-	Envenmonated                        int       `json:"envenmonated" db:"envenmonated"`
-	Incarnated                          int       `json:"incarnated" db:"incarnated"`
-	Discarnated                         int       `json:"discarnated" db:"discarnated"`
-	Barbed                              int       `json:"barbed" db:"barbed"`
+	// DeathTypes counts the players on the leaderboard by how they last died
+	DeathTypes DeathTypeCounts `json:"death_types" db:"-"`
 }
 
 type CollectorPlayer struct {
@@ -363,6 +660,121 @@ type CollectorNewPlayer struct {
 	GameTime            float64 `json:"game_time" db:"game_time"`
 }
 
+// Rollup periods
+const (
+	RollupWeek  = "week"
+	RollupMonth = "month"
+)
+
+// ErrInvalidRollupPeriod is returned for a rollup period which isn't
+// RollupWeek or RollupMonth
+var ErrInvalidRollupPeriod = errors.New("period must be week or month")
+
+// CollectorRollup sums up the finished collector runs started between Start
+// and End
+type CollectorRollup struct {
+	Start         time.Time `json:"start" db:"start"`
+	End           time.Time `json:"end" db:"-"`
+	Runs          int       `json:"runs" db:"runs"`
+	NewPlayers    int       `json:"new_players" db:"new_players"`
+	ActivePlayers int       `json:"active_players" db:"active_players"`
+	GameTime      float64   `json:"game_time" db:"game_time"`
+	Deaths        int       `json:"deaths" db:"deaths"`
+	Gems          int       `json:"gems" db:"gems"`
+	EnemiesKilled int       `json:"enemies_killed" db:"enemies_killed"`
+	BronzeDaggers int       `json:"bronze_daggers" db:"bronze_daggers"`
+	SilverDaggers int       `json:"silver_daggers" db:"silver_daggers"`
+	GoldDaggers   int       `json:"gold_daggers" db:"gold_daggers"`
+	DevilDaggers  int       `json:"devil_daggers" db:"devil_daggers"`
+	// DeathTypes are the death types of the leaderboard as of the last run
+	DeathTypes DeathTypeCounts `json:"death_types" db:"-"`
+	LastRunID  int            `json:"last_run_id" db:"last_run_id"`
+}
+
+// CollectorPlayerSnapshot is a player's stats as of a collector run
+type CollectorPlayerSnapshot struct {
+	CollectorRunID    int       `json:"run_id" db:"collector_run_id"`
+	TimeStamp         time.Time `json:"time_stamp" db:"time_stamp"`
+	CollectorPlayerID int       `json:"-" db:"collector_player_id"`
+	Rank              int       `json:"rank" db:"rank"`
+	GameTime          float64   `json:"game_time" db:"game_time"`
+	OverallDeaths     int       `json:"overall_deaths" db:"overall_deaths"`
+	OverallGameTime   float64   `json:"overall_game_time" db:"overall_game_time"`
+	// SinceDeaths and SinceGameTime are the player's activity since the
+	// snapshot before
+	SinceDeaths   int     `json:"since_deaths" db:"since_deaths"`
+	SinceGameTime float64 `json:"since_game_time" db:"since_game_time"`
+}
+
+// CollectorRunState is the progress of a collector run which hasn't finished,
+// and the players' stats summed so far
+type CollectorRunState struct {
+	CollectorRunID        int      `db:"collector_run_id"`
+	NextRank              int      `db:"next_rank"`
+	RunTime               Duration `db:"run_time"`
+	TotalPlayers          int      `db:"total_players"`
+	ActivePlayers         int      `db:"active_players"`
+	PlayersWithNewScores  int      `db:"players_with_new_scores"`
+	PlayersWithNewRanks   int      `db:"players_with_new_ranks"`
+	PlayerImprovementTime float64  `db:"player_improvement_time"`
+	PlayerRankImprovement int      `db:"player_rank_improvement"`
+	PlayerGameTime        float64  `db:"player_game_time"`
+	PlayerDeaths          int      `db:"player_deaths"`
+	PlayerGems            int      `db:"player_gems"`
+	PlayerEnemiesKilled   int      `db:"player_enemies_killed"`
+	PlayerDaggersHit      int      `db:"player_daggers_hit"`
+	PlayerDaggersFired    int      `db:"player_daggers_fired"`
+	// WorldRecord is the best game time as of the start of the run
+	WorldRecord float64 `db:"world_record"`
+}
+
+// Rules which flag a score as an anomaly
+const (
+	AnomalyInactiveJump     = "inactive_jump"
+	AnomalyAboveWorldRecord = "above_world_record"
+	AnomalyNoNewDeaths      = "no_new_deaths"
+)
+
+// Review statuses of an anomaly
+const (
+	AnomalyPending   = "pending"
+	AnomalyConfirmed = "confirmed"
+	AnomalyDismissed = "dismissed"
+)
+
+// ErrInvalidAnomalyStatus is returned for a review status which isn't
+// AnomalyPending, AnomalyConfirmed or AnomalyDismissed
+var ErrInvalidAnomalyStatus = errors.New("status must be pending, confirmed or dismissed")
+
+// CollectorAnomaly is a suspicious score flagged by the collector for review
+type CollectorAnomaly struct {
+	ID                  int       `json:"id" db:"id"`
+	CollectorRunID      int       `json:"run_id" db:"collector_run_id"`
+	CollectorPlayerID   int       `json:"player_id" db:"collector_player_id"`
+	CollectorPlayerName string    `json:"player_name" db:"collector_player_name"`
+	Rule                string    `json:"rule" db:"rule"`
+	Detail              string    `json:"detail" db:"detail"`
+	GameTime            float64   `json:"game_time" db:"game_time"`
+	PreviousGameTime    float64   `json:"previous_game_time" db:"previous_game_time"`
+	Status              string    `json:"status" db:"status"`
+	TimeStamp           time.Time `json:"time_stamp" db:"time_stamp"`
+	ReviewedAt          null.Time `json:"reviewed_at" db:"reviewed_at"`
+}
+
+// ErrCollectorRunning is returned when the collector lock is held by another
+// collector
+var ErrCollectorRunning = errors.New("another collector is running")
+
+// CollectorStatus is the state of the collector's schedule
+type CollectorStatus struct {
+	Running      bool      `json:"running" db:"running"`
+	LastStarted  null.Time `json:"last_started" db:"last_started"`
+	LastSuccess  null.Time `json:"last_success" db:"last_success"`
+	LastDuration Duration  `json:"last_duration" db:"last_duration"`
+	LastError    string    `json:"last_error" db:"last_error"`
+	NextRun      null.Time `json:"next_run" db:"next_run"`
+}
+
 type Spawnset struct {
 	SurvivalHash     string  `json:"survival_hash,omitempty" db:"survival_hash"`
 	SpawnsetName     string  `json:"spawnset_name,omitempty" db:"spawnset_name"`
@@ -378,6 +790,11 @@ func (d Duration) Value() (driver.Value, error) {
 	return driver.Value(int64(d)), nil
 }
 
+// MarshalJSON encodes the duration in seconds
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatFloat(time.Duration(d).Seconds(), 'f', -1, 64)), nil
+}
+
 func (d *Duration) Scan(raw interface{}) error {
 	switch v := raw.(type) {
 	case int64:
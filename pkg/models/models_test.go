@@ -0,0 +1,148 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestPlaySessionSummarize(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+
+	session := &PlaySession{
+		Started: start,
+		Ended:   null.TimeFrom(at(400)),
+		Events: []*PlaySessionEvent{
+			{Event: PlaySessionLogin, At: at(0)},
+			{Event: PlaySessionMenu, At: at(0)},
+			{Event: PlaySessionRunStart, At: at(10)},
+			{Event: PlaySessionDeath, GameTime: 100, At: at(110)},
+			{Event: PlaySessionReplay, At: at(120)},
+			{Event: PlaySessionRunStart, At: at(150)},
+			{Event: PlaySessionDeath, GameTime: 5, At: at(155)},
+			{Event: PlaySessionRunStart, At: at(160)},
+			{Event: PlaySessionDeath, GameTime: 8, At: at(168)},
+			{Event: PlaySessionMenu, At: at(170)},
+			{Event: PlaySessionLogout, At: at(400)},
+		},
+	}
+	session.Summarize(at(1000))
+
+	want := PlaySessionSummary{
+		Runs:             3,
+		Deaths:           3,
+		BestGameTime:     100,
+		ActiveTime:       100 + 5 + 8,
+		MenuTime:         10 + 230,
+		ReplayTime:       30,
+		ShortDeathStreak: 2,
+	}
+	if session.PlaySessionSummary != want {
+		t.Errorf("got %+v; want %+v", session.PlaySessionSummary, want)
+	}
+}
+
+func TestPlaySessionSummarizeTilted(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	session := &PlaySession{Started: start}
+	for i := 0; i < TiltStreak; i++ {
+		at := start.Add(time.Duration(i) * time.Minute)
+		session.Events = append(session.Events,
+			&PlaySessionEvent{Event: PlaySessionRunStart, At: at},
+			&PlaySessionEvent{Event: PlaySessionDeath, GameTime: ShortDeathGameTime - 1, At: at.Add(29 * time.Second)},
+		)
+	}
+	// the session hasn't ended, so the last death lasts until now
+	session.Summarize(start.Add(time.Hour))
+
+	if !session.Tilted {
+		t.Errorf("got Tilted false after %d short deaths", session.ShortDeathStreak)
+	}
+	if session.Runs != TiltStreak {
+		t.Errorf("got %d runs; want %d", session.Runs, TiltStreak)
+	}
+}
+
+func TestNotificationRules(t *testing.T) {
+	preferences := &NotificationPreferences{
+		PlayerID: 1,
+		Rules: []*NotificationRule{
+			{Spawnset: "", Milestones: []float64{300, 100}},
+			{Spawnset: "pacifist", Milestones: []float64{50}, DaggerTiers: true},
+		},
+	}
+	pacifist := &Spawnset{BronzeDaggerTime: 50, SilverDaggerTime: 70, GoldDaggerTime: 90, DevilDaggerTime: 110}
+
+	milestones := preferences.Rule("Pacifist").Resolve(pacifist)
+	if len(milestones) != 5 || milestones[0].GameTime != 50 || milestones[4].Dagger != "devil" {
+		t.Fatalf("got pacifist milestones %+v", milestones)
+	}
+	milestone, crossed := Crossed(milestones, 60, 95)
+	if !crossed || milestone.Dagger != "gold" {
+		t.Errorf("got %+v, %t; want the gold dagger", milestone, crossed)
+	}
+	if _, crossed := Crossed(milestones, 95, 100); crossed {
+		t.Error("crossed a milestone between 95 and 100")
+	}
+
+	milestones = preferences.Rule("v3").Resolve(nil)
+	if len(milestones) != 2 || milestones[0].GameTime != 100 {
+		t.Fatalf("got default milestones %+v", milestones)
+	}
+
+	empty := &NotificationPreferences{PlayerID: 1}
+	milestones = empty.Rule("v3").Resolve(nil)
+	if len(milestones) != 1 || milestones[0].GameTime != DefaultNotificationMilestone {
+		t.Fatalf("got milestones %+v without rules", milestones)
+	}
+}
+
+func TestNotificationPreferencesValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []*NotificationRule
+		wantErr bool
+	}{
+		{"valid", []*NotificationRule{{Milestones: []float64{500}}, {Spawnset: "pacifist", DaggerTiers: true}}, false},
+		{"duplicate spawnset", []*NotificationRule{{Spawnset: "Pacifist"}, {Spawnset: "pacifist"}}, true},
+		{"negative milestone", []*NotificationRule{{Milestones: []float64{-1}}}, true},
+		{"milestone too early", []*NotificationRule{{Milestones: []float64{MinNotificationMilestone - 1}}}, true},
+		{"NaN milestone", []*NotificationRule{{Milestones: []float64{math.NaN()}}}, true},
+		{"infinite milestone", []*NotificationRule{{Milestones: []float64{math.Inf(1)}}}, true},
+		{"too many rules", make([]*NotificationRule, MaxNotificationRules+1), true},
+		{"too many milestones", []*NotificationRule{{Milestones: make([]float64, MaxNotificationMilestones+1)}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&NotificationPreferences{PlayerID: 1, Rules: tt.rules}).Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v; want error %t", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidNotificationRule) {
+				t.Errorf("got error %v; want ErrInvalidNotificationRule", err)
+			}
+		})
+	}
+}
+
+func TestDeathTypeCountsMarshalJSON(t *testing.T) {
+	counts := DeathTypeCounts{"SWARMED": 2, "STUBBED": 3, "FALLEN": 1, "BARBED": 4, "AAA": 5}
+	got, err := json.Marshal(counts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"FALLEN":1,"SWARMED":2,"BARBED":4,"AAA":5,"STUBBED":3}`
+	if string(got) != want {
+		t.Errorf("got %s; want %s", got, want)
+	}
+	var decoded map[string]int
+	err = json.Unmarshal(got, &decoded)
+	if err != nil || len(decoded) != len(counts) {
+		t.Errorf("got %v, %v decoding %s", decoded, err, got)
+	}
+}
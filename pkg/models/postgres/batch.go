@@ -0,0 +1,48 @@
+package postgres
+
+import (
+	"strconv"
+	"strings"
+)
+
+// maxBatchParams is the most parameters a batched statement is given, below
+// the 65535 Postgres accepts
+const maxBatchParams = 60000
+
+// batchValues returns the placeholders of a multi-row VALUES list, such as
+// "($1, $2), ($3, $4)" for 2 rows of 2 columns
+func batchValues(rows, columns int) string {
+	var b strings.Builder
+	for row := 0; row < rows; row++ {
+		if row > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for column := 0; column < columns; column++ {
+			if column > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(row*columns + column + 1))
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+// batches calls insert with the ranges of n rows of the columns which fit in
+// a statement
+func batches(n, columns int, insert func(from, to int) error) error {
+	size := maxBatchParams / columns
+	for from := 0; from < n; from += size {
+		to := from + size
+		if to > n {
+			to = n
+		}
+		err := insert(from, to)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package postgres
+
+import "testing"
+
+func TestBatchValues(t *testing.T) {
+	tests := []struct {
+		rows, columns int
+		want          string
+	}{
+		{1, 1, "($1)"},
+		{1, 3, "($1, $2, $3)"},
+		{2, 2, "($1, $2), ($3, $4)"},
+		{3, 1, "($1), ($2), ($3)"},
+	}
+	for _, tt := range tests {
+		if got := batchValues(tt.rows, tt.columns); got != tt.want {
+			t.Errorf("batchValues(%d, %d) = %q; want %q", tt.rows, tt.columns, got, tt.want)
+		}
+	}
+}
+
+func TestBatches(t *testing.T) {
+	var ranges [][2]int
+	err := batches(maxBatchParams/10*2+1, 10, func(from, to int) error {
+		ranges = append(ranges, [2]int{from, to})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := maxBatchParams / 10
+	want := [][2]int{{0, size}, {size, 2 * size}, {2 * size, 2*size + 1}}
+	if len(ranges) != len(want) {
+		t.Fatalf("got %v; want %v", ranges, want)
+	}
+	for i := range want {
+		if ranges[i] != want[i] {
+			t.Fatalf("got %v; want %v", ranges, want)
+		}
+	}
+}
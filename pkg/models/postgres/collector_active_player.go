@@ -12,15 +12,20 @@ type CollectorActivePlayerModel struct {
 	DB *sqlx.DB
 }
 
-func (cap *CollectorActivePlayerModel) Insert(tx *sqlx.Tx, runID, playerID, rank, rankImprovement int, gameTime, gameTimeImprovement, sinceGameTime float64, sinceDeaths int) error {
-	stmt := `
-		INSERT INTO collector_active_player (collector_run_id, collector_player_id, rank, rank_improvement, game_time, game_time_improvement, since_game_time, since_deaths)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
-	_, err := tx.Exec(stmt, runID, playerID, rank, rankImprovement, gameTime, gameTimeImprovement, sinceGameTime, sinceDeaths)
-	if err != nil {
+// InsertMany inserts the players in batches
+func (cap *CollectorActivePlayerModel) InsertMany(tx *sqlx.Tx, players []*models.CollectorActivePlayer) error {
+	const columns = 8
+	return batches(len(players), columns, func(from, to int) error {
+		stmt := `
+			INSERT INTO collector_active_player (collector_run_id, collector_player_id, rank, rank_improvement, game_time, game_time_improvement, since_game_time, since_deaths)
+			VALUES ` + batchValues(to-from, columns)
+		args := make([]interface{}, 0, (to-from)*columns)
+		for _, p := range players[from:to] {
+			args = append(args, p.CollectorRunID, p.CollectorPlayerID, p.Rank, p.RankImprovement, p.GameTime, p.GameTimeImprovement, p.SinceGameTime, int(p.SinceDeaths))
+		}
+		_, err := tx.Exec(stmt, args...)
 		return err
-	}
-	return nil
+	})
 }
 
 func (cap *CollectorActivePlayerModel) Select(runID int) ([]*models.CollectorActivePlayer, error) {
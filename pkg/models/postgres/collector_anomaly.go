@@ -0,0 +1,126 @@
+package postgres
+
+import (
+	"sort"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+	"github.com/jmoiron/sqlx"
+)
+
+type CollectorAnomalyModel struct {
+	DB *sqlx.DB
+}
+
+// InsertMany inserts the anomalies in batches. Anomalies which were already
+// flagged, by a run which was resumed, are skipped.
+func (cam *CollectorAnomalyModel) InsertMany(tx *sqlx.Tx, anomalies []*models.CollectorAnomaly) error {
+	const columns = 6
+	return batches(len(anomalies), columns, func(from, to int) error {
+		stmt := `
+			INSERT INTO collector_anomaly(collector_run_id, collector_player_id, rule, detail, game_time, previous_game_time)
+			VALUES ` + batchValues(to-from, columns) + `
+			ON CONFLICT (collector_run_id, collector_player_id, rule) DO NOTHING`
+		args := make([]interface{}, 0, (to-from)*columns)
+		for _, a := range anomalies[from:to] {
+			args = append(args, a.CollectorRunID, a.CollectorPlayerID, a.Rule, a.Detail, a.GameTime, a.PreviousGameTime)
+		}
+		_, err := tx.Exec(stmt, args...)
+		return err
+	})
+}
+
+// Select returns the most recent anomalies with the review status, or of any
+// status if it is empty
+func (cam *CollectorAnomalyModel) Select(status string, limit int) ([]*models.CollectorAnomaly, error) {
+	anomalies := []*models.CollectorAnomaly{}
+	stmt := `
+		SELECT
+			collector_anomaly.id,
+			collector_run_id,
+			collector_player_id,
+			collector_player.player_name AS collector_player_name,
+			rule,
+			detail,
+			collector_anomaly.game_time,
+			previous_game_time,
+			status,
+			time_stamp,
+			reviewed_at
+		FROM collector_anomaly
+		JOIN collector_player ON collector_player_id=collector_player.id
+		WHERE $1='' OR status=$1
+		ORDER BY collector_anomaly.id DESC
+		LIMIT $2`
+	err := cam.DB.Select(&anomalies, stmt, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	return anomalies, nil
+}
+
+// Review sets the review status of the anomaly
+func (cam *CollectorAnomalyModel) Review(id int, status string) error {
+	switch status {
+	case models.AnomalyPending, models.AnomalyConfirmed, models.AnomalyDismissed:
+	default:
+		return models.ErrInvalidAnomalyStatus
+	}
+	stmt := `
+		UPDATE collector_anomaly
+		SET
+			status=$2,
+			reviewed_at=CASE WHEN $2='pending' THEN NULL ELSE NOW() END
+		WHERE id=$1`
+	res, err := cam.DB.Exec(stmt, id, status)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+// ClaimUnannounced marks up to limit of the anomalies which haven't been
+// announced as announced and returns them, oldest first. Each anomaly is only
+// claimed once, even with more than one server announcing them.
+func (cam *CollectorAnomalyModel) ClaimUnannounced(limit int) ([]*models.CollectorAnomaly, error) {
+	anomalies := []*models.CollectorAnomaly{}
+	stmt := `
+		UPDATE collector_anomaly
+		SET announced=TRUE
+		FROM collector_player
+		WHERE collector_player_id=collector_player.id
+		AND collector_anomaly.id IN (
+			SELECT id
+			FROM collector_anomaly
+			WHERE announced=FALSE
+			ORDER BY id ASC
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING
+			collector_anomaly.id,
+			collector_run_id,
+			collector_player_id,
+			collector_player.player_name AS collector_player_name,
+			rule,
+			detail,
+			collector_anomaly.game_time,
+			previous_game_time,
+			status,
+			time_stamp,
+			reviewed_at`
+	err := cam.DB.Select(&anomalies, stmt, limit)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(anomalies, func(i, j int) bool {
+		return anomalies[i].ID < anomalies[j].ID
+	})
+	return anomalies, nil
+}
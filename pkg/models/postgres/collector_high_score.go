@@ -12,15 +12,20 @@ type CollectorHighScoreModel struct {
 	DB *sqlx.DB
 }
 
-func (crsm *CollectorHighScoreModel) Insert(tx *sqlx.Tx, collectorRunID, collectorPlayerID int, score float64) error {
-	stmt := `
-		INSERT INTO collector_high_score(collector_run_id, collector_player_id, score)
-		VALUES ($1, $2, $3)`
-	_, err := tx.Exec(stmt, collectorRunID, collectorPlayerID, score)
-	if err != nil {
+// InsertMany inserts the high scores in batches
+func (crsm *CollectorHighScoreModel) InsertMany(tx *sqlx.Tx, scores []*models.CollectorHighScore) error {
+	const columns = 3
+	return batches(len(scores), columns, func(from, to int) error {
+		stmt := `
+			INSERT INTO collector_high_score(collector_run_id, collector_player_id, score)
+			VALUES ` + batchValues(to-from, columns)
+		args := make([]interface{}, 0, (to-from)*columns)
+		for _, s := range scores[from:to] {
+			args = append(args, s.CollectorRunID, s.CollectorPlayerID, s.Score)
+		}
+		_, err := tx.Exec(stmt, args...)
 		return err
-	}
-	return nil
+	})
 }
 
 func (crsm *CollectorHighScoreModel) Select(collectorRunID int) ([]*models.CollectorHighScore, error) {
@@ -12,15 +12,20 @@ type CollectorNewPlayerModel struct {
 	DB *sqlx.DB
 }
 
-func (cnp *CollectorNewPlayerModel) Insert(tx *sqlx.Tx, runID, playerID, rank int, gameTime float64) error {
-	stmt := `
-		INSERT INTO collector_new_player (collector_run_id, collector_player_id, rank, game_time)
-		VALUES ($1, $2, $3, $4)`
-	_, err := tx.Exec(stmt, runID, playerID, rank, gameTime)
-	if err != nil {
+// InsertMany inserts the players in batches
+func (cnp *CollectorNewPlayerModel) InsertMany(tx *sqlx.Tx, players []*models.CollectorNewPlayer) error {
+	const columns = 4
+	return batches(len(players), columns, func(from, to int) error {
+		stmt := `
+			INSERT INTO collector_new_player (collector_run_id, collector_player_id, rank, game_time)
+			VALUES ` + batchValues(to-from, columns)
+		args := make([]interface{}, 0, (to-from)*columns)
+		for _, p := range players[from:to] {
+			args = append(args, p.CollectorRunID, p.CollectorPlayerID, p.Rank, p.GameTime)
+		}
+		_, err := tx.Exec(stmt, args...)
 		return err
-	}
-	return nil
+	})
 }
 
 func (cnp *CollectorNewPlayerModel) Select(runID int) ([]*models.CollectorNewPlayer, error) {
@@ -3,13 +3,10 @@ package postgres
 import (
 	"database/sql"
 	"errors"
-	"fmt"
-	"time"
-
-	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
 
 	"github.com/alexwilkerson/ddstats-server/pkg/models"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type CollectorPlayerModel struct {
@@ -32,79 +29,100 @@ func (cpm *CollectorPlayerModel) Select(playerID int) (*models.CollectorPlayer,
 	return &collectorPlayer, nil
 }
 
-func (cpm *CollectorPlayerModel) NewPlayer(tx *sqlx.Tx, collectorPlayerID int) error {
+// SelectMany returns the players with the IDs, by ID. Players who aren't
+// found are left out.
+func (cpm *CollectorPlayerModel) SelectMany(tx *sqlx.Tx, playerIDs []int) (map[int]*models.CollectorPlayer, error) {
+	var collectorPlayers []*models.CollectorPlayer
 	stmt := `
-		INSERT INTO collector_player(id)
-		VALUES ($1)
-		ON CONFLICT (id)
-		DO NOTHING`
-	_, err := tx.Exec(stmt, collectorPlayerID)
+		SELECT *
+		FROM collector_player
+		WHERE id=ANY($1)`
+	err := tx.Select(&collectorPlayers, stmt, pq.Array(playerIDs))
 	if err != nil {
-		return err
+		return nil, err
+	}
+	players := make(map[int]*models.CollectorPlayer, len(collectorPlayers))
+	for _, p := range collectorPlayers {
+		players[p.ID] = p
 	}
-	return nil
+	return players, nil
 }
 
-func (cpm *CollectorPlayerModel) UpsertPlayer(tx *sqlx.Tx, player *ddapi.Player, collectorRunID int, lastActive *time.Time) error {
+// SelectWorldRecord returns the best game time of the players, or 0 if there
+// are none
+func (cpm *CollectorPlayerModel) SelectWorldRecord(tx *sqlx.Tx) (float64, error) {
+	var worldRecord float64
 	stmt := `
-		INSERT INTO collector_player(
-			id,
-			player_name,
-			last_active,
-			rank,
-			game_time,
-			death_type,
-			gems,
-			daggers_hit,
-			daggers_fired,
-			enemies_killed,
-			overall_game_time,
-			overall_deaths,
-			overall_gems,
-			overall_enemies_killed,
-			overall_daggers_hit,
-			overall_daggers_fired
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
-		ON CONFLICT (id) DO
-		UPDATE SET
-			id=$1,
-			player_name=$2,
-			last_active=$3,
-			rank=$4,
-			game_time=$5,
-			death_type=$6,
-			gems=$7,
-			daggers_hit=$8,
-			daggers_fired=$9,
-			enemies_killed=$10,
-			overall_game_time=$11,
-			overall_deaths=$12,
-			overall_gems=$13,
-			overall_enemies_killed=$14,
-			overall_daggers_hit=$15,
-			overall_daggers_fired=$16
-		WHERE collector_player.id=$1`
-	_, err := tx.Exec(stmt,
-		player.PlayerID,
-		player.PlayerName,
-		lastActive,
-		player.Rank,
-		player.GameTime,
-		player.DeathType,
-		player.Gems,
-		player.DaggersHit,
-		player.DaggersFired,
-		player.EnemiesKilled,
-		player.OverallGameTime,
-		player.OverallDeaths,
-		player.OverallGems,
-		player.OverallEnemiesKilled,
-		player.OverallDaggersHit,
-		player.OverallDaggersFired,
-	)
-	if err != nil {
-		fmt.Println("upsert:", err)
+		SELECT COALESCE(MAX(game_time), 0)
+		FROM collector_player`
+	err := tx.Get(&worldRecord, stmt)
+	return worldRecord, err
+}
+
+// UpsertMany inserts or updates the players in batches. The IDs of the players
+// must be unique. A player's last_active is kept if they are upserted without
+// one.
+func (cpm *CollectorPlayerModel) UpsertMany(tx *sqlx.Tx, players []*models.CollectorPlayer) error {
+	const columns = 16
+	return batches(len(players), columns, func(from, to int) error {
+		stmt := `
+			INSERT INTO collector_player(
+				id,
+				player_name,
+				last_active,
+				rank,
+				game_time,
+				death_type,
+				gems,
+				daggers_hit,
+				daggers_fired,
+				enemies_killed,
+				overall_game_time,
+				overall_deaths,
+				overall_gems,
+				overall_enemies_killed,
+				overall_daggers_hit,
+				overall_daggers_fired
+			) VALUES ` + batchValues(to-from, columns) + `
+			ON CONFLICT (id) DO
+			UPDATE SET
+				player_name=EXCLUDED.player_name,
+				last_active=COALESCE(EXCLUDED.last_active, collector_player.last_active),
+				rank=EXCLUDED.rank,
+				game_time=EXCLUDED.game_time,
+				death_type=EXCLUDED.death_type,
+				gems=EXCLUDED.gems,
+				daggers_hit=EXCLUDED.daggers_hit,
+				daggers_fired=EXCLUDED.daggers_fired,
+				enemies_killed=EXCLUDED.enemies_killed,
+				overall_game_time=EXCLUDED.overall_game_time,
+				overall_deaths=EXCLUDED.overall_deaths,
+				overall_gems=EXCLUDED.overall_gems,
+				overall_enemies_killed=EXCLUDED.overall_enemies_killed,
+				overall_daggers_hit=EXCLUDED.overall_daggers_hit,
+				overall_daggers_fired=EXCLUDED.overall_daggers_fired`
+		args := make([]interface{}, 0, (to-from)*columns)
+		for _, p := range players[from:to] {
+			args = append(args,
+				p.ID,
+				p.PlayerName,
+				p.LastActive,
+				p.Rank,
+				p.GameTime,
+				p.DeathType,
+				p.Gems,
+				p.DaggersHit,
+				p.DaggersFired,
+				p.EnemiesKilled,
+				p.OverallGameTime,
+				p.OverallDeaths,
+				p.OverallGems,
+				p.OverallEnemiesKilled,
+				p.OverallDaggersHit,
+				p.OverallDaggersFired,
+			)
+		}
+		_, err := tx.Exec(stmt, args...)
 		return err
-	}
-	return nil
+	})
 }
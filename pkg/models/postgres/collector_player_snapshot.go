@@ -0,0 +1,131 @@
+package postgres
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type CollectorPlayerSnapshotModel struct {
+	DB *sqlx.DB
+}
+
+// partition is the name of the partition holding the snapshots of the runs
+// started in the month of t
+func (cpsm *CollectorPlayerSnapshotModel) partition(t time.Time) string {
+	return fmt.Sprintf("collector_player_snapshot_%s", t.UTC().Format("2006_01"))
+}
+
+// CreatePartition creates the partition for the snapshots of the runs started
+// in the month of t, if it doesn't exist yet
+func (cpsm *CollectorPlayerSnapshotModel) CreatePartition(tx *sqlx.Tx, t time.Time) error {
+	t = t.UTC()
+	from := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	stmt := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s
+		PARTITION OF collector_player_snapshot
+		FOR VALUES FROM ('%s') TO ('%s')`, cpsm.partition(t), from.Format(time.RFC3339), from.AddDate(0, 1, 0).Format(time.RFC3339))
+	_, err := tx.Exec(stmt)
+	return err
+}
+
+// InsertMany inserts the snapshots in batches. A player who already has a
+// snapshot for the run keeps it.
+func (cpsm *CollectorPlayerSnapshotModel) InsertMany(tx *sqlx.Tx, snapshots []*models.CollectorPlayerSnapshot) error {
+	const columns = 7
+	return batches(len(snapshots), columns, func(from, to int) error {
+		stmt := `
+			INSERT INTO collector_player_snapshot (collector_run_id, time_stamp, collector_player_id, rank, game_time, overall_deaths, overall_game_time)
+			VALUES ` + batchValues(to-from, columns) + `
+			ON CONFLICT DO NOTHING`
+		args := make([]interface{}, 0, (to-from)*columns)
+		for _, s := range snapshots[from:to] {
+			args = append(args, s.CollectorRunID, s.TimeStamp, s.CollectorPlayerID, s.Rank, s.GameTime, s.OverallDeaths, s.OverallGameTime)
+		}
+		_, err := tx.Exec(stmt, args...)
+		return err
+	})
+}
+
+// Select returns the player's snapshots from finished runs between from and
+// to, oldest first. The activity of the first snapshot is measured from the
+// snapshot before it, even if that one is before from. Only the partitions
+// from that snapshot on are read.
+func (cpsm *CollectorPlayerSnapshotModel) Select(playerID int, from, to time.Time) ([]*models.CollectorPlayerSnapshot, error) {
+	snapshots := []*models.CollectorPlayerSnapshot{}
+	stmt := `
+		SELECT *
+		FROM (
+			SELECT
+				collector_run_id,
+				collector_player_snapshot.time_stamp,
+				collector_player_id,
+				rank,
+				ROUND(game_time::numeric, 4) AS game_time,
+				overall_deaths,
+				ROUND(overall_game_time::numeric, 4) AS overall_game_time,
+				COALESCE(overall_deaths - LAG(overall_deaths) OVER w, 0) AS since_deaths,
+				ROUND(COALESCE(overall_game_time - LAG(overall_game_time) OVER w, 0)::numeric, 4) AS since_game_time
+			FROM collector_player_snapshot
+			JOIN collector_run ON collector_run_id=collector_run.id
+			WHERE collector_player_id=$1 AND run_time != 0
+			AND collector_player_snapshot.time_stamp <= $3
+			AND collector_player_snapshot.time_stamp >= COALESCE((
+				SELECT MAX(time_stamp)
+				FROM collector_player_snapshot
+				WHERE collector_player_id=$1 AND time_stamp < $2
+			), $2)
+			WINDOW w AS (ORDER BY collector_player_snapshot.time_stamp)
+		) AS history
+		WHERE time_stamp >= $2
+		ORDER BY time_stamp ASC`
+	err := cpsm.DB.Select(&snapshots, stmt, playerID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+// Prune downsamples the snapshots of finished runs from before keepAllAfter
+// to the first run of every week, deleting the snapshots of the other runs
+// from their month's partition. It returns the number of runs whose snapshots
+// were deleted.
+func (cpsm *CollectorPlayerSnapshotModel) Prune(keepAllAfter time.Time) (int, error) {
+	var runIDs []int64
+	// only runs which still have snapshots are pruned, so that the
+	// partitions which were already downsampled aren't scanned again
+	stmt := `
+		SELECT id
+		FROM collector_run
+		WHERE run_time != 0 AND time_stamp < $1
+		AND id NOT IN (
+			SELECT DISTINCT ON (date_trunc('week', time_stamp)) id
+			FROM collector_run
+			WHERE run_time != 0
+			ORDER BY date_trunc('week', time_stamp), time_stamp
+		)
+		AND EXISTS (
+			SELECT 1
+			FROM collector_player_snapshot
+			WHERE collector_run_id=collector_run.id
+			AND collector_player_snapshot.time_stamp=collector_run.time_stamp
+		)`
+	err := cpsm.DB.Select(&runIDs, stmt, keepAllAfter)
+	if err != nil {
+		return 0, err
+	}
+	if len(runIDs) == 0 {
+		return 0, nil
+	}
+	stmt = `
+		DELETE FROM collector_player_snapshot
+		WHERE collector_run_id=ANY($1) AND time_stamp < $2`
+	_, err = cpsm.DB.Exec(stmt, pq.Array(runIDs), keepAllAfter)
+	if err != nil {
+		return 0, err
+	}
+	return len(runIDs), nil
+}
@@ -0,0 +1,128 @@
+package postgres
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+	"github.com/lib/pq"
+)
+
+// collectorRollupTotals sums up the finished runs started from $2 up to $3,
+// grouped by the start of their period, which may depend on $1
+const collectorRollupTotals = `
+	SELECT
+		%s AS start,
+		COUNT(*) AS runs,
+		COALESCE(SUM(new_players), 0) AS new_players,
+		ROUND(COALESCE(SUM(since_game_time), 0)::numeric, 4) AS game_time,
+		COALESCE(SUM(since_deaths), 0) AS deaths,
+		COALESCE(SUM(since_gems), 0) AS gems,
+		COALESCE(SUM(since_enemies_killed), 0) AS enemies_killed,
+		COALESCE(SUM(since_bronze_daggers), 0) AS bronze_daggers,
+		COALESCE(SUM(since_silver_daggers), 0) AS silver_daggers,
+		COALESCE(SUM(since_gold_daggers), 0) AS gold_daggers,
+		COALESCE(SUM(since_devil_daggers), 0) AS devil_daggers,
+		COALESCE(MAX(id), 0) AS last_run_id
+	FROM collector_run
+	WHERE run_time != 0 AND time_stamp >= $2 AND time_stamp < $3
+	GROUP BY 1`
+
+// collectorRollupActivePlayers counts the players who were active in the
+// finished runs started from $2 up to $3, grouped by the start of their
+// period. Players who were active in more than one run are counted once.
+const collectorRollupActivePlayers = `
+	SELECT
+		%s AS start,
+		COUNT(DISTINCT collector_player_id) AS active_players
+	FROM collector_active_player
+	JOIN collector_run ON collector_run_id=collector_run.id
+	WHERE run_time != 0 AND time_stamp >= $2 AND time_stamp < $3
+	GROUP BY 1`
+
+// SelectRollups returns the rollups of every week or month between from and
+// to which had a finished run, oldest first. Weeks start on Monday, and weeks
+// and months start at midnight UTC.
+func (crm *CollectorRunModel) SelectRollups(period string, from, to time.Time) ([]*models.CollectorRollup, error) {
+	var next func(time.Time) time.Time
+	switch period {
+	case models.RollupWeek:
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+	case models.RollupMonth:
+		next = func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+	default:
+		return nil, models.ErrInvalidRollupPeriod
+	}
+	start := `date_trunc($1::text, time_stamp AT TIME ZONE 'UTC')`
+	rollups := []*models.CollectorRollup{}
+	err := crm.DB.Select(&rollups, crm.rollupQuery(start), period, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, rollup := range rollups {
+		rollup.Start = rollup.Start.UTC()
+		rollup.End = next(rollup.Start)
+	}
+	return rollups, crm.selectRollupDeathTypes(rollups)
+}
+
+// SelectRollup returns the rollup of the runs started between from and to
+func (crm *CollectorRunModel) SelectRollup(from, to time.Time) (*models.CollectorRollup, error) {
+	rollups := []*models.CollectorRollup{}
+	err := crm.DB.Select(&rollups, crm.rollupQuery(`$1::timestamptz`), from, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if len(rollups) == 0 {
+		rollups = append(rollups, &models.CollectorRollup{})
+	}
+	rollup := rollups[0]
+	rollup.Start = from
+	rollup.End = to
+	return rollup, crm.selectRollupDeathTypes(rollups)
+}
+
+func (crm *CollectorRunModel) rollupQuery(start string) string {
+	return `
+		SELECT totals.*, COALESCE(active.active_players, 0) AS active_players
+		FROM (` + fmt.Sprintf(collectorRollupTotals, start) + `) AS totals
+		LEFT JOIN (` + fmt.Sprintf(collectorRollupActivePlayers, start) + `) AS active
+		ON totals.start=active.start
+		ORDER BY totals.start ASC`
+}
+
+// selectRollupDeathTypes sets the DeathTypes of the rollups to those of their
+// last runs
+func (crm *CollectorRunModel) selectRollupDeathTypes(rollups []*models.CollectorRollup) error {
+	runIDs := make([]int, 0, len(rollups))
+	for _, rollup := range rollups {
+		rollup.DeathTypes = map[string]int{}
+		runIDs = append(runIDs, rollup.LastRunID)
+	}
+	var counts []struct {
+		CollectorRunID int    `db:"collector_run_id"`
+		DeathType      string `db:"death_type"`
+		Count          int    `db:"count"`
+	}
+	stmt := `
+		SELECT collector_run_id, death_type, count
+		FROM collector_run_death_type
+		WHERE collector_run_id=ANY($1)`
+	err := crm.DB.Select(&counts, stmt, pq.Array(runIDs))
+	if err != nil {
+		return err
+	}
+	deathTypes := make(map[int]map[string]int)
+	for _, c := range counts {
+		if deathTypes[c.CollectorRunID] == nil {
+			deathTypes[c.CollectorRunID] = map[string]int{}
+		}
+		deathTypes[c.CollectorRunID][c.DeathType] = c.Count
+	}
+	for _, rollup := range rollups {
+		if counts, ok := deathTypes[rollup.LastRunID]; ok {
+			rollup.DeathTypes = counts
+		}
+	}
+	return nil
+}
@@ -1,6 +1,11 @@
 package postgres
 
 import (
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
 	"github.com/alexwilkerson/ddstats-server/pkg/models"
 	"github.com/jmoiron/sqlx"
 )
@@ -9,21 +14,67 @@ type CollectorRunModel struct {
 	DB *sqlx.DB
 }
 
-func (crm *CollectorRunModel) CreateNew(tx *sqlx.Tx) (int, error) {
-	var id int
+// collectorRunColumns are the columns of a CollectorRun. They are listed
+// rather than selected with *, which fails to scan the death type columns of a
+// database that hasn't been migrated yet.
+const collectorRunColumns = `
+		id,
+		time_stamp,
+		run_time,
+		global_players,
+		new_players,
+		active_players,
+		inactive_players,
+		players_with_new_scores,
+		players_with_new_ranks,
+		average_improvement_time,
+		average_rank_improvement,
+		average_game_time_per_active_player,
+		average_deaths_per_active_player,
+		average_gems_per_active_player,
+		average_enemies_killed_per_active_player,
+		average_daggers_hit_per_active_player,
+		average_daggers_fired_per_active_player,
+		average_accuracy_per_active_player,
+		global_game_time,
+		global_deaths,
+		global_gems,
+		global_enemies_killed,
+		global_daggers_hit,
+		global_daggers_fired,
+		global_accuracy,
+		global_default_daggers,
+		global_bronze_daggers,
+		global_silver_daggers,
+		global_gold_daggers,
+		global_devil_daggers,
+		since_game_time,
+		since_deaths,
+		since_gems,
+		since_enemies_killed,
+		since_daggers_hit,
+		since_daggers_fired,
+		since_accuracy,
+		since_bronze_daggers,
+		since_silver_daggers,
+		since_gold_daggers,
+		since_devil_daggers`
+
+func (crm *CollectorRunModel) CreateNew(tx *sqlx.Tx) (*models.CollectorRun, error) {
+	var cr models.CollectorRun
 	stmt := `
-		INSERT INTO collector_run DEFAULT VALUES returning id`
-	err := tx.Get(&id, stmt)
+		INSERT INTO collector_run DEFAULT VALUES returning id, time_stamp`
+	err := tx.Get(&cr, stmt)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return id, nil
+	return &cr, nil
 }
 
 func (crm *CollectorRunModel) SelectLastRunID() (*models.CollectorRun, error) {
 	var cr models.CollectorRun
 	stmt := `
-		SELECT *
+		SELECT` + collectorRunColumns + `
 		FROM collector_run
 		WHERE run_time != 0
 		ORDER BY time_stamp DESC LIMIT 1`
@@ -34,6 +85,27 @@ func (crm *CollectorRunModel) SelectLastRunID() (*models.CollectorRun, error) {
 	return &cr, nil
 }
 
+// Select returns the run with the ID, finished or not
+func (crm *CollectorRunModel) Select(id int) (*models.CollectorRun, error) {
+	var cr models.CollectorRun
+	stmt := `
+		SELECT` + collectorRunColumns + `
+		FROM collector_run
+		WHERE id=$1`
+	err := crm.DB.Get(&cr, stmt, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		}
+		return nil, err
+	}
+	err = crm.selectDeathTypes(&cr)
+	if err != nil {
+		return nil, err
+	}
+	return &cr, nil
+}
+
 func (crm *CollectorRunModel) Update(tx *sqlx.Tx, cr *models.CollectorRun) error {
 	stmt := `
 		UPDATE collector_run
@@ -76,24 +148,8 @@ func (crm *CollectorRunModel) Update(tx *sqlx.Tx, cr *models.CollectorRun) error
 			since_bronze_daggers=$36,
 			since_silver_daggers=$37,
 			since_gold_daggers=$38,
-			since_devil_daggers=$39,
-			fallen=$40,
-			swarmed=$41,
-			impaled=$42,
-			gored=$43,
-			infested=$44,
-			opened=$45,
-			purged=$46,
-			desecrated=$47,
-			sacrificed=$48,
-			eviscerated=$49,
-			annihilated=$50,
-			intoxicated=$51,
-			envenmonated=$52,
-			incarnated=$53,
-			discarnated=$54,
-			barbed=$55
-		WHERE id=$56`
+			since_devil_daggers=$39
+		WHERE id=$40`
 	_, err := tx.Exec(stmt,
 		cr.RunTime,
 		cr.GlobalPlayers,
@@ -134,25 +190,57 @@ func (crm *CollectorRunModel) Update(tx *sqlx.Tx, cr *models.CollectorRun) error
 		cr.SinceSilverDaggers,
 		cr.SinceGoldDaggers,
 		cr.SinceDevilDaggers,
-		cr.Fallen,
-		cr.Swarmed,
-		cr.Impaled,
-		cr.Gored,
-		cr.Infested,
-		cr.Opened,
-		cr.Purged,
-		cr.Desecrated,
-		cr.Sacrificed,
-		cr.Eviscerated,
-		cr.Annihilated,
-		cr.Intoxicated,
-		cr.Envenmonated,
-		cr.Incarnated,
-		cr.Discarnated,
-		cr.Barbed,
 		cr.ID,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	return crm.updateDeathTypes(tx, cr)
+}
+
+// updateDeathTypes writes the death type counts of the run in DeathTypes. A
+// run's counts only grow, so a death type which isn't in DeathTypes keeps its
+// count.
+func (crm *CollectorRunModel) updateDeathTypes(tx *sqlx.Tx, cr *models.CollectorRun) error {
+	deathTypes := make([]string, 0, len(cr.DeathTypes))
+	for deathType := range cr.DeathTypes {
+		deathTypes = append(deathTypes, deathType)
+	}
+	sort.Strings(deathTypes)
+	const columns = 3
+	return batches(len(deathTypes), columns, func(from, to int) error {
+		stmt := `
+			INSERT INTO collector_run_death_type(collector_run_id, death_type, count)
+			VALUES ` + batchValues(to-from, columns) + `
+			ON CONFLICT (collector_run_id, death_type) DO UPDATE SET count=EXCLUDED.count`
+		args := make([]interface{}, 0, (to-from)*columns)
+		for _, deathType := range deathTypes[from:to] {
+			args = append(args, cr.ID, deathType, cr.DeathTypes[deathType])
+		}
+		_, err := tx.Exec(stmt, args...)
+		return err
+	})
+}
+
+// selectDeathTypes sets the DeathTypes of the run from the database
+func (crm *CollectorRunModel) selectDeathTypes(cr *models.CollectorRun) error {
+	var counts []struct {
+		DeathType string `db:"death_type"`
+		Count     int    `db:"count"`
+	}
+	stmt := `
+		SELECT death_type, count
+		FROM collector_run_death_type
+		WHERE collector_run_id=$1`
+	err := crm.DB.Select(&counts, stmt, cr.ID)
+	if err != nil {
+		return err
+	}
+	cr.DeathTypes = make(map[string]int, len(counts))
+	for _, c := range counts {
+		cr.DeathTypes[c.DeathType] = c.Count
+	}
+	return nil
 }
 
 func (crm *CollectorRunModel) InsertNew(tx *sqlx.Tx) (int, error) {
@@ -168,69 +256,83 @@ func (crm *CollectorRunModel) InsertNew(tx *sqlx.Tx) (int, error) {
 	return id, nil
 }
 
+// collectorRunSummary selects finished runs the way they are shown, rounded
+const collectorRunSummary = `
+	SELECT
+		id,
+		time_stamp,
+		global_players,
+		new_players,
+		active_players,
+		inactive_players,
+		players_with_new_scores,
+		players_with_new_ranks,
+		ROUND(average_improvement_time, 4) AS average_improvement_time,
+		average_rank_improvement,
+		ROUND(average_game_time_per_active_player, 4) AS average_game_time_per_active_player,
+		ROUND(average_deaths_per_active_player, 2) AS average_deaths_per_active_player,
+		ROUND(average_gems_per_active_player, 2) AS average_gems_per_active_player,
+		ROUND(average_enemies_killed_per_active_player, 2) AS average_enemies_killed_per_active_player,
+		ROUND(average_daggers_hit_per_active_player, 2) AS average_daggers_hit_per_active_player,
+		ROUND(average_daggers_fired_per_active_player, 2) AS average_daggers_fired_per_active_player,
+		ROUND(average_accuracy_per_active_player, 2) AS average_accuracy_per_active_player,
+		ROUND(global_game_time, 4) AS global_game_time,
+		global_deaths,
+		global_gems,
+		global_enemies_killed,
+		global_daggers_hit,
+		global_daggers_fired,
+		ROUND(global_accuracy, 2) AS global_accuracy,
+		global_default_daggers,
+		global_bronze_daggers,
+		global_silver_daggers,
+		global_gold_daggers,
+		global_devil_daggers,
+		ROUND(since_game_time, 4) AS since_game_time,
+		since_deaths,
+		since_gems,
+		since_enemies_killed,
+		since_daggers_hit,
+		since_daggers_fired,
+		ROUND(since_accuracy, 2) AS since_accuracy,
+		since_bronze_daggers,
+		since_silver_daggers,
+		since_gold_daggers,
+		since_devil_daggers
+	FROM collector_run`
+
+// SelectMostRecent returns the summary of the most recent finished run
 func (crm *CollectorRunModel) SelectMostRecent() (*models.CollectorRun, error) {
+	return crm.selectSummary(`
+		WHERE run_time != 0
+		ORDER BY id DESC LIMIT 1`)
+}
+
+// SelectSummary returns the summary of the finished run with the ID
+func (crm *CollectorRunModel) SelectSummary(id int) (*models.CollectorRun, error) {
+	return crm.selectSummary(`
+		WHERE run_time != 0 AND id=$1`, id)
+}
+
+// SelectSummaryOnDate returns the summary of the last finished run started on
+// the date, in UTC
+func (crm *CollectorRunModel) SelectSummaryOnDate(date time.Time) (*models.CollectorRun, error) {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	return crm.selectSummary(`
+		WHERE run_time != 0 AND time_stamp >= $1 AND time_stamp < $2
+		ORDER BY id DESC LIMIT 1`, day, day.AddDate(0, 0, 1))
+}
+
+func (crm *CollectorRunModel) selectSummary(where string, args ...interface{}) (*models.CollectorRun, error) {
 	var run models.CollectorRun
-	stmt := `
-		SELECT 
-			id,
-			time_stamp,
-			global_players,
-			new_players,
-			active_players,
-			inactive_players,
-			players_with_new_scores,
-			players_with_new_ranks,
-			ROUND(average_improvement_time, 4) AS average_improvement_time,
-			average_rank_improvement,
-			ROUND(average_game_time_per_active_player, 4) AS average_game_time_per_active_player,
-			ROUND(average_deaths_per_active_player, 2) AS average_deaths_per_active_player,
-			ROUND(average_gems_per_active_player, 2) AS average_gems_per_active_player,
-			ROUND(average_enemies_killed_per_active_player, 2) AS average_enemies_killed_per_active_player,
-			ROUND(average_daggers_hit_per_active_player, 2) AS average_daggers_hit_per_active_player,
-			ROUND(average_daggers_fired_per_active_player, 2) AS average_daggers_fired_per_active_player,
-			ROUND(average_accuracy_per_active_player, 2) AS average_accuracy_per_active_player,
-			ROUND(global_game_time, 4) AS global_game_time,
-			global_deaths,
-			global_gems,
-			global_enemies_killed,
-			global_daggers_hit,
-			global_daggers_fired,
-			ROUND(global_accuracy, 2) AS global_accuracy,
-			global_default_daggers,
-			global_bronze_daggers,
-			global_silver_daggers,
-			global_gold_daggers,
-			global_devil_daggers,
-			ROUND(since_game_time, 4) AS since_game_time,
-			since_deaths,
-			since_gems,
-			since_enemies_killed,
-			since_daggers_hit,
-			since_daggers_fired,
-			ROUND(since_accuracy, 2) AS since_accuracy,
-			since_bronze_daggers,
-			since_silver_daggers,
-			since_gold_daggers,
-			since_devil_daggers,
-			fallen,
-			swarmed,
-			impaled,
-			gored,
-			infested,
-			opened,
-			purged,
-			desecrated,
-			sacrificed,
-			eviscerated,
-			annihilated,
-			intoxicated,
-			envenmonated,
-			incarnated,
-			discarnated,
-			barbed
-		FROM collector_run
-		ORDER BY id DESC LIMIT 1`
-	err := crm.DB.Get(&run, stmt)
+	err := crm.DB.Get(&run, collectorRunSummary+where, args...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		}
+		return nil, err
+	}
+	err = crm.selectDeathTypes(&run)
 	if err != nil {
 		return nil, err
 	}
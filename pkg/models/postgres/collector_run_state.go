@@ -0,0 +1,99 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+	"github.com/jmoiron/sqlx"
+)
+
+type CollectorRunStateModel struct {
+	DB *sqlx.DB
+}
+
+// SelectUnfinished returns the state of the latest run which hasn't finished
+func (crsm *CollectorRunStateModel) SelectUnfinished() (*models.CollectorRunState, error) {
+	var state models.CollectorRunState
+	stmt := `
+		SELECT *
+		FROM collector_run_state
+		ORDER BY collector_run_id DESC LIMIT 1`
+	err := crsm.DB.Get(&state, stmt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		}
+		return nil, err
+	}
+	return &state, nil
+}
+
+// Upsert checkpoints the state of a run
+func (crsm *CollectorRunStateModel) Upsert(tx *sqlx.Tx, state *models.CollectorRunState) error {
+	stmt := `
+		INSERT INTO collector_run_state(
+			collector_run_id,
+			next_rank,
+			run_time,
+			total_players,
+			active_players,
+			players_with_new_scores,
+			players_with_new_ranks,
+			player_improvement_time,
+			player_rank_improvement,
+			player_game_time,
+			player_deaths,
+			player_gems,
+			player_enemies_killed,
+			player_daggers_hit,
+			player_daggers_fired,
+			world_record
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		ON CONFLICT (collector_run_id) DO UPDATE
+		SET
+			next_rank=EXCLUDED.next_rank,
+			run_time=EXCLUDED.run_time,
+			total_players=EXCLUDED.total_players,
+			active_players=EXCLUDED.active_players,
+			players_with_new_scores=EXCLUDED.players_with_new_scores,
+			players_with_new_ranks=EXCLUDED.players_with_new_ranks,
+			player_improvement_time=EXCLUDED.player_improvement_time,
+			player_rank_improvement=EXCLUDED.player_rank_improvement,
+			player_game_time=EXCLUDED.player_game_time,
+			player_deaths=EXCLUDED.player_deaths,
+			player_gems=EXCLUDED.player_gems,
+			player_enemies_killed=EXCLUDED.player_enemies_killed,
+			player_daggers_hit=EXCLUDED.player_daggers_hit,
+			player_daggers_fired=EXCLUDED.player_daggers_fired,
+			world_record=EXCLUDED.world_record`
+	_, err := tx.Exec(stmt,
+		state.CollectorRunID,
+		state.NextRank,
+		state.RunTime,
+		state.TotalPlayers,
+		state.ActivePlayers,
+		state.PlayersWithNewScores,
+		state.PlayersWithNewRanks,
+		state.PlayerImprovementTime,
+		state.PlayerRankImprovement,
+		state.PlayerGameTime,
+		state.PlayerDeaths,
+		state.PlayerGems,
+		state.PlayerEnemiesKilled,
+		state.PlayerDaggersHit,
+		state.PlayerDaggersFired,
+		state.WorldRecord,
+	)
+	return err
+}
+
+// Delete removes the state of a run once it has finished
+func (crsm *CollectorRunStateModel) Delete(tx *sqlx.Tx, collectorRunID int) error {
+	stmt := `
+		DELETE FROM collector_run_state
+		WHERE collector_run_id=$1`
+	_, err := tx.Exec(stmt, collectorRunID)
+	return err
+}
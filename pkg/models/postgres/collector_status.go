@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// collectorLockID is the key of the advisory lock held by the running
+// collector
+const collectorLockID = 0x64647374
+
+type CollectorStatusModel struct {
+	DB *sqlx.DB
+}
+
+// Select returns the status of the collector
+func (csm *CollectorStatusModel) Select() (*models.CollectorStatus, error) {
+	var status models.CollectorStatus
+	stmt := `
+		SELECT running, last_started, last_success, last_duration, last_error, next_run
+		FROM collector_status
+		WHERE id=1`
+	err := csm.DB.Get(&status, stmt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		}
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Upsert replaces the status of the collector
+func (csm *CollectorStatusModel) Upsert(status *models.CollectorStatus) error {
+	stmt := `
+		INSERT INTO collector_status(id, running, last_started, last_success, last_duration, last_error, next_run)
+		VALUES (1, $1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE
+		SET
+			running=EXCLUDED.running,
+			last_started=EXCLUDED.last_started,
+			last_success=EXCLUDED.last_success,
+			last_duration=EXCLUDED.last_duration,
+			last_error=EXCLUDED.last_error,
+			next_run=EXCLUDED.next_run`
+	_, err := csm.DB.Exec(stmt,
+		status.Running,
+		status.LastStarted,
+		status.LastSuccess,
+		status.LastDuration,
+		status.LastError,
+		status.NextRun,
+	)
+	return err
+}
+
+// Lock takes the collector lock, which is held until unlock is called. It
+// returns models.ErrCollectorRunning if another collector holds the lock.
+func (csm *CollectorStatusModel) Lock(ctx context.Context) (unlock func() error, err error) {
+	// advisory locks belong to a session, so the lock keeps a connection
+	// out of the pool until it is released
+	conn, err := csm.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var locked bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, collectorLockID).Scan(&locked)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !locked {
+		conn.Close()
+		return nil, models.ErrCollectorRunning
+	}
+	return func() error {
+		defer conn.Close()
+		_, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, collectorLockID)
+		return err
+	}, nil
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/alexwilkerson/ddstats-server/pkg/models"
 	"github.com/jmoiron/sqlx"
@@ -769,7 +770,8 @@ func (g *GameModel) Get(id int) (*models.GameWithName, error) {
 			level_gems,
 			gems_despawned,
 			gems_eaten,
-			daggers_eaten
+			daggers_eaten,
+			source
 		FROM game JOIN player p1 ON game.player_id=p1.id JOIN death_type ON game.death_type=death_type.id
 			NATURAL LEFT JOIN spawnset
 			LEFT JOIN replay_player p2 ON game.replay_player_id=p2.id
@@ -809,3 +811,51 @@ func (g *GameModel) GetTotalCount(playerID int) (int, error) {
 	}
 	return gameCount, nil
 }
+
+// recoveredGameTolerance is how far apart, in seconds of game time, a
+// recovered game and a submitted game can be and still be the same run
+const recoveredGameTolerance = 1.0
+
+// DeleteRecovered deletes the games recovered from live states which are
+// replaced by a submitted game of the player with the given game time and
+// death type, and returns the number deleted
+func (g *GameModel) DeleteRecovered(playerID int, gameTime float64, deathType int) (int, error) {
+	stmt := `
+		DELETE FROM game
+		WHERE player_id=$1
+			AND source=$2
+			AND death_type=$3
+			AND ABS(game_time-$4) <= $5
+			AND time_stamp > CURRENT_TIMESTAMP - INTERVAL '1 day'`
+	res, err := g.DB.Exec(stmt, playerID, models.GameSourceLiveRecovered, deathType, gameTime, recoveredGameTolerance)
+	if err != nil {
+		return 0, err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(rowsAffected), nil
+}
+
+// SubmittedSince returns true if the player has submitted a game with the
+// given game time after since, meaning that a run doesn't need to be recovered
+func (g *GameModel) SubmittedSince(playerID int, gameTime float64, since time.Time) (bool, error) {
+	var id int
+	stmt := `
+		SELECT id
+		FROM game
+		WHERE player_id=$1
+			AND source<>$2
+			AND ABS(game_time-$3) <= $4
+			AND time_stamp >= $5
+		LIMIT 1`
+	err := g.DB.Get(&id, stmt, playerID, models.GameSourceLiveRecovered, gameTime, recoveredGameTolerance, since)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
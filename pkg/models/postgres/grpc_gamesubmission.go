@@ -3,7 +3,6 @@ package postgres
 import (
 	"database/sql"
 	"errors"
-	"net/http"
 
 	pb "github.com/alexwilkerson/ddstats-server/gamesubmission"
 	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
@@ -13,8 +12,8 @@ import (
 )
 
 type GameSubmissionModel struct {
-	DB     *sqlx.DB
-	Client *http.Client
+	DB    *sqlx.DB
+	DDAPI *ddapi.API
 }
 
 // CheckDuplicate takes a submitted game, checks if it's a replay...
@@ -183,8 +182,7 @@ func (gsm *GameSubmissionModel) Insert(game *pb.SubmitGameRequest) (int32, error
 	_, err = players.Get(int(game.PlayerID))
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
-			ddAPI := ddapi.API{Client: gsm.Client}
-			player, err := ddAPI.UserByID(int(game.PlayerID))
+			player, err := gsm.DDAPI.UserByID(int(game.PlayerID))
 			if err != nil {
 				return 0, err
 			}
@@ -197,5 +195,13 @@ func (gsm *GameSubmissionModel) Insert(game *pb.SubmitGameRequest) (int32, error
 		}
 	}
 
+	if !game.IsReplay {
+		games := GameModel{DB: gsm.DB}
+		_, err = games.DeleteRecovered(int(game.PlayerID), float64(game.Time), int(game.DeathType))
+		if err != nil {
+			return 0, err
+		}
+	}
+
 	return int32(gameID), nil
 }
@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// LiveModel wraps the database connection for the live table, which
+// keeps track of which players are connected to the server
+type LiveModel struct {
+	DB *sqlx.DB
+}
+
+// Upsert records that the player has logged in with the given socket ID. If the
+// player already has a row (from another connection or a previous instance of
+// the server), the row is taken over by the new socket ID.
+func (lm *LiveModel) Upsert(playerID int, sid, status string) error {
+	stmt := `
+		INSERT INTO live(player_id, sid, status, game_time, logged_in, last_seen)
+		VALUES ($1, $2, $3, 0, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT (player_id) DO
+		UPDATE SET
+			sid=$2,
+			status=$3,
+			game_time=0,
+			logged_in=CURRENT_TIMESTAMP,
+			last_seen=CURRENT_TIMESTAMP
+		WHERE live.player_id=$1`
+	_, err := lm.DB.Exec(stmt, playerID, sid, status)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// TouchMany updates the status, game time and last seen time of the players
+// in batches. Nothing is updated for a player whose row has since been taken
+// over by another socket ID.
+func (lm *LiveModel) TouchMany(players []*models.LivePlayer) error {
+	const columns = 4
+	return batches(len(players), columns, func(from, to int) error {
+		stmt := `
+			UPDATE live
+			SET
+				status=touched.status,
+				game_time=touched.game_time::DOUBLE PRECISION,
+				last_seen=CURRENT_TIMESTAMP
+			FROM (VALUES ` + batchValues(to-from, columns) + `) AS touched(player_id, sid, status, game_time)
+			WHERE live.player_id=touched.player_id::INTEGER AND live.sid=touched.sid`
+		args := make([]interface{}, 0, (to-from)*columns)
+		for _, p := range players[from:to] {
+			args = append(args, p.PlayerID, p.SID, p.Status, p.GameTime)
+		}
+		_, err := lm.DB.Exec(stmt, args...)
+		return err
+	})
+}
+
+// Delete removes the player from the live table, but only if the row still
+// belongs to the given socket ID
+func (lm *LiveModel) Delete(playerID int, sid string) error {
+	stmt := `
+		DELETE FROM live
+		WHERE player_id=$1 AND sid=$2`
+	_, err := lm.DB.Exec(stmt, playerID, sid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteStale removes every row which hasn't been seen within the given
+// duration and returns the number of rows removed
+func (lm *LiveModel) DeleteStale(olderThan time.Duration) (int, error) {
+	stmt := `
+		DELETE FROM live
+		WHERE last_seen < $1`
+	res, err := lm.DB.Exec(stmt, time.Now().Add(-olderThan))
+	if err != nil {
+		return 0, err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(rowsAffected), nil
+}
+
+// SelectAll returns every player which has been seen within the given duration
+func (lm *LiveModel) SelectAll(seenWithin time.Duration) ([]*models.LivePlayer, error) {
+	players := []*models.LivePlayer{}
+	stmt := `
+		SELECT
+			live.player_id,
+			player.player_name,
+			live.sid,
+			live.status,
+			live.game_time,
+			live.logged_in,
+			live.last_seen
+		FROM live JOIN player ON live.player_id=player.id
+		WHERE live.last_seen >= $1
+		ORDER BY live.logged_in ASC`
+	err := lm.DB.Select(&players, stmt, time.Now().Add(-seenWithin))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return players, nil
+}
@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// NotificationRuleModel wraps the database connection for players'
+// notification preferences
+type NotificationRuleModel struct {
+	DB *sqlx.DB
+}
+
+// Select returns all of the player's notification rules. A player without any
+// rules gets empty preferences, which fall back to the default milestone.
+func (nm *NotificationRuleModel) Select(playerID int) (*models.NotificationPreferences, error) {
+	preferences := models.NotificationPreferences{
+		PlayerID: playerID,
+		Rules:    []*models.NotificationRule{},
+	}
+	stmt := `
+		SELECT player_id, spawnset, milestones, dagger_tiers
+		FROM notification_rule
+		WHERE player_id=$1
+		ORDER BY spawnset ASC`
+	err := nm.DB.Select(&preferences.Rules, stmt, playerID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return &preferences, nil
+}
+
+// Replace replaces all of the player's notification rules
+func (nm *NotificationRuleModel) Replace(preferences *models.NotificationPreferences) error {
+	tx, err := nm.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM notification_rule WHERE player_id=$1", preferences.PlayerID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	stmt := `
+		INSERT INTO notification_rule(player_id, spawnset, milestones, dagger_tiers)
+		VALUES ($1, $2, $3, $4)`
+	for _, rule := range preferences.Rules {
+		milestones := rule.Milestones
+		if milestones == nil {
+			milestones = []float64{}
+		}
+		_, err = tx.Exec(stmt, preferences.PlayerID, rule.Spawnset, milestones, rule.DaggerTiers)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
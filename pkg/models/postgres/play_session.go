@@ -0,0 +1,163 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// PlaySessionModel wraps the database connection for play sessions, which
+// record the status timeline of each ddstats client connection
+type PlaySessionModel struct {
+	DB *sqlx.DB
+}
+
+// Start creates a play session for the player's connection and records the
+// login event, returning the ID of the session
+func (pm *PlaySessionModel) Start(playerID int, sid string) (int, error) {
+	tx, err := pm.DB.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	var id int
+	stmt := `
+		INSERT INTO play_session(player_id, sid)
+		VALUES ($1, $2)
+		RETURNING id`
+	err = tx.QueryRow(stmt, playerID, sid).Scan(&id)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	stmt = `
+		INSERT INTO play_session_event(play_session_id, event)
+		VALUES ($1, $2)`
+	_, err = tx.Exec(stmt, id, models.PlaySessionLogin)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// AddEvent records an event in a play session
+func (pm *PlaySessionModel) AddEvent(sessionID int, event string, gameTime float64) error {
+	stmt := `
+		INSERT INTO play_session_event(play_session_id, event, game_time)
+		VALUES ($1, $2, $3)`
+	_, err := pm.DB.Exec(stmt, sessionID, event, gameTime)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// End records the logout event and marks the session as ended
+func (pm *PlaySessionModel) End(sessionID int) error {
+	tx, err := pm.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	stmt := `
+		INSERT INTO play_session_event(play_session_id, event)
+		VALUES ($1, $2)`
+	_, err = tx.Exec(stmt, sessionID, models.PlaySessionLogout)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	stmt = `
+		UPDATE play_session
+		SET ended=CURRENT_TIMESTAMP
+		WHERE id=$1 AND ended IS NULL`
+	_, err = tx.Exec(stmt, sessionID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// EndStale ends every open session whose connection hasn't been seen in the
+// live table within the given duration. These are left behind by instances
+// which have crashed or been restarted, and are ended at the time of their
+// last event.
+func (pm *PlaySessionModel) EndStale(olderThan time.Duration) (int, error) {
+	stmt := `
+		UPDATE play_session
+		SET ended=last_event.at
+		FROM (
+			SELECT play_session_id, MAX(at) AS at
+			FROM play_session_event
+			GROUP BY play_session_id
+		) AS last_event
+		WHERE play_session.id=last_event.play_session_id
+			AND play_session.ended IS NULL
+			AND NOT EXISTS (
+				SELECT 1
+				FROM live
+				WHERE live.sid=play_session.sid AND live.last_seen >= $1
+			)`
+	res, err := pm.DB.Exec(stmt, time.Now().Add(-olderThan))
+	if err != nil {
+		return 0, err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(rowsAffected), nil
+}
+
+// SelectRecent returns the player's most recent play sessions with their
+// events and summaries, newest first
+func (pm *PlaySessionModel) SelectRecent(playerID, limit int) ([]*models.PlaySession, error) {
+	sessions := []*models.PlaySession{}
+	stmt := `
+		SELECT id, player_id, sid, started, ended
+		FROM play_session
+		WHERE player_id=$1
+		ORDER BY started DESC
+		LIMIT $2`
+	err := pm.DB.Select(&sessions, stmt, playerID, limit)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return sessions, nil
+	}
+
+	ids := make([]int, len(sessions))
+	byID := make(map[int]*models.PlaySession, len(sessions))
+	for i, session := range sessions {
+		ids[i] = session.ID
+		byID[session.ID] = session
+		session.Events = []*models.PlaySessionEvent{}
+	}
+	query, args, err := sqlx.In(`
+		SELECT play_session_id, event, game_time, at
+		FROM play_session_event
+		WHERE play_session_id IN (?)
+		ORDER BY at ASC`, ids)
+	if err != nil {
+		return nil, err
+	}
+	var events []*models.PlaySessionEvent
+	err = pm.DB.Select(&events, pm.DB.Rebind(query), args...)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	for _, event := range events {
+		session := byID[event.PlaySessionID]
+		session.Events = append(session.Events, event)
+	}
+
+	now := time.Now()
+	for _, session := range sessions {
+		session.Summarize(now)
+	}
+	return sessions, nil
+}
@@ -1,8 +1,7 @@
 package postgres
 
 import (
-	"net/http"
-
+	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -12,6 +11,10 @@ type Postgres struct {
 	States                 *StateModel
 	Players                *PlayerModel
 	ReplayPlayers          *ReplayPlayerModel
+	Live                   *LiveModel
+	Races                  *RaceModel
+	PlaySessions           *PlaySessionModel
+	NotificationRules      *NotificationRuleModel
 	SubmittedGames         *SubmittedGameModel
 	MOTD                   *MOTDModel
 	DiscordUsers           *DiscordUserModel
@@ -19,31 +22,43 @@ type Postgres struct {
 	Spawnsets              *SpawnsetModel
 	News                   *NewsModel
 	CollectorRuns          *CollectorRunModel
+	CollectorRunStates     *CollectorRunStateModel
 	CollectorPlayers       *CollectorPlayerModel
 	CollectorHighScores    *CollectorHighScoreModel
 	CollectorActivePlayers *CollectorActivePlayerModel
 	CollectorNewPlayers    *CollectorNewPlayerModel
+	CollectorStatus        *CollectorStatusModel
+	CollectorAnomalies     *CollectorAnomalyModel
+	PlayerSnapshots        *CollectorPlayerSnapshotModel
 	GameSubmissions        *GameSubmissionModel
 }
 
-func NewPostgres(client *http.Client, db *sqlx.DB) *Postgres {
+func NewPostgres(ddAPI *ddapi.API, db *sqlx.DB) *Postgres {
 	return &Postgres{
 		DB:                     db,
 		Games:                  &GameModel{DB: db},
 		States:                 &StateModel{DB: db},
 		Players:                &PlayerModel{DB: db},
 		ReplayPlayers:          &ReplayPlayerModel{DB: db},
-		SubmittedGames:         &SubmittedGameModel{DB: db, Client: client},
+		Live:                   &LiveModel{DB: db},
+		Races:                  &RaceModel{DB: db},
+		PlaySessions:           &PlaySessionModel{DB: db},
+		NotificationRules:      &NotificationRuleModel{DB: db},
+		SubmittedGames:         &SubmittedGameModel{DB: db, DDAPI: ddAPI},
 		MOTD:                   &MOTDModel{DB: db},
 		DiscordUsers:           &DiscordUserModel{DB: db},
 		Releases:               &ReleaseModel{DB: db},
 		Spawnsets:              &SpawnsetModel{DB: db},
 		News:                   &NewsModel{DB: db},
 		CollectorRuns:          &CollectorRunModel{DB: db},
+		CollectorRunStates:     &CollectorRunStateModel{DB: db},
 		CollectorPlayers:       &CollectorPlayerModel{DB: db},
 		CollectorHighScores:    &CollectorHighScoreModel{DB: db},
 		CollectorActivePlayers: &CollectorActivePlayerModel{DB: db},
 		CollectorNewPlayers:    &CollectorNewPlayerModel{DB: db},
-		GameSubmissions:        &GameSubmissionModel{DB: db, Client: client},
+		CollectorStatus:        &CollectorStatusModel{DB: db},
+		CollectorAnomalies:     &CollectorAnomalyModel{DB: db},
+		PlayerSnapshots:        &CollectorPlayerSnapshotModel{DB: db},
+		GameSubmissions:        &GameSubmissionModel{DB: db, DDAPI: ddAPI},
 	}
 }
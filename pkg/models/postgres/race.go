@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// RaceModel wraps the database connection for versus race results
+type RaceModel struct {
+	DB *sqlx.DB
+}
+
+// Insert records a finished race and the result of each player
+func (rm *RaceModel) Insert(race *models.Race) error {
+	tx, err := rm.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	stmt := `
+		INSERT INTO race(id, created, started, finished)
+		VALUES ($1, $2, $3, $4)`
+	_, err = tx.Exec(stmt, race.ID, race.Created, race.Started, race.Finished)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	stmt = `
+		INSERT INTO race_player(race_id, player_id, player_name, game_id, game_time, place)
+		VALUES ($1, $2, $3, NULLIF($4, 0), $5, $6)`
+	for _, player := range race.Players {
+		_, err = tx.Exec(stmt, race.ID, player.PlayerID, player.PlayerName, player.GameID, player.GameTime, player.Place)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Select returns a finished race along with its players ordered by place
+func (rm *RaceModel) Select(id string) (*models.Race, error) {
+	var race models.Race
+	stmt := `
+		SELECT *
+		FROM race
+		WHERE id=$1`
+	err := rm.DB.Get(&race, stmt, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.ErrNoRecord
+		}
+		return nil, err
+	}
+	stmt = `
+		SELECT race_id, player_id, player_name, COALESCE(game_id, 0) AS game_id, game_time, place
+		FROM race_player
+		WHERE race_id=$1
+		ORDER BY place ASC`
+	err = rm.DB.Select(&race.Players, stmt, id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return &race, nil
+}
@@ -1,6 +1,7 @@
 package postgres
 
 import (
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -27,3 +28,25 @@ func (p *ReplayPlayerModel) Upsert(playerID int, playerName string) error {
 	}
 	return nil
 }
+
+// UpsertMany inserts or updates the names of the players in batches. The IDs
+// of the players must be unique.
+func (p *ReplayPlayerModel) UpsertMany(tx *sqlx.Tx, players []*models.ReplayPlayer) error {
+	const columns = 2
+	return batches(len(players), columns, func(from, to int) error {
+		stmt := `
+			INSERT INTO replay_player(
+				id,
+				player_name
+			) VALUES ` + batchValues(to-from, columns) + `
+			ON CONFLICT (id) DO
+			UPDATE SET
+				player_name=EXCLUDED.player_name`
+		args := make([]interface{}, 0, (to-from)*columns)
+		for _, player := range players[from:to] {
+			args = append(args, player.ID, player.PlayerName)
+		}
+		_, err := tx.Exec(stmt, args...)
+		return err
+	})
+}
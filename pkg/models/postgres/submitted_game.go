@@ -4,17 +4,16 @@ import (
 	"database/sql"
 	"errors"
 	"math"
-	"net/http"
 
 	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
 	"github.com/alexwilkerson/ddstats-server/pkg/models"
 	"github.com/jmoiron/sqlx"
 )
 
-// SubmittedGameModel wraps the database connection and http client
+// SubmittedGameModel wraps the database connection and the DD API
 type SubmittedGameModel struct {
-	DB     *sqlx.DB
-	Client *http.Client
+	DB    *sqlx.DB
+	DDAPI *ddapi.API
 }
 
 // CheckDuplicate takes a submitted game, checks if it's a replay...
@@ -82,6 +81,9 @@ func (sg *SubmittedGameModel) Insert(game *models.SubmittedGame) (int, error) {
 	if game.SurvivalHash == "" {
 		game.SurvivalHash = "5ff43e37d0f85e068caab5457305754e"
 	}
+	if game.Source == "" {
+		game.Source = models.GameSourceClient
+	}
 
 	stmt := `
 		INSERT INTO game(
@@ -107,9 +109,10 @@ func (sg *SubmittedGameModel) Insert(game *models.SubmittedGame) (int, error) {
 			homing_daggers_max_time,
 			enemies_alive_max_time,
 			homing_daggers_max,
-			enemies_alive_max)
+			enemies_alive_max,
+			source)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, CURRENT_TIMESTAMP,
-			$11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22)
+			$11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23)
 		RETURNING id`
 	var gameID int
 	err := sg.DB.QueryRow(stmt,
@@ -135,6 +138,7 @@ func (sg *SubmittedGameModel) Insert(game *models.SubmittedGame) (int, error) {
 		game.EnemiesAliveMaxTime,
 		game.HomingMax,
 		game.EnemiesAliveMax,
+		game.Source,
 	).Scan(&gameID)
 	if err != nil {
 		return 0, err
@@ -178,8 +182,7 @@ func (sg *SubmittedGameModel) Insert(game *models.SubmittedGame) (int, error) {
 	_, err = players.Get(game.PlayerID)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
-			ddAPI := ddapi.API{Client: sg.Client}
-			player, err := ddAPI.UserByID(game.PlayerID)
+			player, err := sg.DDAPI.UserByID(game.PlayerID)
 			if err != nil {
 				return 0, err
 			}
@@ -192,6 +195,14 @@ func (sg *SubmittedGameModel) Insert(game *models.SubmittedGame) (int, error) {
 		}
 	}
 
+	if game.Source != models.GameSourceLiveRecovered && game.ReplayPlayerID == 0 {
+		games := GameModel{DB: sg.DB}
+		_, err = games.DeleteRecovered(game.PlayerID, game.GameTime, game.DeathType)
+		if err != nil {
+			return 0, err
+		}
+	}
+
 	return gameID, nil
 }
 
@@ -0,0 +1,47 @@
+package socketio
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+const (
+	handshakeNonceBytes = 16
+)
+
+var (
+	errInvalidLogin = errors.New("invalid login token")
+)
+
+// session is stored as the context of each socket.io connection
+type session struct {
+	nonce string
+}
+
+// LoginToken returns the token a client must send with login_v2 when the
+// server is started with a login secret. The nonce is sent to the client in
+// the handshake event when it connects.
+//
+// The secret ships with the desktop client, so anyone can extract it and sign
+// a login for any player. The token only shows that the login came from a
+// client which knows the secret and wasn't replayed from another connection;
+// it is tamper-evidence against casual spoofing, not authentication of the
+// player, and must not be used to authorize anything a player owns.
+func LoginToken(secret []byte, nonce string, playerID int) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s:%d", nonce, playerID)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, handshakeNonceBytes)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
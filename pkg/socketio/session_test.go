@@ -0,0 +1,116 @@
+package socketio
+
+import (
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/live"
+	"github.com/alexwilkerson/ddstats-server/pkg/websocket"
+)
+
+// fakeConn is a socketio.Conn which records what the server does with it
+type fakeConn struct {
+	id      string
+	ctx     interface{}
+	closed  bool
+	emitted []string
+}
+
+func (c *fakeConn) ID() string                        { return c.id }
+func (c *fakeConn) Close() error                      { c.closed = true; return nil }
+func (c *fakeConn) URL() url.URL                      { return url.URL{} }
+func (c *fakeConn) LocalAddr() net.Addr               { return nil }
+func (c *fakeConn) RemoteAddr() net.Addr              { return nil }
+func (c *fakeConn) RemoteHeader() http.Header         { return http.Header{} }
+func (c *fakeConn) Context() interface{}              { return c.ctx }
+func (c *fakeConn) SetContext(v interface{})          { c.ctx = v }
+func (c *fakeConn) Namespace() string                 { return defaultNamespace }
+func (c *fakeConn) Emit(msg string, v ...interface{}) { c.emitted = append(c.emitted, msg) }
+func (c *fakeConn) Join(room string)                  {}
+func (c *fakeConn) Leave(room string)                 {}
+func (c *fakeConn) LeaveAll()                         {}
+func (c *fakeConn) Rooms() []string                   { return nil }
+
+func newTestSio(loginSecret string) *sio {
+	logger := log.New(ioutil.Discard, "", 0)
+	return &sio{
+		infoLog:     logger,
+		errorLog:    logger,
+		live:        live.NewService(logger, logger, websocket.NewHub(nil), nil, nil),
+		loginSecret: []byte(loginSecret),
+	}
+}
+
+func TestLogin(t *testing.T) {
+	const secret = "secret"
+
+	t.Run("handshake", func(t *testing.T) {
+		si := newTestSio(secret)
+		s := &fakeConn{id: "1"}
+		err := si.onConnect(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(s.emitted) != 1 || s.emitted[0] != "handshake" {
+			t.Fatalf("got emitted %v; want [handshake]", s.emitted)
+		}
+		if _, ok := s.Context().(*session); !ok {
+			t.Fatalf("got context %T; want *session", s.Context())
+		}
+	})
+
+	t.Run("wrong token", func(t *testing.T) {
+		si := newTestSio(secret)
+		s := &fakeConn{id: "1"}
+		si.onConnect(s)
+		nonce := s.Context().(*session).nonce
+		si.onLoginV2(s, 10, LoginToken([]byte(secret), nonce, 11))
+		if !s.closed {
+			t.Fatal("connection was not closed")
+		}
+	})
+
+	t.Run("token from other nonce", func(t *testing.T) {
+		si := newTestSio(secret)
+		s := &fakeConn{id: "1"}
+		si.onConnect(s)
+		si.onLoginV2(s, 10, LoginToken([]byte(secret), "other", 10))
+		if !s.closed {
+			t.Fatal("connection was not closed")
+		}
+	})
+
+	t.Run("legacy login with secret", func(t *testing.T) {
+		si := newTestSio(secret)
+		s := &fakeConn{id: "1"}
+		si.onConnect(s)
+		si.onLogin(s, 10)
+		if !s.closed {
+			t.Fatal("connection was not closed")
+		}
+	})
+
+	t.Run("legacy login without secret", func(t *testing.T) {
+		si := newTestSio("")
+		si.rejectLegacyLogin = true
+		s := &fakeConn{id: "1"}
+		si.onConnect(s)
+		si.onLogin(s, 10)
+		if !s.closed {
+			t.Fatal("connection was not closed")
+		}
+	})
+
+	t.Run("client error", func(t *testing.T) {
+		si := newTestSio("")
+		s := &fakeConn{id: "1"}
+		si.onLogin(s, -1)
+		if !s.closed {
+			t.Fatal("connection was not closed")
+		}
+	})
+}
@@ -4,120 +4,58 @@
 package socketio
 
 import (
+	"crypto/hmac"
+	"errors"
 	"log"
-	"net/http"
-	"strconv"
-	"sync"
-	"time"
 
-	"github.com/alexwilkerson/ddstats-server/pkg/models/postgres"
-	"github.com/alexwilkerson/ddstats-server/pkg/websocket"
-
-	"github.com/alexwilkerson/ddstats-server/pkg/ddapi"
+	"github.com/alexwilkerson/ddstats-server/pkg/live"
 
 	socketio "github.com/googollee/go-socket.io"
 )
 
-const (
-	StatusLoggedIn        = "Logged In"
-	StatusNotConnected    = "Not Connected"
-	StatusConnecting      = "Connecting"
-	StatusAlive           = "Alive"
-	StatusWatchingAReplay = "Watching A Replay"
-	StatusInMainMenu      = "In Main Menu"
-	StatusInDaggerLobby   = "In Dagger Lobby"
-	StatusDead            = "Dead"
-)
-
 const (
 	defaultNamespace = "/"
 )
 
-const (
-	notifyThreshold = 1000
-)
-
+// sio adapts socket.io events from the ddstats client to the live service
 type sio struct {
-	server       *socketio.Server
-	client       *http.Client
-	infoLog      *log.Logger
-	errorLog     *log.Logger
-	websocketHub *websocket.Hub
-	ddAPI        *ddapi.API
-	db           *postgres.Postgres
-	livePlayers  *sync.Map
-}
-
-type player struct {
-	sync.Mutex
-	websocketPlayer        *websocket.PlayerWithLock
-	PlayerID               int     `json:"player_id"`
-	PlayerName             string  `json:"player_name"`
-	BestGameTime           float64 `json:"best_game_time"`
-	GameTime               float64 `json:"game_time"`
-	DeathType              int     `json:"death_type"`
-	IsReplay               bool    `json:"is_replay"`
-	bestTimeNotified       bool
-	aboveThresholdNotified bool
+	server      *socketio.Server
+	infoLog     *log.Logger
+	errorLog    *log.Logger
+	live        *live.Service
+	loginSecret []byte
+	// rejectLegacyLogin refuses the login event even without a login secret
+	rejectLegacyLogin bool
 }
 
-func (p *player) getStatus() string {
-	var status string
-	switch {
-	case p.DeathType >= 0:
-		status = StatusDead
-	case p.DeathType == -2:
-		status = StatusInMainMenu
-	case p.DeathType == -1 && p.IsReplay == true:
-		status = StatusWatchingAReplay
-	default:
-		status = StatusAlive
-	}
-	return status
-}
-
-type gameSubmitted struct {
-	PlayerID int `json:"player_id"`
-	GameID   int `json:"game_id"`
-}
-
-type state struct {
-	PlayerID             int     `json:"player_id"`
-	GameTime             float64 `json:"game_time"`
-	Gems                 int     `json:"gems"`
-	HomingDaggers        int     `json:"homing_daggers"`
-	EnemiesAlive         int     `json:"enemies_alive"`
-	EnemiesKilled        int     `json:"enemies_killed"`
-	DaggersHit           int     `json:"daggers_hit"`
-	DaggersFired         int     `json:"daggers_fired"`
-	LevelTwoTime         float64 `json:"level_two_time"`
-	LevelThreeTime       float64 `json:"level_three_time"`
-	LevelFourTime        float64 `json:"level_four_time"`
-	LeviDownTime         float64 `json:"levi_down_time"`
-	OrbDownTime          float64 `json:"orb_down_time"`
-	DeathType            int     `json:"death_type"`
-	IsReplay             bool    `json:"is_replay"`
-	Status               string  `json:"status"`
-	NotifyPlayerBest     bool    `json:"-"`
-	NotifyAboveThreshold bool    `json:"-"`
+// statuses maps the status IDs sent with status_update to live statuses
+var statuses = []string{
+	live.StatusNotConnected,
+	live.StatusConnecting,
+	live.StatusAlive,
+	live.StatusWatchingAReplay,
+	live.StatusInMainMenu,
+	live.StatusInDaggerLobby,
+	live.StatusDead,
 }
 
 // NewServer returns a Server from the go-socket.io package with all of the routes already
-// set up to handle ddstats clients
-func NewServer(infoLog, errorLog *log.Logger, websocketHub *websocket.Hub, client *http.Client, db *postgres.Postgres) (*socketio.Server, error) {
+// set up to handle ddstats clients. If loginSecret is set, clients must log in
+// with login_v2 and a token signed with the secret, see LoginToken for what it
+// does and doesn't prove. If rejectLegacyLogin is set, clients which predate
+// login_v2 are refused even without a secret.
+func NewServer(infoLog, errorLog *log.Logger, liveService *live.Service, loginSecret string, rejectLegacyLogin bool) (*socketio.Server, error) {
 	server, err := socketio.NewServer(nil)
 	if err != nil {
 		return nil, err
 	}
 	s := sio{
-		server:       server,
-		client:       client,
-		infoLog:      infoLog,
-		errorLog:     errorLog,
-		db:           db,
-		websocketHub: websocketHub,
-		ddAPI:        &ddapi.API{Client: client},
-		livePlayers:  &sync.Map{},
+		server:            server,
+		infoLog:           infoLog,
+		errorLog:          errorLog,
+		live:              liveService,
+		loginSecret:       []byte(loginSecret),
+		rejectLegacyLogin: rejectLegacyLogin,
 	}
 	s.routes(server)
 	return server, nil
@@ -128,187 +66,80 @@ func (si *sio) routes(server *socketio.Server) {
 	server.OnDisconnect(defaultNamespace, si.onDisconnect)
 	server.OnError(defaultNamespace, si.onError)
 	server.OnEvent(defaultNamespace, "login", si.onLogin)
+	server.OnEvent(defaultNamespace, "login_v2", si.onLoginV2)
 	server.OnEvent(defaultNamespace, "submit", si.onSubmit)
 	server.OnEvent(defaultNamespace, "state_update", si.onStateUpdate)
+	server.OnEvent(defaultNamespace, "state_update_v2", si.onStateUpdateV2)
 	server.OnEvent(defaultNamespace, "status_update", si.onStatusUpdate)
 	server.OnEvent(defaultNamespace, "game_submitted", si.onGameSubmitted)
 }
 
-// i don't know what this function should do
+// onConnect sends the client a nonce which it signs to log in with login_v2
 func (si *sio) onConnect(s socketio.Conn) error {
-	s.SetContext("")
+	nonce, err := newNonce()
+	if err != nil {
+		return err
+	}
+	s.SetContext(&session{nonce: nonce})
+	s.Emit("handshake", nonce)
 	si.infoLog.Println("connected:", s.ID())
 	return nil
 }
 
 func (si *sio) onDisconnect(s socketio.Conn, msg string) {
-	v, ok := si.livePlayers.Load(s.ID())
-	if !ok {
-		si.errorLog.Println("socketio onDisconnect: could not load player from livePlayers map")
-		return
-	}
-	player := v.(*player)
-	player.Lock()
-	websocketMessage, err := websocket.NewMessage(strconv.Itoa(player.PlayerID), "submit", struct{}{})
+	err := si.live.Logout(s.ID())
 	if err != nil {
-		si.errorLog.Println("socketio onSubmit: %w", err)
+		si.errorLog.Printf("socketio onDisconnect: %v", err)
+		return
 	}
-	si.websocketHub.Broadcast <- websocketMessage
-	si.livePlayers.Delete(s.ID())
-	si.websocketHub.UnregisterPlayer <- player.websocketPlayer
-	player.Unlock()
 	si.infoLog.Println(s.ID(), "disconnected")
-	return
 }
 
 func (si *sio) onStatusUpdate(s socketio.Conn, playerID, statusID int) {
 	var status string
-	switch statusID {
-	case 0:
-		status = StatusNotConnected
-	case 1:
-		status = StatusConnecting
-	case 2:
-		status = StatusAlive
-	case 3:
-		status = StatusWatchingAReplay
-	case 4:
-		status = StatusInMainMenu
-	case 5:
-		status = StatusInDaggerLobby
-	case 6:
-		status = StatusDead
+	if statusID >= 0 && statusID < len(statuses) {
+		status = statuses[statusID]
 	}
-	p, ok := si.livePlayers.Load(s.ID())
-	if !ok {
-		si.errorLog.Printf("player with s.ID() %s not found in livePlayers map", s.ID())
-		return
+	err := si.live.UpdateStatus(s.ID(), playerID, status)
+	if errors.Is(err, live.ErrNotLoggedIn) {
+		si.errorLog.Printf("socketio status_update from %s: %v", s.ID(), err)
 	}
-	player := p.(*player)
-	player.Lock()
-	player.websocketPlayer.Lock()
-	player.websocketPlayer.Status = status
-	player.websocketPlayer.Unlock()
-	player.Unlock()
-
-	websocketMessage, err := websocket.NewMessage(strconv.Itoa(playerID), "status", status)
-	if err != nil {
-		si.errorLog.Println("socketio status: %w", err)
-	}
-	si.websocketHub.Broadcast <- websocketMessage
 }
 
 func (si *sio) onGameSubmitted(s socketio.Conn, gameID int, notifyPlayerBest, notifyAboveThreshold bool) {
-	v, ok := si.livePlayers.Load(s.ID())
-	if !ok {
-		return
-	}
-	player := v.(*player)
-	player.Lock()
-	defer player.Unlock()
-	game, err := si.db.Games.Get(gameID)
-	if err != nil {
-		si.errorLog.Printf("%+v", err)
-	}
-
-	// submit new game notification to website
-	websocketMessage, err := websocket.NewMessage(strconv.Itoa(int(player.PlayerID)), "game_submitted", gameSubmitted{
-		PlayerID: player.PlayerID,
-		GameID:   gameID,
-	})
-	if err != nil {
-		si.errorLog.Println("socketio on game_submitted: %w", err)
-	}
-	si.websocketHub.BroadcastToAll <- websocketMessage
-
-	if game.ReplayPlayerID == 0 && notifyPlayerBest && game.GameTime > player.BestGameTime {
-		si.websocketHub.DiscordBroadcast <- &websocket.PlayerBestSubmitted{
-			PlayerName:       player.PlayerName,
-			GameID:           gameID,
-			GameTime:         game.GameTime,
-			PreviousGameTime: player.BestGameTime,
-		}
-
-		websocketMessage, err := websocket.NewMessage(strconv.Itoa(int(player.PlayerID)), "new_personal_best_broadcast", websocket.PlayerBestSubmitted{
-			PlayerName:       player.PlayerName,
-			GameID:           gameID,
-			GameTime:         game.GameTime,
-			PreviousGameTime: player.BestGameTime,
-		})
-
-		if err != nil {
-			si.errorLog.Println("socketio on game_submitted: %w", err)
-		}
-
-		si.websocketHub.BroadcastToAll <- websocketMessage
-
-	}
-	if game.ReplayPlayerID == 0 && notifyAboveThreshold && game.GameTime >= notifyThreshold {
-		si.websocketHub.DiscordBroadcast <- &websocket.PlayerAboveThresholdSubmitted{
-			PlayerName: player.PlayerName,
-			GameID:     gameID,
-			GameTime:   game.GameTime,
-			DeathType:  game.DeathType,
-		}
-
-		websocketMessage, err := websocket.NewMessage(strconv.Itoa(int(player.PlayerID)), "death_past_threshold_broadcast", websocket.PlayerAboveThresholdSubmitted{
-			PlayerName: player.PlayerName,
-			GameID:     gameID,
-			GameTime:   game.GameTime,
-			DeathType:  game.DeathType,
-		})
-
-		if err != nil {
-			si.errorLog.Println("socketio on game_submitted: %w", err)
-		}
-
-		si.websocketHub.BroadcastToAll <- websocketMessage
-	}
+	si.live.GameSubmitted(s.ID(), gameID, notifyPlayerBest, notifyAboveThreshold)
 }
 
+// onLogin is used by clients which predate the login handshake, and is only
+// accepted if the server has no login secret and doesn't reject legacy logins
 func (si *sio) onLogin(s socketio.Conn, id int) {
-	start := time.Now()
-	// -1 is sent when there is an error in the client
-	if id == -1 {
-		si.errorLog.Println("socketio onLogin: id is -1")
+	if len(si.loginSecret) > 0 || si.rejectLegacyLogin {
+		si.errorLog.Printf("socketio onLogin: %s for player %d: %v", s.ID(), id, errInvalidLogin)
 		s.Close()
 		return
 	}
+	si.login(s, id)
+}
 
-	p, err := si.ddAPI.UserByID(id)
-	if err != nil {
-		si.errorLog.Printf("socketio onLogin: %w", err)
-		s.Close()
-		return
+// onLoginV2 requires the client to sign the nonce it was sent on connect
+func (si *sio) onLoginV2(s socketio.Conn, id int, token string) {
+	if len(si.loginSecret) > 0 {
+		sess, ok := s.Context().(*session)
+		if !ok || !hmac.Equal([]byte(token), []byte(LoginToken(si.loginSecret, sess.nonce, id))) {
+			si.errorLog.Printf("socketio onLoginV2: %s for player %d: %v", s.ID(), id, errInvalidLogin)
+			s.Close()
+			return
+		}
 	}
+	si.login(s, id)
+}
 
-	websocketPlayer := websocket.PlayerWithLock{Player: websocket.Player{ID: int(p.PlayerID), Name: p.PlayerName, Status: StatusLoggedIn}}
-
-	si.livePlayers.Store(s.ID(), &player{
-		websocketPlayer: &websocketPlayer,
-		PlayerID:        int(p.PlayerID),
-		PlayerName:      p.PlayerName,
-		BestGameTime:    p.GameTime,
-		DeathType:       -2, // IN MENU
-	})
-
-	err = si.db.Players.UpsertDDPlayer(p)
+func (si *sio) login(s socketio.Conn, id int) {
+	err := si.live.Login(s.ID(), id)
 	if err != nil {
-		si.errorLog.Printf("socketio onLogin: %w", err)
+		si.errorLog.Printf("socketio onLogin: %s for player %d: %v", s.ID(), id, err)
 		s.Close()
-		return
 	}
-
-	si.websocketHub.RegisterPlayer <- &websocketPlayer
-
-	websocketMessage, err := websocket.NewMessage(strconv.Itoa(int(p.PlayerID)), "submit", struct{}{})
-	if err != nil {
-		si.errorLog.Println("socketio onSubmit: %w", err)
-	}
-	si.websocketHub.Broadcast <- websocketMessage
-
-	si.infoLog.Println(id)
-	si.infoLog.Println("duration:", time.Since(start))
 }
 
 // this function catches functions from older client and passes them to new function with leviDownTime and orbDownTime counted as 0
@@ -317,7 +148,7 @@ func (si *sio) onSubmit(s socketio.Conn, playerID int, gameTime float64, gems, h
 }
 
 func (si *sio) onStateUpdate(s socketio.Conn, playerID int, gameTime float64, gems, homingDaggers, enemiesAlive, enemiesKilled, daggersHit, daggersFired int, levelTwoTime, levelThreeTime, levelFourTime, leviDownTime, orbDownTime float64, isReplay bool, deathType int, notifyPlayerBest, notifyAboveThreshold bool) {
-	state := state{
+	si.updateState(s, &live.State{
 		PlayerID:             playerID,
 		GameTime:             gameTime,
 		Gems:                 gems,
@@ -335,76 +166,27 @@ func (si *sio) onStateUpdate(s socketio.Conn, playerID int, gameTime float64, ge
 		IsReplay:             isReplay,
 		NotifyPlayerBest:     notifyPlayerBest,
 		NotifyAboveThreshold: notifyAboveThreshold,
-	}
-	if playerID < 1 {
-		si.errorLog.Println("playerID less than 1")
-		return
-	}
-	p, ok := si.livePlayers.Load(s.ID())
-	if !ok {
-		si.errorLog.Printf("player with s.ID() %s not found in livePlayers map", s.ID())
-		return
-	}
-	player := p.(*player)
-	player.Lock()
-	state.Status = player.getStatus()
-	defer player.Unlock()
-	if state.GameTime < player.GameTime {
-		player.aboveThresholdNotified = false
-		player.bestTimeNotified = false
-	}
-	player.GameTime = state.GameTime
-	player.DeathType = state.DeathType
-	player.IsReplay = state.IsReplay
-	status := player.getStatus()
-	player.websocketPlayer.Lock()
-	player.websocketPlayer.GameTime = state.GameTime
-	player.websocketPlayer.Status = status
-	player.websocketPlayer.Unlock()
-	websocketMessage, err := websocket.NewMessage(strconv.Itoa(playerID), "submit", state)
+	})
+}
+
+// onStateUpdateV2 receives a single versioned JSON object instead of the
+// positional arguments of state_update, so that fields can be added without
+// changing the event signature
+func (si *sio) onStateUpdateV2(s socketio.Conn, update stateUpdateV2) {
+	state, err := update.toState()
 	if err != nil {
-		si.errorLog.Println("socketio onSubmit: %w", err)
+		si.errorLog.Printf("socketio state_update_v2 from %s: %v", s.ID(), err)
 		return
 	}
-	si.websocketHub.Broadcast <- websocketMessage
-	// if the notification hasn't yet happened and a player beats their previous score,
-	if !isReplay && notifyPlayerBest && !player.bestTimeNotified && gameTime > player.BestGameTime {
-		si.websocketHub.DiscordBroadcast <- &websocket.PlayerBestReached{
-			PlayerID:         player.PlayerID,
-			PlayerName:       player.PlayerName,
-			PreviousGameTime: player.BestGameTime,
-		}
-		player.bestTimeNotified = true
-
-		websocketMessage, err := websocket.NewMessage(strconv.Itoa(int(player.PlayerID)), "past_personal_best_broadcast", websocket.PlayerBestReached{
-			PlayerID:         player.PlayerID,
-			PlayerName:       player.PlayerName,
-			PreviousGameTime: player.BestGameTime,
-		})
-
-		if err != nil {
-			si.errorLog.Println("socketio on status_update: %w", err)
-		}
-
-		si.websocketHub.BroadcastToAll <- websocketMessage
-	}
-	if !isReplay && notifyAboveThreshold && !player.aboveThresholdNotified && gameTime >= notifyThreshold {
-		player.aboveThresholdNotified = true
-		si.websocketHub.DiscordBroadcast <- &websocket.PlayerAboveThreshold{
-			PlayerID:   player.PlayerID,
-			PlayerName: player.PlayerName,
-		}
-
-		websocketMessage, err := websocket.NewMessage(strconv.Itoa(int(player.PlayerID)), "past_threshold_broadcast", websocket.PlayerAboveThreshold{
-			PlayerID:   player.PlayerID,
-			PlayerName: player.PlayerName,
-		})
-
-		if err != nil {
-			si.errorLog.Println("socketio on status_update: %w", err)
-		}
+	si.updateState(s, state)
+}
 
-		si.websocketHub.BroadcastToAll <- websocketMessage
+// updateState passes the state to the live service, which logs the updates it
+// rejects for being spoofed or rate limited
+func (si *sio) updateState(s socketio.Conn, state *live.State) {
+	err := si.live.UpdateState(s.ID(), state)
+	if errors.Is(err, live.ErrInvalidPlayerID) || errors.Is(err, live.ErrNotLoggedIn) {
+		si.errorLog.Printf("socketio state update from %s: %v", s.ID(), err)
 	}
 }
 
@@ -0,0 +1,95 @@
+package socketio
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/live"
+)
+
+const (
+	// stateSchemaVersion is the newest version of the state_update_v2 schema
+	// understood by the server. Version 2 added spawnset.
+	stateSchemaVersion = 2
+)
+
+var (
+	errMissingSchemaVersion     = errors.New("missing schema_version")
+	errUnsupportedSchemaVersion = errors.New("unsupported schema_version")
+)
+
+// stateUpdateV2 is the payload of the state_update_v2 event. It mirrors the
+// StatFrame sent with gRPC game submissions, so that the live view can show
+// the gem economy and per-enemy counts. New fields must only be added along
+// with a new schema version.
+type stateUpdateV2 struct {
+	SchemaVersion        int     `json:"schema_version"`
+	PlayerID             int     `json:"player_id"`
+	GameTime             float64 `json:"game_time"`
+	Gems                 int     `json:"gems"`
+	HomingDaggers        int     `json:"homing_daggers"`
+	EnemiesAlive         int     `json:"enemies_alive"`
+	EnemiesKilled        int     `json:"enemies_killed"`
+	DaggersHit           int     `json:"daggers_hit"`
+	DaggersFired         int     `json:"daggers_fired"`
+	LevelTwoTime         float64 `json:"level_two_time"`
+	LevelThreeTime       float64 `json:"level_three_time"`
+	LevelFourTime        float64 `json:"level_four_time"`
+	LeviDownTime         float64 `json:"levi_down_time"`
+	OrbDownTime          float64 `json:"orb_down_time"`
+	DeathType            int     `json:"death_type"`
+	IsReplay             bool    `json:"is_replay"`
+	TotalGems            int     `json:"total_gems"`
+	LevelGems            int     `json:"level_gems"`
+	GemsDespawned        int     `json:"gems_despawned"`
+	GemsEaten            int     `json:"gems_eaten"`
+	DaggersEaten         int     `json:"daggers_eaten"`
+	PerEnemyAliveCount   []int   `json:"per_enemy_alive_count"`
+	PerEnemyKillCount    []int   `json:"per_enemy_kill_count"`
+	Spawnset             string  `json:"spawnset"`
+	NotifyPlayerBest     bool    `json:"notify_player_best"`
+	NotifyAboveThreshold bool    `json:"notify_above_threshold"`
+}
+
+// toState translates the payload into a live state according to
+// its schema version
+func (u *stateUpdateV2) toState() (*live.State, error) {
+	switch {
+	case u.SchemaVersion == 0:
+		return nil, errMissingSchemaVersion
+	case u.SchemaVersion > stateSchemaVersion:
+		return nil, fmt.Errorf("%w: %d (newest supported is %d)", errUnsupportedSchemaVersion, u.SchemaVersion, stateSchemaVersion)
+	case u.SchemaVersion < 0:
+		return nil, fmt.Errorf("%w: %d", errUnsupportedSchemaVersion, u.SchemaVersion)
+	}
+	st := &live.State{
+		PlayerID:             u.PlayerID,
+		GameTime:             u.GameTime,
+		Gems:                 u.Gems,
+		HomingDaggers:        u.HomingDaggers,
+		EnemiesAlive:         u.EnemiesAlive,
+		EnemiesKilled:        u.EnemiesKilled,
+		DaggersHit:           u.DaggersHit,
+		DaggersFired:         u.DaggersFired,
+		LevelTwoTime:         u.LevelTwoTime,
+		LevelThreeTime:       u.LevelThreeTime,
+		LevelFourTime:        u.LevelFourTime,
+		LeviDownTime:         u.LeviDownTime,
+		OrbDownTime:          u.OrbDownTime,
+		DeathType:            u.DeathType,
+		IsReplay:             u.IsReplay,
+		TotalGems:            u.TotalGems,
+		LevelGems:            u.LevelGems,
+		GemsDespawned:        u.GemsDespawned,
+		GemsEaten:            u.GemsEaten,
+		DaggersEaten:         u.DaggersEaten,
+		PerEnemyAliveCount:   u.PerEnemyAliveCount,
+		PerEnemyKillCount:    u.PerEnemyKillCount,
+		NotifyPlayerBest:     u.NotifyPlayerBest,
+		NotifyAboveThreshold: u.NotifyAboveThreshold,
+	}
+	if u.SchemaVersion >= 2 {
+		st.Spawnset = u.Spawnset
+	}
+	return st, nil
+}
@@ -0,0 +1,40 @@
+package socketio
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestStateUpdateV2ToState(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		wantErr error
+	}{
+		{"current version", `{"schema_version":1,"player_id":1,"game_time":12.5,"total_gems":30,"per_enemy_kill_count":[1,2]}`, nil},
+		{"missing version", `{"player_id":1,"game_time":12.5}`, errMissingSchemaVersion},
+		{"spawnset version", `{"schema_version":2,"player_id":1,"game_time":12.5,"total_gems":30,"per_enemy_kill_count":[1,2],"spawnset":"pacifist"}`, nil},
+		{"future version", `{"schema_version":3,"player_id":1}`, errUnsupportedSchemaVersion},
+		{"negative version", `{"schema_version":-1,"player_id":1}`, errUnsupportedSchemaVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var update stateUpdateV2
+			err := json.Unmarshal([]byte(tt.payload), &update)
+			if err != nil {
+				t.Fatalf("got error: %v", err)
+			}
+			got, err := update.toState()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v; want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.PlayerID != 1 || got.GameTime != 12.5 || got.TotalGems != 30 || len(got.PerEnemyKillCount) != 2 {
+				t.Errorf("got %+v", got)
+			}
+		})
+	}
+}
@@ -1,8 +1,10 @@
 package websocket
 
 import (
+	"bytes"
 	"encoding/json"
 	"log"
+	"sync"
 
 	"github.com/gorilla/websocket"
 )
@@ -14,22 +16,27 @@ const (
 
 // Client represents the user connected through the websocket
 type Client struct {
-	ID   uint
-	Conn *websocket.Conn
-	Hub  *Hub
-	Room string
+	ID    uint
+	Conn  *websocket.Conn
+	Hub   *Hub
+	Room  string
+	Codec string
 }
 
 // Message represents the message that will be sent to the client
 // and frontend. The message stores the intended "room" that the
 // message is intended for, the Type, which is always 1 meaning text,
 // a Func name, which is a function name sent to the frontend to be handled,
-// and a Body which holds any extra data the function might need to send
+// and a Body which holds any extra data the function might need to send.
+// The message is encoded at most once per codec, no matter how many clients
+// it is sent to
 type Message struct {
-	Room string `json:"-"`
-	Type int    `json:"type,omitempty"`
-	Func string `json:"func,omitempty"`
-	Body string `json:"body,omitempty"`
+	Room     string `json:"-"`
+	Type     int    `json:"type,omitempty"`
+	Func     string `json:"func,omitempty"`
+	Body     string `json:"body,omitempty"`
+	mu       sync.Mutex
+	prepared map[string]*websocket.PreparedMessage
 }
 
 // NewMessage populates and returns a Message pointer after having
@@ -48,6 +55,47 @@ func NewMessage(room, funcName string, v interface{}) (*Message, error) {
 	}, nil
 }
 
+// Prepare returns the message encoded for the given codec, encoding it on
+// the first call
+func (m *Message) Prepare(codec string) (*websocket.PreparedMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if pm, ok := m.prepared[codec]; ok {
+		return pm, nil
+	}
+	var data []byte
+	var err error
+	messageType := websocket.TextMessage
+	if codec == SubprotocolMsgpack {
+		data, err = encodeMsgpack(m)
+		messageType = websocket.BinaryMessage
+	} else {
+		data, err = encodeJSON(m)
+	}
+	if err != nil {
+		return nil, err
+	}
+	pm, err := websocket.NewPreparedMessage(messageType, data)
+	if err != nil {
+		return nil, err
+	}
+	if m.prepared == nil {
+		m.prepared = make(map[string]*websocket.PreparedMessage)
+	}
+	m.prepared[codec] = pm
+	return pm, nil
+}
+
+// Write sends the message to the client using the codec negotiated when
+// the client connected
+func (c *Client) Write(m *Message) error {
+	pm, err := m.Prepare(c.Codec)
+	if err != nil {
+		return err
+	}
+	return c.Conn.WritePreparedMessage(pm)
+}
+
 func (c *Client) Read() {
 	defer func() {
 		c.Hub.Unregister <- c
@@ -55,22 +103,31 @@ func (c *Client) Read() {
 	}()
 
 	for {
-		_, p, err := c.Conn.ReadMessage()
+		messageType, p, err := c.Conn.ReadMessage()
 		if err != nil {
 			log.Println(err)
 			break
 		}
 		v := struct {
-			Func string `json:"func"`
-			Body string `json:"body"`
+			Func  string `json:"func"`
+			Body  string `json:"body"`
+			Token string `json:"token"`
 		}{}
 
-		err = json.Unmarshal(p, &v)
+		if messageType == websocket.BinaryMessage {
+			err = decodeMsgpackRequest(p, &v.Func, &v.Body, &v.Token)
+		} else {
+			err = json.Unmarshal(p, &v)
+		}
 		if err != nil {
 			log.Println(err)
 			continue
 		}
 		if v.Func == wsFuncJoinRoom {
+			if err := c.Hub.AuthorizeRoom(v.Body, v.Token); err != nil {
+				log.Printf("websocket join room %q rejected for %s: %v", v.Body, c.Conn.RemoteAddr(), err)
+				continue
+			}
 			c.Room = v.Body // room needs to be set here, because the hub handles join room per c.Room
 			c.Hub.JoinRoom <- c
 			continue
@@ -84,3 +141,20 @@ func (c *Client) Read() {
 		// fmt.Printf("Message receieved: %+v\n", message)
 	}
 }
+
+// decodeMsgpackRequest reads the func, body and token keys sent by a client
+// which negotiated the msgpack subprotocol
+func decodeMsgpackRequest(p []byte, funcName, body, token *string) error {
+	v, err := readMsgpack(bytes.NewReader(p))
+	if err != nil {
+		return err
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return ErrMsgpackDecode
+	}
+	*funcName, _ = m["func"].(string)
+	*body, _ = m["body"].(string)
+	*token, _ = m["token"].(string)
+	return nil
+}
@@ -0,0 +1,342 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+const (
+	// SubprotocolJSON is the default encoding, where Message.Body is itself a
+	// JSON string
+	SubprotocolJSON = "json"
+	// SubprotocolMsgpack encodes messages as MessagePack binary frames, with
+	// the body encoded as a nested MessagePack value rather than a string
+	SubprotocolMsgpack = "msgpack"
+)
+
+// ErrMsgpackDecode is returned when a MessagePack payload is malformed or uses
+// a type which is not supported
+var ErrMsgpackDecode = errors.New("invalid msgpack data")
+
+// encodeJSON encodes the message as it has always been sent to websocket clients
+func encodeJSON(m *Message) ([]byte, error) {
+	return json.Marshal(m)
+}
+
+// encodeMsgpack encodes the message as a MessagePack map with the same keys as
+// the JSON encoding
+func encodeMsgpack(m *Message) ([]byte, error) {
+	var body interface{}
+	if m.Body != "" {
+		d := json.NewDecoder(bytes.NewBufferString(m.Body))
+		d.UseNumber()
+		if err := d.Decode(&body); err != nil {
+			return nil, err
+		}
+	}
+	v := map[string]interface{}{}
+	if m.Type != 0 {
+		v["type"] = json.Number(strconv.Itoa(m.Type))
+	}
+	if m.Func != "" {
+		v["func"] = m.Func
+	}
+	if m.Body != "" {
+		v["body"] = body
+	}
+	var buf bytes.Buffer
+	err := writeMsgpack(&buf, v)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeMsgpack writes the generic value, as produced by decoding JSON with
+// UseNumber or by readMsgpack, to the buffer. Map keys are sorted so the output is stable.
+func writeMsgpack(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			writeMsgpackInt(buf, i)
+			return nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return err
+		}
+		return writeMsgpack(buf, f)
+	case int64:
+		writeMsgpackInt(buf, v)
+	case float64:
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case string:
+		n := len(v)
+		switch {
+		case n < 32:
+			buf.WriteByte(0xa0 | byte(n))
+		case n <= math.MaxUint8:
+			buf.WriteByte(0xd9)
+			buf.WriteByte(byte(n))
+		case n <= math.MaxUint16:
+			buf.WriteByte(0xda)
+			binary.Write(buf, binary.BigEndian, uint16(n))
+		default:
+			buf.WriteByte(0xdb)
+			binary.Write(buf, binary.BigEndian, uint32(n))
+		}
+		buf.WriteString(v)
+	case []interface{}:
+		n := len(v)
+		switch {
+		case n < 16:
+			buf.WriteByte(0x90 | byte(n))
+		case n <= math.MaxUint16:
+			buf.WriteByte(0xdc)
+			binary.Write(buf, binary.BigEndian, uint16(n))
+		default:
+			buf.WriteByte(0xdd)
+			binary.Write(buf, binary.BigEndian, uint32(n))
+		}
+		for _, e := range v {
+			if err := writeMsgpack(buf, e); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		n := len(v)
+		switch {
+		case n < 16:
+			buf.WriteByte(0x80 | byte(n))
+		case n <= math.MaxUint16:
+			buf.WriteByte(0xde)
+			binary.Write(buf, binary.BigEndian, uint16(n))
+		default:
+			buf.WriteByte(0xdf)
+			binary.Write(buf, binary.BigEndian, uint32(n))
+		}
+		keys := make([]string, 0, n)
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			writeMsgpack(buf, k)
+			if err := writeMsgpack(buf, v[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported type %T", v)
+	}
+	return nil
+}
+
+func writeMsgpackInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i <= 127:
+		buf.WriteByte(byte(i))
+	case i < 0 && i >= -32:
+		buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		buf.WriteByte(0xd1)
+		binary.Write(buf, binary.BigEndian, int16(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(i))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, i)
+	}
+}
+
+// readMsgpack decodes a single MessagePack value. Integers are returned as
+// int64, floats as float64, maps as map[string]interface{} and arrays as
+// []interface{}.
+func readMsgpack(r *bytes.Reader) (interface{}, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, ErrMsgpackDecode
+	}
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b&0xe0 == 0xa0:
+		return readMsgpackString(r, int(b&0x1f))
+	case b&0xf0 == 0x90:
+		return readMsgpackArray(r, int(b&0x0f))
+	case b&0xf0 == 0x80:
+		return readMsgpackMap(r, int(b&0x0f))
+	}
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xca:
+		var f uint32
+		err = binary.Read(r, binary.BigEndian, &f)
+		return float64(math.Float32frombits(f)), msgpackErr(err)
+	case 0xcb:
+		var f uint64
+		err = binary.Read(r, binary.BigEndian, &f)
+		return math.Float64frombits(f), msgpackErr(err)
+	case 0xcc, 0xcd, 0xce, 0xcf, 0xd0, 0xd1, 0xd2, 0xd3:
+		return readMsgpackInt(r, b)
+	case 0xd9, 0xda, 0xdb:
+		n, err := readMsgpackLength(r, b-0xd9)
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackString(r, n)
+	case 0xdc, 0xdd:
+		n, err := readMsgpackLength(r, b-0xdc+1)
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackArray(r, n)
+	case 0xde, 0xdf:
+		n, err := readMsgpackLength(r, b-0xde+1)
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackMap(r, n)
+	}
+	return nil, ErrMsgpackDecode
+}
+
+func readMsgpackInt(r *bytes.Reader, b byte) (int64, error) {
+	var err error
+	switch b {
+	case 0xcc:
+		var v uint8
+		err = binary.Read(r, binary.BigEndian, &v)
+		return int64(v), msgpackErr(err)
+	case 0xcd:
+		var v uint16
+		err = binary.Read(r, binary.BigEndian, &v)
+		return int64(v), msgpackErr(err)
+	case 0xce:
+		var v uint32
+		err = binary.Read(r, binary.BigEndian, &v)
+		return int64(v), msgpackErr(err)
+	case 0xcf:
+		var v uint64
+		err = binary.Read(r, binary.BigEndian, &v)
+		return int64(v), msgpackErr(err)
+	case 0xd0:
+		var v int8
+		err = binary.Read(r, binary.BigEndian, &v)
+		return int64(v), msgpackErr(err)
+	case 0xd1:
+		var v int16
+		err = binary.Read(r, binary.BigEndian, &v)
+		return int64(v), msgpackErr(err)
+	case 0xd2:
+		var v int32
+		err = binary.Read(r, binary.BigEndian, &v)
+		return int64(v), msgpackErr(err)
+	default:
+		var v int64
+		err = binary.Read(r, binary.BigEndian, &v)
+		return v, msgpackErr(err)
+	}
+}
+
+// readMsgpackLength reads a big endian length of 1, 2 or 4 bytes, where size
+// is 0, 1 or 2 respectively
+func readMsgpackLength(r *bytes.Reader, size byte) (int, error) {
+	var err error
+	switch size {
+	case 0:
+		var n uint8
+		err = binary.Read(r, binary.BigEndian, &n)
+		return int(n), msgpackErr(err)
+	case 1:
+		var n uint16
+		err = binary.Read(r, binary.BigEndian, &n)
+		return int(n), msgpackErr(err)
+	default:
+		var n uint32
+		err = binary.Read(r, binary.BigEndian, &n)
+		return int(n), msgpackErr(err)
+	}
+}
+
+func readMsgpackString(r *bytes.Reader, n int) (string, error) {
+	if n > r.Len() {
+		return "", ErrMsgpackDecode
+	}
+	b := make([]byte, n)
+	_, err := r.Read(b)
+	if n > 0 && err != nil {
+		return "", ErrMsgpackDecode
+	}
+	return string(b), nil
+}
+
+func readMsgpackArray(r *bytes.Reader, n int) ([]interface{}, error) {
+	if n > r.Len() {
+		return nil, ErrMsgpackDecode
+	}
+	a := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := readMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+func readMsgpackMap(r *bytes.Reader, n int) (map[string]interface{}, error) {
+	if n > r.Len() {
+		return nil, ErrMsgpackDecode
+	}
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := readMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, ErrMsgpackDecode
+		}
+		m[key], err = readMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func msgpackErr(err error) error {
+	if err != nil {
+		return ErrMsgpackDecode
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package websocket
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeJSON(t *testing.T) {
+	m, err := NewMessage("1", "status", "Alive")
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+	got, err := encodeJSON(m)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+	want := `{"func":"status","body":"\"Alive\""}`
+	if string(got) != want {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
+
+func TestEncodeMsgpack(t *testing.T) {
+	m, err := NewMessage("1", "submit", struct {
+		PlayerID int     `json:"player_id"`
+		GameTime float64 `json:"game_time"`
+		Status   string  `json:"status"`
+		IsReplay bool    `json:"is_replay"`
+		Daggers  []int   `json:"daggers"`
+	}{1234, 123.4567, "Alive", false, []int{-1, 200, 70000}})
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+	b, err := encodeMsgpack(m)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+	got, err := readMsgpack(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+	want := map[string]interface{}{
+		"func": "submit",
+		"body": map[string]interface{}{
+			"player_id": int64(1234),
+			"game_time": 123.4567,
+			"status":    "Alive",
+			"is_replay": false,
+			"daggers":   []interface{}{int64(-1), int64(200), int64(70000)},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v; want %#v", got, want)
+	}
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	tests := []interface{}{
+		nil,
+		true,
+		false,
+		int64(0),
+		int64(127),
+		int64(128),
+		int64(-32),
+		int64(-33),
+		int64(math.MaxInt16 + 1),
+		int64(math.MinInt32 - 1),
+		int64(math.MaxInt64),
+		1.5,
+		"",
+		"short",
+		string(make([]byte, 300)),
+		string(make([]byte, 70000)),
+		[]interface{}{},
+		make([]interface{}, 20),
+		make(map[string]interface{}),
+		map[string]interface{}{"a": int64(1), "b": []interface{}{"c"}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		err := writeMsgpack(&buf, tt)
+		if err != nil {
+			t.Fatalf("got error: %v", err)
+		}
+		got, err := readMsgpack(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("got error: %v", err)
+		}
+		if !reflect.DeepEqual(got, tt) {
+			t.Errorf("got %#v; want %#v", got, tt)
+		}
+	}
+}
+
+func TestReadMsgpackTruncated(t *testing.T) {
+	m, _ := NewMessage("1", "submit", map[string]int{"gems": 1000})
+	b, err := encodeMsgpack(m)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+	for i := 0; i < len(b); i++ {
+		_, err := readMsgpack(bytes.NewReader(b[:i]))
+		if err == nil {
+			t.Errorf("expected error decoding %d of %d bytes", i, len(b))
+		}
+	}
+}
+
+func TestMessagePrepareOnce(t *testing.T) {
+	m, _ := NewMessage("1", "status", "Alive")
+	for _, codec := range []string{SubprotocolJSON, SubprotocolMsgpack, ""} {
+		first, err := m.Prepare(codec)
+		if err != nil {
+			t.Fatalf("got error: %v", err)
+		}
+		second, _ := m.Prepare(codec)
+		if first != second {
+			t.Errorf("message encoded more than once for codec %q", codec)
+		}
+	}
+}
+
+func TestDecodeMsgpackRequest(t *testing.T) {
+	var buf bytes.Buffer
+	writeMsgpack(&buf, map[string]interface{}{"func": wsFuncJoinRoom, "body": "race:1", "token": "abc"})
+	var funcName, body, token string
+	err := decodeMsgpackRequest(buf.Bytes(), &funcName, &body, &token)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+	if funcName != wsFuncJoinRoom || body != "race:1" || token != "abc" {
+		t.Errorf("got %q %q %q", funcName, body, token)
+	}
+}
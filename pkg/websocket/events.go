@@ -0,0 +1,97 @@
+package websocket
+
+import "sync"
+
+const (
+	eventHistorySize   = 256
+	eventSubscriberBuf = 32
+)
+
+// Event is a Message which has been published to the EventStream. The ID
+// increases with each event so that clients are able to resume a stream
+// from the last event they received
+type Event struct {
+	ID      uint64
+	Message *Message
+}
+
+// EventStream fans out the messages sent to every client of the hub to any
+// number of subscribers, such as the server-sent events endpoint. A short
+// history of events is kept so that subscribers can catch up after
+// reconnecting.
+type EventStream struct {
+	sync.Mutex
+	nextID      uint64
+	history     []*Event
+	subscribers map[chan *Event]bool
+}
+
+// NewEventStream returns an EventStream
+func NewEventStream() *EventStream {
+	return &EventStream{
+		nextID:      1,
+		history:     make([]*Event, 0, eventHistorySize),
+		subscribers: make(map[chan *Event]bool),
+	}
+}
+
+// Publish assigns the message an ID, stores it in the history and sends it
+// to each subscriber. Subscribers which aren't keeping up are dropped, and
+// their channel closed, rather than holding up the hub or silently missing
+// events.
+func (es *EventStream) Publish(message *Message) {
+	es.Lock()
+	defer es.Unlock()
+	event := &Event{ID: es.nextID, Message: message}
+	es.nextID++
+	if len(es.history) == eventHistorySize {
+		copy(es.history, es.history[1:])
+		es.history = es.history[:eventHistorySize-1]
+	}
+	es.history = append(es.history, event)
+	for subscriber := range es.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			delete(es.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
+
+// Subscribe returns a channel which receives every event published from now
+// on, along with any events still in the history which came after lastEventID.
+// A lastEventID of 0 means no history is returned. The bool is false if some
+// of the events after lastEventID are no longer in the history.
+func (es *EventStream) Subscribe(lastEventID uint64) (chan *Event, []*Event, bool) {
+	es.Lock()
+	defer es.Unlock()
+	subscriber := make(chan *Event, eventSubscriberBuf)
+	es.subscribers[subscriber] = true
+	if lastEventID == 0 {
+		return subscriber, nil, true
+	}
+	switch {
+	case lastEventID+1 == es.nextID:
+		// nothing was missed
+		return subscriber, nil, true
+	case lastEventID >= es.nextID:
+		// the ID is from before the server restarted
+		return subscriber, nil, false
+	}
+	var missed []*Event
+	for _, event := range es.history {
+		if event.ID > lastEventID {
+			missed = append(missed, event)
+		}
+	}
+	// the history holds at least the latest event, so some are missed
+	return subscriber, missed, missed[0].ID == lastEventID+1
+}
+
+// Unsubscribe stops the channel from receiving any further events
+func (es *EventStream) Unsubscribe(subscriber chan *Event) {
+	es.Lock()
+	defer es.Unlock()
+	delete(es.subscribers, subscriber)
+}
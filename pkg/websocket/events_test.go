@@ -0,0 +1,95 @@
+package websocket
+
+import (
+	"fmt"
+	"testing"
+)
+
+func publish(es *EventStream, n int) {
+	for i := 0; i < n; i++ {
+		es.Publish(&Message{Func: "test", Body: fmt.Sprint(i)})
+	}
+}
+
+func eventIDs(events []*Event) []uint64 {
+	ids := make([]uint64, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+	return ids
+}
+
+func TestEventStreamHistory(t *testing.T) {
+	es := NewEventStream()
+	publish(es, eventHistorySize+10)
+	if len(es.history) != eventHistorySize {
+		t.Fatalf("history holds %d events; want %d", len(es.history), eventHistorySize)
+	}
+	if first, last := es.history[0].ID, es.history[eventHistorySize-1].ID; first != 11 || last != eventHistorySize+10 {
+		t.Errorf("history holds events %d to %d; want 11 to %d", first, last, eventHistorySize+10)
+	}
+}
+
+func TestEventStreamResume(t *testing.T) {
+	es := NewEventStream()
+	publish(es, eventHistorySize+10)
+	latest := uint64(eventHistorySize + 10)
+	tests := []struct {
+		name         string
+		lastEventID  uint64
+		wantFirst    uint64
+		wantMissed   int
+		wantComplete bool
+	}{
+		{"new stream", 0, 0, 0, true},
+		{"up to date", latest, 0, 0, true},
+		{"in the history", latest - 5, latest - 4, 5, true},
+		{"oldest in the history", 10, 11, eventHistorySize, true},
+		{"evicted from the history", 5, 11, eventHistorySize, false},
+		{"from before a restart", latest + 100, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subscriber, missed, complete := es.Subscribe(tt.lastEventID)
+			defer es.Unsubscribe(subscriber)
+			if len(missed) != tt.wantMissed {
+				t.Fatalf("missed %d events; want %d", len(missed), tt.wantMissed)
+			}
+			if len(missed) > 0 && missed[0].ID != tt.wantFirst {
+				t.Errorf("first missed event is %d; want %d", missed[0].ID, tt.wantFirst)
+			}
+			if complete != tt.wantComplete {
+				t.Errorf("complete is %v; want %v", complete, tt.wantComplete)
+			}
+		})
+	}
+}
+
+func TestEventStreamSlowSubscriber(t *testing.T) {
+	es := NewEventStream()
+	slow, _, _ := es.Subscribe(0)
+	fast, _, _ := es.Subscribe(0)
+	defer es.Unsubscribe(fast)
+
+	var received []*Event
+	for i := 0; i < eventSubscriberBuf+1; i++ {
+		publish(es, 1)
+		received = append(received, <-fast)
+	}
+	if got := eventIDs(received); got[len(got)-1] != eventSubscriberBuf+1 {
+		t.Errorf("fast subscriber received %v; want every event", got)
+	}
+
+	var buffered []*Event
+	for event := range slow {
+		buffered = append(buffered, event)
+	}
+	if len(buffered) != eventSubscriberBuf {
+		t.Errorf("slow subscriber received %d events before being dropped; want %d", len(buffered), eventSubscriberBuf)
+	}
+	if es.subscribers[slow] {
+		t.Error("slow subscriber is still subscribed")
+	}
+	// unsubscribing a dropped subscriber is harmless
+	es.Unsubscribe(slow)
+}
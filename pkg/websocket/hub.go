@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/alexwilkerson/ddstats-server/pkg/models/postgres"
 )
@@ -12,6 +13,16 @@ const (
 	defaultRoom = "default"
 )
 
+const (
+	// PresenceTTL is how long a row in the live table is considered valid
+	// without being refreshed. Rows older than this are left behind by
+	// instances which have crashed or been restarted.
+	PresenceTTL = 2 * time.Minute
+	// presenceInterval is how often the hub refreshes the live table rows of
+	// the players connected to this instance
+	presenceInterval = 30 * time.Second
+)
+
 type PlayerBestReached struct {
 	PlayerID         int
 	PlayerName       string
@@ -25,9 +36,13 @@ type PlayerBestSubmitted struct {
 	PreviousGameTime float64
 }
 
+// PlayerAboveThreshold is sent when a live run passes one of the player's
+// notification milestones. Dagger is set if the milestone is a dagger time.
 type PlayerAboveThreshold struct {
 	PlayerID   int
 	PlayerName string
+	GameTime   float64
+	Dagger     string
 }
 
 type PlayerAboveThresholdSubmitted struct {
@@ -58,10 +73,19 @@ type Hub struct {
 	SubmitGame       chan int
 	DiscordBroadcast chan interface{}
 	Players          *sync.Map
+	SharedPresence   bool
+	ViewerSecret     []byte
+	PrivateRooms     map[string]bool
 	Clients          map[*Client]bool
 	Rooms            map[string]map[*Client]bool
+	Races            map[string]*Race
+	racesMu          sync.Mutex
+	presence         chan presenceWrite
+	shared           []Player
+	sharedMu         sync.Mutex
 	Broadcast        chan *Message
 	BroadcastToAll   chan *Message
+	Events           *EventStream
 	quit             chan struct{}
 }
 
@@ -83,8 +107,11 @@ func NewHub(db *postgres.Postgres) *Hub {
 		Players:          &sync.Map{},
 		Clients:          map[*Client]bool{},
 		Rooms:            rooms,
+		Races:            make(map[string]*Race),
+		presence:         make(chan presenceWrite, presenceQueueSize),
 		Broadcast:        make(chan *Message, 20),
 		BroadcastToAll:   make(chan *Message, 20),
+		Events:           NewEventStream(),
 		quit:             make(chan struct{}),
 	}
 }
@@ -92,6 +119,8 @@ func NewHub(db *postgres.Postgres) *Hub {
 // Start is intended to be run in a go routine and will handle all communication
 // with websockets.
 func (hub *Hub) Start() {
+	go hub.tickRaces()
+	go hub.writePresence()
 	for {
 		select {
 		case gameID := <-hub.SubmitGame:
@@ -101,13 +130,14 @@ func (hub *Hub) Start() {
 				fmt.Println(err)
 				break
 			}
+			message, err := NewMessage(defaultRoom, "game_submitted", game)
+			if err != nil {
+				fmt.Println(err)
+				break
+			}
+			hub.Events.Publish(message)
 			for client := range hub.Rooms[defaultRoom] {
-				message, err := NewMessage(client.Room, "game_submitted", game)
-				if err != nil {
-					fmt.Println(err)
-					break
-				}
-				err = client.Conn.WriteJSON(message)
+				err = client.Write(message)
 				if err != nil {
 					fmt.Println(err)
 					break
@@ -115,16 +145,21 @@ func (hub *Hub) Start() {
 			}
 		case player := <-hub.RegisterPlayer:
 			hub.Players.Store(player, true)
+			player.Lock()
+			write := presenceWrite{playerID: player.ID, sid: player.SID, status: player.Status}
+			player.Unlock()
+			hub.queuePresence(write)
+			message, err := NewMessage(defaultRoom, "player_logged_in", Player{
+				ID:   player.ID,
+				Name: player.Name,
+			})
+			if err != nil {
+				fmt.Println(err)
+				break
+			}
+			hub.Events.Publish(message)
 			for client := range hub.Clients {
-				message, err := NewMessage(client.Room, "player_logged_in", Player{
-					ID:   player.ID,
-					Name: player.Name,
-				})
-				if err != nil {
-					fmt.Println(err)
-					break
-				}
-				err = client.Conn.WriteJSON(message)
+				err = client.Write(message)
 				if err != nil {
 					fmt.Println(err)
 					break
@@ -132,17 +167,19 @@ func (hub *Hub) Start() {
 			}
 		case player := <-hub.UnregisterPlayer:
 			hub.Players.Delete(player)
+			hub.queuePresence(presenceWrite{playerID: player.ID, sid: player.SID, logout: true})
+			message, err := NewMessage(defaultRoom, "player_logged_off", struct {
+				PlayerID int `json:"player_id"`
+			}{
+				PlayerID: player.ID,
+			})
+			if err != nil {
+				fmt.Println(err)
+				break
+			}
+			hub.Events.Publish(message)
 			for client := range hub.Clients {
-				message, err := NewMessage(defaultRoom, "player_logged_off", struct {
-					PlayerID int `json:"player_id"`
-				}{
-					PlayerID: player.ID,
-				})
-				if err != nil {
-					fmt.Println(err)
-					break
-				}
-				err = client.Conn.WriteJSON(message)
+				err = client.Write(message)
 				if err != nil {
 					fmt.Println(err)
 					break
@@ -168,7 +205,7 @@ func (hub *Hub) Start() {
 				fmt.Println(err)
 				break
 			}
-			err = client.Conn.WriteJSON(message)
+			err = client.Write(message)
 			if err != nil {
 				fmt.Println(err)
 				break
@@ -205,22 +242,7 @@ func (hub *Hub) Start() {
 						delete(hub.Rooms, client.Room)
 						break
 					}
-					for client := range hub.Rooms[client.Room] { // notify each other client in that room that a player left
-						message, err := NewMessage(client.Room, "user_count", struct {
-							Count int `json:"count"`
-						}{
-							Count: len(hub.Rooms[client.Room]),
-						})
-						if err != nil {
-							fmt.Println(err)
-							break
-						}
-						err = client.Conn.WriteJSON(message)
-						if err != nil {
-							fmt.Println(err)
-							break
-						}
-					}
+					hub.sendUserCount(client.Room) // notify each other client in that room that a player left
 				}
 			}
 		case client := <-hub.JoinRoom: // make sure the room is set when the client calls this function
@@ -229,48 +251,19 @@ func (hub *Hub) Start() {
 			}
 			hub.Rooms[client.Room][client] = true // add client to room
 
-			for client := range hub.Rooms[client.Room] { // send user count update to each client including this client
-				message, err := NewMessage(client.Room, "user_count", struct {
-					Count int `json:"count"`
-				}{
-					Count: len(hub.Rooms[client.Room]),
-				})
-				if err != nil {
-					fmt.Println(err)
-					break
-				}
-				err = client.Conn.WriteJSON(message)
-				if err != nil {
-					fmt.Println(err)
-					break
-				}
-			}
+			hub.sendUserCount(client.Room) // send user count update to each client including this client
 		case client := <-hub.LeaveRoom:
-			if _, ok := hub.Rooms[client.Room]; ok { // verify that the user exists in the room
-				delete(hub.Rooms[client.Room], client) // if they do, delete them from the room
-				client.Room = ""                       // make sure their room is empty
+			room := client.Room
+			if _, ok := hub.Rooms[room]; ok { // verify that the user exists in the room
+				delete(hub.Rooms[room], client) // if they do, delete them from the room
+				client.Room = ""                // make sure their room is empty
 
-				if len(hub.Rooms[client.Room]) == 0 { // if the room is empty, delete the room
-					delete(hub.Rooms, client.Room)
+				if len(hub.Rooms[room]) == 0 { // if the room is empty, delete the room
+					delete(hub.Rooms, room)
 					break
 				}
 
-				for client := range hub.Rooms[client.Room] { // notify each other client in that room that a player left
-					message, err := NewMessage(client.Room, "user_count", struct {
-						Count int `json:"count"`
-					}{
-						Count: len(hub.Rooms[client.Room]),
-					})
-					if err != nil {
-						fmt.Println(err)
-						break
-					}
-					err = client.Conn.WriteJSON(message)
-					if err != nil {
-						fmt.Println(err)
-						break
-					}
-				}
+				hub.sendUserCount(room) // notify each other client in that room that a player left
 			}
 		case message := <-hub.Broadcast:
 			// a room only exists if a client user is connected to the server
@@ -278,15 +271,16 @@ func (hub *Hub) Start() {
 				break
 			}
 			for client := range hub.Rooms[message.Room] {
-				err := client.Conn.WriteJSON(message)
+				err := client.Write(message)
 				if err != nil {
 					fmt.Println(err)
 					continue
 				}
 			}
 		case message := <-hub.BroadcastToAll:
+			hub.Events.Publish(message)
 			for client := range hub.Clients {
-				err := client.Conn.WriteJSON(message)
+				err := client.Write(message)
 				if err != nil {
 					fmt.Println(err)
 					continue
@@ -298,6 +292,36 @@ func (hub *Hub) Start() {
 	}
 }
 
+// sendUserCount sends the number of clients in the room to each of them
+func (hub *Hub) sendUserCount(room string) {
+	message, err := NewMessage(room, "user_count", struct {
+		Count int `json:"count"`
+	}{
+		Count: len(hub.Rooms[room]),
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for client := range hub.Rooms[room] {
+		err = client.Write(message)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+	}
+}
+
+// AuthorizeRoom returns an error if the room is private and the token is not a
+// valid viewer token for it. Private rooms are only enforced once a viewer
+// secret has been set.
+func (hub *Hub) AuthorizeRoom(room, token string) error {
+	if len(hub.ViewerSecret) == 0 || !hub.PrivateRooms[room] {
+		return nil
+	}
+	return VerifyViewerToken(hub.ViewerSecret, room, token)
+}
+
 func (hub *Hub) Close() {
 	close(hub.quit)
 }
@@ -1,6 +1,8 @@
 package websocket
 
-import "sync"
+import (
+	"sync"
+)
 
 // Player struct is used to represent a player who is currently
 // playing the game. The fields are populated from the Devil Daggers
@@ -12,12 +14,54 @@ type Player struct {
 	Status   string  `json:"status"`
 }
 
+// PlayerWithLock is the Player as held by the hub. SID is the ID of the
+// socket.io connection which the player logged in with
 type PlayerWithLock struct {
 	sync.Mutex
 	Player
+	SID string
 }
 
+// LivePlayers returns the players currently connected. When SharedPresence
+// is set, the players connected to other instances of the server are included
+// as well, as of when the live table was last read.
 func (hub *Hub) LivePlayers() []Player {
+	players := hub.localLivePlayers()
+	if !hub.SharedPresence {
+		return players
+	}
+	local := make(map[int]bool, len(players))
+	for _, player := range players {
+		local[player.ID] = true
+	}
+	hub.sharedMu.Lock()
+	defer hub.sharedMu.Unlock()
+	for _, player := range hub.shared {
+		if !local[player.ID] {
+			players = append(players, player)
+		}
+	}
+	return players
+}
+
+func (hub *Hub) sharedLivePlayers() ([]Player, error) {
+	livePlayers, err := hub.DB.Live.SelectAll(PresenceTTL)
+	if err != nil {
+		return nil, err
+	}
+	players := make([]Player, 0, len(livePlayers))
+	for _, p := range livePlayers {
+		players = append(players, Player{
+			ID:       p.PlayerID,
+			Name:     p.PlayerName,
+			GameTime: p.GameTime,
+			Status:   p.Status,
+		})
+	}
+	return players, nil
+}
+
+func (hub *Hub) localLivePlayers() []Player {
 	players := []Player{}
 	hub.Players.Range(func(k interface{}, v interface{}) bool {
 		player := k.(*PlayerWithLock)
@@ -0,0 +1,33 @@
+package websocket
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLivePlayersShared(t *testing.T) {
+	hub := NewHub(nil)
+	hub.Players.Store(&PlayerWithLock{Player: Player{ID: 1, Name: "local", Status: "Alive"}, SID: "a"}, true)
+	hub.shared = []Player{{ID: 1, Name: "local", Status: "Dead"}, {ID: 2, Name: "remote"}}
+
+	if got, want := hub.LivePlayers(), []Player{{ID: 1, Name: "local", Status: "Alive"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v without shared presence; want %+v", got, want)
+	}
+	hub.SharedPresence = true
+	if got, want := hub.LivePlayers(), []Player{{ID: 1, Name: "local", Status: "Alive"}, {ID: 2, Name: "remote"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v with shared presence; want %+v", got, want)
+	}
+}
+
+func TestQueuePresenceDropsWhenFull(t *testing.T) {
+	hub := NewHub(nil)
+	for i := 0; i < presenceQueueSize+10; i++ {
+		hub.queuePresence(presenceWrite{playerID: i})
+	}
+	if len(hub.presence) != presenceQueueSize {
+		t.Errorf("got %d queued writes; want %d", len(hub.presence), presenceQueueSize)
+	}
+	if write := <-hub.presence; write.playerID != 0 {
+		t.Errorf("got player %d first; want the oldest write kept", write.playerID)
+	}
+}
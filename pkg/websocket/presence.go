@@ -0,0 +1,106 @@
+package websocket
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+)
+
+// presenceQueueSize is how many logins and logouts can be waiting to be
+// written to the live table before more are dropped
+const presenceQueueSize = 256
+
+// presenceWrite is a login or logout waiting to be written to the live table
+type presenceWrite struct {
+	playerID int
+	sid      string
+	status   string
+	logout   bool
+}
+
+// queuePresence queues the login or logout for writePresence without waiting,
+// so that a slow database never holds up the hub. A write is dropped if the
+// queue is full: a dropped logout's row expires after PresenceTTL, and a
+// dropped login only leaves the player out of other instances' live players.
+func (hub *Hub) queuePresence(write presenceWrite) {
+	select {
+	case hub.presence <- write:
+	default:
+		fmt.Printf("presence queue full, dropped the write for player %d\n", write.playerID)
+	}
+}
+
+// writePresence is run in its own go routine by Start so that the hub never
+// waits on the database. It writes the logins and logouts queued by the hub
+// in order, and once every presenceInterval refreshes the rows of the players
+// connected to this instance, removes the rows left behind by other instances
+// and, with SharedPresence, caches the players connected to every instance.
+func (hub *Hub) writePresence() {
+	ticker := time.NewTicker(presenceInterval)
+	defer ticker.Stop()
+	hub.cacheSharedPlayers()
+	for {
+		select {
+		case write := <-hub.presence:
+			var err error
+			if write.logout {
+				err = hub.DB.Live.Delete(write.playerID, write.sid)
+			} else {
+				err = hub.DB.Live.Upsert(write.playerID, write.sid, write.status)
+			}
+			if err != nil {
+				fmt.Println(err)
+			}
+		case <-ticker.C:
+			hub.refreshPresence()
+			expired, err := hub.DB.Live.DeleteStale(PresenceTTL)
+			if err != nil {
+				fmt.Println(err)
+			} else if expired > 0 {
+				fmt.Printf("expired %d stale live players\n", expired)
+			}
+			hub.cacheSharedPlayers()
+		case <-hub.quit:
+			return
+		}
+	}
+}
+
+// refreshPresence updates the last seen time, status and game time of every
+// player connected to this instance in the live table, in one statement
+func (hub *Hub) refreshPresence() {
+	var players []*models.LivePlayer
+	hub.Players.Range(func(k interface{}, v interface{}) bool {
+		player := k.(*PlayerWithLock)
+		player.Lock()
+		players = append(players, &models.LivePlayer{
+			PlayerID: player.ID,
+			SID:      player.SID,
+			Status:   player.Status,
+			GameTime: player.GameTime,
+		})
+		player.Unlock()
+		return true
+	})
+	err := hub.DB.Live.TouchMany(players)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+// cacheSharedPlayers reads the players connected to every instance from the
+// live table for LivePlayers, if SharedPresence is set
+func (hub *Hub) cacheSharedPlayers() {
+	if !hub.SharedPresence {
+		return
+	}
+	players, err := hub.sharedLivePlayers()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	hub.sharedMu.Lock()
+	hub.shared = players
+	hub.sharedMu.Unlock()
+}
@@ -0,0 +1,391 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alexwilkerson/ddstats-server/pkg/models"
+)
+
+const (
+	raceRoomPrefix   = "race:"
+	raceTickInterval = time.Second
+	// MaxRacePlayers is the largest number of players allowed in a single race
+	MaxRacePlayers = 16
+	// MaxOpenRacesPerPlayer is the largest number of unfinished races a
+	// player can be part of at once
+	MaxOpenRacesPerPlayer = 3
+	// RaceTTL is how long a race can run for, from when it was created,
+	// before it is dropped without being recorded
+	RaceTTL = 2 * time.Hour
+)
+
+var (
+	// ErrRaceExists is returned when creating a race with an ID already in use
+	ErrRaceExists = errors.New("a race with that ID already exists")
+	// ErrRaceNotFound is returned when no live race has the given ID
+	ErrRaceNotFound = errors.New("race not found")
+	// ErrRaceStarted is returned when starting a race which has already started
+	ErrRaceStarted = errors.New("race has already started")
+	// ErrRacePlayers is returned when a race has too few or too many players
+	ErrRacePlayers = errors.New("a race must have between 2 and 16 unique players")
+	// ErrRaceLimit is returned when creating a race with a player who is
+	// already part of MaxOpenRacesPerPlayer races
+	ErrRaceLimit = errors.New("a player is already part of too many open races")
+)
+
+// RaceState is a snapshot of one player's live game which is fed into any
+// races the player is part of
+type RaceState struct {
+	PlayerID      int
+	PlayerName    string
+	GameTime      float64
+	Gems          int
+	EnemiesKilled int
+	DeathType     int
+	IsReplay      bool
+}
+
+// RaceGame is a game submitted by a player, used to complete the race result
+type RaceGame struct {
+	PlayerID  int
+	GameID    int
+	GameTime  float64
+	DeathType string
+	IsReplay  bool
+}
+
+// RaceEntry is one player's standing in a race
+type RaceEntry struct {
+	PlayerID      int     `json:"player_id"`
+	PlayerName    string  `json:"player_name"`
+	GameTime      float64 `json:"game_time"`
+	Gems          int     `json:"gems"`
+	EnemiesKilled int     `json:"enemies_killed"`
+	Alive         bool    `json:"alive"`
+	Eliminated    bool    `json:"eliminated"`
+	Place         int     `json:"place,omitempty"`
+	GameID        int     `json:"game_id,omitempty"`
+	DeathType     string  `json:"death_type,omitempty"`
+}
+
+// Race groups several live players together. Once started, each player's
+// first run is tracked, and players are eliminated in the order they die.
+// The race is complete once every player has submitted the game for that run.
+type Race struct {
+	ID         string       `json:"race_id"`
+	Created    time.Time    `json:"created"`
+	Started    *time.Time   `json:"started,omitempty"`
+	Entries    []*RaceEntry `json:"players"`
+	eliminated int
+	submitted  int
+}
+
+// NewRace returns a Race for the given players. The player IDs must be unique.
+func NewRace(id string, playerIDs []int) (*Race, error) {
+	if len(playerIDs) < 2 || len(playerIDs) > MaxRacePlayers {
+		return nil, ErrRacePlayers
+	}
+	race := &Race{ID: id, Created: time.Now()}
+	seen := make(map[int]bool)
+	for _, playerID := range playerIDs {
+		if seen[playerID] || playerID < 1 {
+			return nil, ErrRacePlayers
+		}
+		seen[playerID] = true
+		race.Entries = append(race.Entries, &RaceEntry{PlayerID: playerID})
+	}
+	return race, nil
+}
+
+// Room returns the name of the websocket room the race is broadcast to
+func (race *Race) Room() string {
+	return raceRoomPrefix + race.ID
+}
+
+// Start marks the race as started. States received before the race starts
+// are ignored.
+func (race *Race) Start(t time.Time) error {
+	if race.Started != nil {
+		return ErrRaceStarted
+	}
+	race.Started = &t
+	return nil
+}
+
+// Update applies a player's state to the race. If the state causes the player
+// to be eliminated, their entry is returned.
+func (race *Race) Update(state *RaceState) *RaceEntry {
+	entry := race.entry(state.PlayerID)
+	if entry == nil || race.Started == nil || entry.Eliminated || state.IsReplay {
+		return nil
+	}
+	if state.PlayerName != "" {
+		entry.PlayerName = state.PlayerName
+	}
+	switch {
+	case state.DeathType == -1:
+		entry.Alive = true
+		entry.GameTime = state.GameTime
+		entry.Gems = state.Gems
+		entry.EnemiesKilled = state.EnemiesKilled
+	case state.DeathType >= 0 && entry.Alive:
+		entry.Alive = false
+		entry.Eliminated = true
+		entry.GameTime = state.GameTime
+		entry.Gems = state.Gems
+		entry.EnemiesKilled = state.EnemiesKilled
+		entry.Place = len(race.Entries) - race.eliminated
+		race.eliminated++
+		return entry
+	}
+	return nil
+}
+
+// Submit attaches a submitted game to an eliminated player's entry and
+// returns true once every player's game has been submitted.
+func (race *Race) Submit(game *RaceGame) bool {
+	entry := race.entry(game.PlayerID)
+	if entry == nil || !entry.Eliminated || entry.GameID != 0 || game.IsReplay {
+		return false
+	}
+	entry.GameID = game.GameID
+	entry.GameTime = game.GameTime
+	entry.DeathType = game.DeathType
+	race.submitted++
+	return race.submitted == len(race.Entries)
+}
+
+// Timeline returns a copy of every entry in the race
+func (race *Race) Timeline() []RaceEntry {
+	entries := make([]RaceEntry, 0, len(race.Entries))
+	for _, entry := range race.Entries {
+		entries = append(entries, *entry)
+	}
+	return entries
+}
+
+// HasPlayer returns true if the player is part of the race
+func (race *Race) HasPlayer(playerID int) bool {
+	return race.entry(playerID) != nil
+}
+
+func (race *Race) entry(playerID int) *RaceEntry {
+	for _, entry := range race.Entries {
+		if entry.PlayerID == playerID {
+			return entry
+		}
+	}
+	return nil
+}
+
+// CreateRace registers a new race and announces it to the race room
+func (hub *Hub) CreateRace(id string, playerIDs []int) (*Race, error) {
+	race, err := NewRace(id, playerIDs)
+	if err != nil {
+		return nil, err
+	}
+	hub.racesMu.Lock()
+	if _, ok := hub.Races[id]; ok {
+		hub.racesMu.Unlock()
+		return nil, ErrRaceExists
+	}
+	for _, playerID := range playerIDs {
+		if hub.openRaces(playerID) >= MaxOpenRacesPerPlayer {
+			hub.racesMu.Unlock()
+			return nil, ErrRaceLimit
+		}
+	}
+	hub.Races[id] = race
+	created := race.copy()
+	hub.racesMu.Unlock()
+	hub.broadcast(raceMessage(created, "race_created", created))
+	return created, nil
+}
+
+// StartRace sends the start signal to a race
+func (hub *Hub) StartRace(id string) error {
+	hub.racesMu.Lock()
+	race, ok := hub.Races[id]
+	if !ok {
+		hub.racesMu.Unlock()
+		return ErrRaceNotFound
+	}
+	err := race.Start(time.Now())
+	if err != nil {
+		hub.racesMu.Unlock()
+		return err
+	}
+	started := race.copy()
+	hub.racesMu.Unlock()
+	hub.broadcast(raceMessage(started, "race_started", started))
+	return nil
+}
+
+// LiveRace returns a copy of the race with the given ID if it is still running
+func (hub *Hub) LiveRace(id string) (*Race, error) {
+	hub.racesMu.Lock()
+	defer hub.racesMu.Unlock()
+	race, ok := hub.Races[id]
+	if !ok {
+		return nil, ErrRaceNotFound
+	}
+	return race.copy(), nil
+}
+
+// UpdateRaces feeds a player's live state into every race they are part of,
+// announcing any eliminations
+func (hub *Hub) UpdateRaces(state *RaceState) {
+	var messages []*Message
+	hub.racesMu.Lock()
+	for _, race := range hub.Races {
+		if entry := race.Update(state); entry != nil {
+			messages = append(messages, raceMessage(race, "race_elimination", struct {
+				RaceID string `json:"race_id"`
+				RaceEntry
+			}{race.ID, *entry}))
+		}
+	}
+	hub.racesMu.Unlock()
+	hub.broadcast(messages...)
+}
+
+// SubmitRaceGame attaches a submitted game to every race the player is part
+// of. Races which are complete are removed, then recorded to the database.
+func (hub *Hub) SubmitRaceGame(game *RaceGame) {
+	var finished []*Race
+	var results []*models.Race
+	hub.racesMu.Lock()
+	for id, race := range hub.Races {
+		if !race.Submit(game) {
+			continue
+		}
+		finished = append(finished, race)
+		results = append(results, race.result(time.Now()))
+		delete(hub.Races, id)
+	}
+	hub.racesMu.Unlock()
+	// the finished races are no longer in hub.Races, so nothing else changes
+	// them
+	for i, result := range results {
+		err := hub.DB.Races.Insert(result)
+		if err != nil {
+			fmt.Println(err)
+		}
+		hub.broadcast(raceMessage(finished[i], "race_finished", result))
+	}
+}
+
+// tickRaces sends the merged timeline of every started race to its room
+// once per raceTickInterval, and drops races which haven't finished within
+// RaceTTL of being created
+func (hub *Hub) tickRaces() {
+	ticker := time.NewTicker(raceTickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			hub.broadcast(hub.sweepRaces(now)...)
+		case <-hub.quit:
+			return
+		}
+	}
+}
+
+// sweepRaces removes the races which have expired and returns the messages
+// announcing them, along with the timeline of every other started race
+func (hub *Hub) sweepRaces(now time.Time) []*Message {
+	var messages []*Message
+	hub.racesMu.Lock()
+	defer hub.racesMu.Unlock()
+	for id, race := range hub.Races {
+		if now.Sub(race.Created) > RaceTTL {
+			delete(hub.Races, id)
+			messages = append(messages, raceMessage(race, "race_expired", struct {
+				RaceID string `json:"race_id"`
+			}{race.ID}))
+			continue
+		}
+		if race.Started == nil {
+			continue
+		}
+		messages = append(messages, raceMessage(race, "race_tick", struct {
+			RaceID  string      `json:"race_id"`
+			Elapsed float64     `json:"elapsed"`
+			Players []RaceEntry `json:"players"`
+		}{race.ID, now.Sub(*race.Started).Seconds(), race.Timeline()}))
+	}
+	return messages
+}
+
+// openRaces returns the number of races the player is part of. The caller
+// must hold racesMu.
+func (hub *Hub) openRaces(playerID int) int {
+	var n int
+	for _, race := range hub.Races {
+		if race.HasPlayer(playerID) {
+			n++
+		}
+	}
+	return n
+}
+
+// broadcast sends the messages to their rooms. It must not be called while
+// holding racesMu, since it blocks until the hub receives each message.
+func (hub *Hub) broadcast(messages ...*Message) {
+	for _, message := range messages {
+		if message != nil {
+			hub.Broadcast <- message
+		}
+	}
+}
+
+// raceMessage encodes a message to the race room, or returns nil if it can't
+// be encoded
+func raceMessage(race *Race, funcName string, v interface{}) *Message {
+	message, err := NewMessage(race.Room(), funcName, v)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	return message
+}
+
+// copy returns a copy of the race which can be read without holding racesMu
+func (race *Race) copy() *Race {
+	return &Race{
+		ID:      race.ID,
+		Created: race.Created,
+		Started: race.Started,
+		Entries: entryPointers(race.Timeline()),
+	}
+}
+
+func (race *Race) result(finished time.Time) *models.Race {
+	result := models.Race{
+		ID:       race.ID,
+		Created:  race.Created,
+		Started:  *race.Started,
+		Finished: finished,
+	}
+	for _, entry := range race.Entries {
+		result.Players = append(result.Players, &models.RacePlayer{
+			RaceID:     race.ID,
+			PlayerID:   entry.PlayerID,
+			PlayerName: entry.PlayerName,
+			GameID:     entry.GameID,
+			GameTime:   entry.GameTime,
+			Place:      entry.Place,
+		})
+	}
+	return &result
+}
+
+func entryPointers(entries []RaceEntry) []*RaceEntry {
+	pointers := make([]*RaceEntry, 0, len(entries))
+	for i := range entries {
+		pointers = append(pointers, &entries[i])
+	}
+	return pointers
+}
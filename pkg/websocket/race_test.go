@@ -0,0 +1,127 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestRace(t *testing.T) {
+	race, err := NewRace("test", []int{1, 2, 3})
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	if e := race.Update(&RaceState{PlayerID: 1, GameTime: 5, DeathType: -1}); e != nil || race.Entries[0].Alive {
+		t.Errorf("state before start should be ignored")
+	}
+
+	race.Start(time.Now())
+	for _, id := range []int{1, 2, 3} {
+		race.Update(&RaceState{PlayerID: id, GameTime: 10, DeathType: -1})
+	}
+	race.Update(&RaceState{PlayerID: 4, GameTime: 10, DeathType: -1})
+
+	if e := race.Update(&RaceState{PlayerID: 2, GameTime: 20, DeathType: 1}); e == nil || e.Place != 3 {
+		t.Errorf("got %+v; want player 2 eliminated in place 3", e)
+	}
+	if e := race.Update(&RaceState{PlayerID: 2, GameTime: 1, DeathType: -1}); e != nil || race.Entries[1].Alive {
+		t.Errorf("eliminated player should stay eliminated")
+	}
+	if e := race.Update(&RaceState{PlayerID: 3, GameTime: 30, DeathType: 1}); e == nil || e.Place != 2 {
+		t.Errorf("got %+v; want player 3 eliminated in place 2", e)
+	}
+
+	if race.Submit(&RaceGame{PlayerID: 1, GameID: 100}) {
+		t.Errorf("player still alive should not be able to submit")
+	}
+	if race.Submit(&RaceGame{PlayerID: 2, GameID: 101, GameTime: 20}) {
+		t.Errorf("race should not be complete after one submission")
+	}
+	if race.Submit(&RaceGame{PlayerID: 2, GameID: 102}) {
+		t.Errorf("duplicate submission should be ignored")
+	}
+
+	if e := race.Update(&RaceState{PlayerID: 1, GameTime: 40, DeathType: 1}); e == nil || e.Place != 1 {
+		t.Errorf("got %+v; want player 1 eliminated in place 1", e)
+	}
+	race.Submit(&RaceGame{PlayerID: 3, GameID: 103, GameTime: 30})
+	if !race.Submit(&RaceGame{PlayerID: 1, GameID: 104, GameTime: 40}) {
+		t.Errorf("race should be complete once every player has submitted")
+	}
+}
+
+func TestNewRace(t *testing.T) {
+	tests := []struct {
+		name      string
+		playerIDs []int
+		wantErr   bool
+	}{
+		{"two players", []int{1, 2}, false},
+		{"one player", []int{1}, true},
+		{"duplicate players", []int{1, 1}, true},
+		{"invalid player", []int{0, 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRace("test", tt.playerIDs)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v; want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateRaceLimit(t *testing.T) {
+	hub := NewHub(nil)
+	for i := 0; i < MaxOpenRacesPerPlayer; i++ {
+		_, err := hub.CreateRace(fmt.Sprint("race", i), []int{1, 2 + i})
+		if err != nil {
+			t.Fatalf("got error: %v", err)
+		}
+	}
+	_, err := hub.CreateRace("one too many", []int{1, 10})
+	if !errors.Is(err, ErrRaceLimit) {
+		t.Errorf("got error %v; want %v", err, ErrRaceLimit)
+	}
+	_, err = hub.CreateRace("race0", []int{20, 21})
+	if !errors.Is(err, ErrRaceExists) {
+		t.Errorf("got error %v; want %v", err, ErrRaceExists)
+	}
+	_, err = hub.CreateRace("other players", []int{20, 21})
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+}
+
+func TestSweepRaces(t *testing.T) {
+	hub := NewHub(nil)
+	now := time.Now()
+	for _, id := range []string{"expired", "started", "waiting"} {
+		_, err := hub.CreateRace(id, []int{1, 2})
+		if err != nil {
+			t.Fatalf("got error: %v", err)
+		}
+	}
+	hub.Races["expired"].Created = now.Add(-RaceTTL - time.Second)
+	hub.StartRace("started")
+
+	var funcs []string
+	for _, message := range hub.sweepRaces(now) {
+		funcs = append(funcs, message.Room+" "+message.Func)
+	}
+	sort.Strings(funcs)
+	want := []string{"race:expired race_expired", "race:started race_tick"}
+	if !reflect.DeepEqual(funcs, want) {
+		t.Errorf("got messages %v; want %v", funcs, want)
+	}
+	if _, err := hub.LiveRace("expired"); !errors.Is(err, ErrRaceNotFound) {
+		t.Errorf("expired race should have been removed")
+	}
+	if _, err := hub.LiveRace("waiting"); err != nil {
+		t.Errorf("got error %v for a race which hasn't expired", err)
+	}
+}
@@ -0,0 +1,109 @@
+package websocket
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidViewerToken is returned when a viewer token is malformed, has
+	// been tampered with or was signed for a different room
+	ErrInvalidViewerToken = errors.New("invalid viewer token")
+	// ErrExpiredViewerToken is returned when a viewer token has expired
+	ErrExpiredViewerToken = errors.New("viewer token has expired")
+	// ErrInvalidPlayerToken is returned when a player token is malformed or
+	// has been tampered with
+	ErrInvalidPlayerToken = errors.New("invalid player token")
+	// ErrExpiredPlayerToken is returned when a player token has expired
+	ErrExpiredPlayerToken = errors.New("player token has expired")
+)
+
+// SignViewerToken returns a token which allows a viewer to join the given
+// private room until the token expires. The token is made up of the base64
+// encoded room and expiry time, followed by an HMAC-SHA256 signature.
+func SignViewerToken(secret []byte, room string, expires time.Time) string {
+	return signToken(secret, room, expires)
+}
+
+// VerifyViewerToken checks that the token was signed with the secret for the
+// given room and has not yet expired
+func VerifyViewerToken(secret []byte, room, token string) error {
+	subject, expires, ok := verifyToken(secret, token)
+	if !ok || subject != room {
+		return ErrInvalidViewerToken
+	}
+	if time.Now().Unix() > expires {
+		return ErrExpiredViewerToken
+	}
+	return nil
+}
+
+// SignPlayerToken returns a token which proves that the bearer acts for the
+// player until the token expires. It has the same format as a viewer token,
+// and should be signed with a different secret.
+func SignPlayerToken(secret []byte, playerID int, expires time.Time) string {
+	return signToken(secret, strconv.Itoa(playerID), expires)
+}
+
+// VerifyPlayerToken checks that the token was signed with the secret and has
+// not yet expired, and returns the ID of the player it was signed for
+func VerifyPlayerToken(secret []byte, token string) (int, error) {
+	subject, expires, ok := verifyToken(secret, token)
+	if !ok {
+		return 0, ErrInvalidPlayerToken
+	}
+	playerID, err := strconv.Atoi(subject)
+	if err != nil || playerID < 1 {
+		return 0, ErrInvalidPlayerToken
+	}
+	if time.Now().Unix() > expires {
+		return 0, ErrExpiredPlayerToken
+	}
+	return playerID, nil
+}
+
+func signToken(secret []byte, subject string, expires time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s|%d", subject, expires.Unix())))
+	return payload + "." + tokenSignature(secret, payload)
+}
+
+// verifyToken returns the subject and expiry time of the token if it was
+// signed with the secret
+func verifyToken(secret []byte, token string) (string, int64, bool) {
+	if len(secret) == 0 {
+		return "", 0, false
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return "", 0, false
+	}
+	if !hmac.Equal([]byte(parts[1]), []byte(tokenSignature(secret, parts[0]))) {
+		return "", 0, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", 0, false
+	}
+	sep := strings.LastIndex(string(payload), "|")
+	if sep == -1 {
+		return "", 0, false
+	}
+	expires, err := strconv.ParseInt(string(payload[sep+1:]), 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return string(payload[:sep]), expires, true
+}
+
+func tokenSignature(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,61 @@
+package websocket
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifyViewerToken(t *testing.T) {
+	secret := []byte("secret")
+	valid := SignViewerToken(secret, "tournament", time.Now().Add(time.Hour))
+	tests := []struct {
+		name   string
+		secret []byte
+		room   string
+		token  string
+		want   error
+	}{
+		{"valid", secret, "tournament", valid, nil},
+		{"wrong room", secret, "1234", valid, ErrInvalidViewerToken},
+		{"wrong secret", []byte("other"), "tournament", valid, ErrInvalidViewerToken},
+		{"expired", secret, "tournament", SignViewerToken(secret, "tournament", time.Now().Add(-time.Hour)), ErrExpiredViewerToken},
+		{"malformed", secret, "tournament", "garbage", ErrInvalidViewerToken},
+		{"empty", secret, "tournament", "", ErrInvalidViewerToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := VerifyViewerToken(tt.secret, tt.room, tt.token)
+			if !errors.Is(got, tt.want) {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyPlayerToken(t *testing.T) {
+	secret := []byte("secret")
+	valid := SignPlayerToken(secret, 42, time.Now().Add(time.Hour))
+	tests := []struct {
+		name   string
+		secret []byte
+		token  string
+		want   int
+		err    error
+	}{
+		{"valid", secret, valid, 42, nil},
+		{"wrong secret", []byte("other"), valid, 0, ErrInvalidPlayerToken},
+		{"no secret", nil, SignPlayerToken(nil, 42, time.Now().Add(time.Hour)), 0, ErrInvalidPlayerToken},
+		{"expired", secret, SignPlayerToken(secret, 42, time.Now().Add(-time.Hour)), 0, ErrExpiredPlayerToken},
+		{"viewer token", secret, SignViewerToken(secret, "tournament", time.Now().Add(time.Hour)), 0, ErrInvalidPlayerToken},
+		{"malformed", secret, "garbage", 0, ErrInvalidPlayerToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyPlayerToken(tt.secret, tt.token)
+			if got != tt.want || !errors.Is(err, tt.err) {
+				t.Errorf("got %d, %v; want %d, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
@@ -1,22 +1,138 @@
 package websocket
 
 import (
+	"errors"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
 
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin:     func(r *http.Request) bool { return true },
+var (
+	// ErrOriginNotAllowed is returned when the Origin header of the request is
+	// not in the list of allowed origins
+	ErrOriginNotAllowed = errors.New("origin not allowed")
+	// ErrTooManyConnections is returned when the remote address already has the
+	// maximum number of websocket connections open
+	ErrTooManyConnections = errors.New("too many connections from this address")
+)
+
+// Upgrader upgrades http requests to websocket connections after checking the
+// origin against the allow-list and limiting the number of connections
+// per IP address
+type Upgrader struct {
+	sync.Mutex
+	upgrader       websocket.Upgrader
+	allowedOrigins map[string]bool
+	maxConnsPerIP  int
+	connsPerIP     map[string]int
+
+	// TrustForwardedFor limits the connections by the address the reverse
+	// proxy in front of the server appended to X-Forwarded-For, instead of
+	// the address of the proxy itself. It must only be set behind a proxy,
+	// otherwise clients can pick their own address.
+	TrustForwardedFor bool
+}
+
+// NewUpgrader returns an Upgrader. If allowedOrigins is empty or contains "*",
+// every origin is allowed. A maxConnsPerIP of 0 means there is no limit.
+func NewUpgrader(allowedOrigins []string, maxConnsPerIP int) *Upgrader {
+	u := &Upgrader{
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			Subprotocols:    []string{SubprotocolMsgpack, SubprotocolJSON},
+			// the origin has already been checked by the time the
+			// gorilla upgrader is called
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		maxConnsPerIP: maxConnsPerIP,
+		connsPerIP:    make(map[string]int),
+	}
+	for _, origin := range allowedOrigins {
+		if origin = strings.TrimSpace(origin); origin == "*" {
+			u.allowedOrigins = nil
+			break
+		} else if origin != "" {
+			if u.allowedOrigins == nil {
+				u.allowedOrigins = make(map[string]bool)
+			}
+			u.allowedOrigins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+		}
+	}
+	return u
 }
 
-// Upgrade upgrades the connection to a websocket connection
-func Upgrade(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+// Upgrade upgrades the connection to a websocket connection. Every successful
+// call must be followed by a call to Release once the connection is closed.
+func (u *Upgrader) Upgrade(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
+	if !u.originAllowed(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return nil, ErrOriginNotAllowed
+	}
+	if !u.acquire(r) {
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return nil, ErrTooManyConnections
+	}
+	conn, err := u.upgrader.Upgrade(w, r, nil)
 	if err != nil {
+		u.Release(r)
 		return nil, err
 	}
 	return conn, nil
 }
+
+// Release frees up the connection slot taken by the remote address of r
+func (u *Upgrader) Release(r *http.Request) {
+	ip := u.remoteIP(r)
+	u.Lock()
+	defer u.Unlock()
+	u.connsPerIP[ip]--
+	if u.connsPerIP[ip] <= 0 {
+		delete(u.connsPerIP, ip)
+	}
+}
+
+func (u *Upgrader) originAllowed(r *http.Request) bool {
+	if u.allowedOrigins == nil {
+		return true
+	}
+	origin := r.Header.Get("Origin")
+	// non-browser clients don't send an origin
+	if origin == "" {
+		return true
+	}
+	return u.allowedOrigins[strings.ToLower(origin)]
+}
+
+func (u *Upgrader) acquire(r *http.Request) bool {
+	ip := u.remoteIP(r)
+	u.Lock()
+	defer u.Unlock()
+	if u.maxConnsPerIP > 0 && u.connsPerIP[ip] >= u.maxConnsPerIP {
+		return false
+	}
+	u.connsPerIP[ip]++
+	return true
+}
+
+func (u *Upgrader) remoteIP(r *http.Request) string {
+	if u.TrustForwardedFor {
+		// the last address is the one added by the proxy, any before it
+		// were sent by the client
+		forwarded := r.Header.Values("X-Forwarded-For")
+		if len(forwarded) > 0 {
+			addrs := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(addrs[len(addrs)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
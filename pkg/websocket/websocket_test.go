@@ -0,0 +1,102 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{"no allow-list", nil, "https://evil.example", true},
+		{"wildcard", []string{"https://ddstats.com", "*"}, "https://evil.example", true},
+		{"allowed", []string{" https://ddstats.com/ "}, "https://ddstats.com", true},
+		{"different case", []string{"https://DDStats.com"}, "https://ddstats.COM", true},
+		{"not allowed", []string{"https://ddstats.com"}, "https://evil.example", false},
+		{"no origin", []string{"https://ddstats.com"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUpgrader(tt.allowed, 0)
+			r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := u.originAllowed(r); got != tt.want {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAcquireRelease(t *testing.T) {
+	u := NewUpgrader(nil, 2)
+	request := func(remoteAddr string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		r.RemoteAddr = remoteAddr
+		return r
+	}
+
+	first, second := request("1.2.3.4:1000"), request("1.2.3.4:1001")
+	if !u.acquire(first) || !u.acquire(second) {
+		t.Fatal("connections up to the limit were refused")
+	}
+	if u.acquire(request("1.2.3.4:1002")) {
+		t.Error("connection over the limit was accepted")
+	}
+	if !u.acquire(request("5.6.7.8:1000")) {
+		t.Error("connection from another address was refused")
+	}
+	u.Release(first)
+	if !u.acquire(request("1.2.3.4:1003")) {
+		t.Error("connection after a release was refused")
+	}
+
+	u.Release(second)
+	u.Release(first)
+	if _, ok := u.connsPerIP["1.2.3.4"]; ok {
+		t.Errorf("released address still counts %d connections", u.connsPerIP["1.2.3.4"])
+	}
+
+	unlimited := NewUpgrader(nil, 0)
+	for i := 0; i < 100; i++ {
+		if !unlimited.acquire(first) {
+			t.Fatal("connection refused without a limit")
+		}
+	}
+}
+
+func TestRemoteIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		trust     bool
+		forwarded []string
+		want      string
+	}{
+		{"direct", false, nil, "10.0.0.1"},
+		{"forwarded for ignored", false, []string{"1.2.3.4"}, "10.0.0.1"},
+		{"forwarded for", true, []string{"1.2.3.4"}, "1.2.3.4"},
+		{"spoofed forwarded for", true, []string{"6.6.6.6, 1.2.3.4"}, "1.2.3.4"},
+		{"several headers", true, []string{"6.6.6.6", "1.2.3.4"}, "1.2.3.4"},
+		{"no forwarded for", true, nil, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUpgrader(nil, 1)
+			u.TrustForwardedFor = tt.trust
+			r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			r.RemoteAddr = "10.0.0.1:1000"
+			for _, forwarded := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", forwarded)
+			}
+			if got := u.remoteIP(r); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
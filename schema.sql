@@ -1,14 +1,24 @@
 DROP TABLE collector_new_player;
 DROP TABLE collector_active_player;
 DROP TABLE collector_high_score;
+DROP TABLE collector_run_death_type;
+DROP TABLE collector_anomaly;
+DROP TABLE collector_run_state;
+DROP TABLE collector_player_snapshot;
 DROP TABLE collector_player;
 DROP TABLE collector_run;
+DROP TABLE collector_status;
 DROP TABLE news;
 DROP TABLE release_note;
 DROP TABLE release;
 DROP TABLE message_of_the_day;
 DROP TABLE death_type;
 DROP TABLE spawnset;
+DROP TABLE notification_rule;
+DROP TABLE play_session_event;
+DROP TABLE play_session;
+DROP TABLE race_player;
+DROP TABLE race;
 DROP TABLE live;
 DROP TABLE player;
 DROP TABLE state;
@@ -38,7 +48,8 @@ CREATE TABLE IF NOT EXISTS game (
   homing_daggers_max_time DOUBLE PRECISION DEFAULT 0.0,
   enemies_alive_max_time DOUBLE PRECISION DEFAULT 0.0,
   homing_daggers_max BIGINT NOT NULL,
-  enemies_alive_max BIGINT NOT NULL
+  enemies_alive_max BIGINT NOT NULL,
+  source TEXT NOT NULL DEFAULT 'client'
 );
 
 CREATE TABLE IF NOT EXISTS state (
@@ -83,7 +94,57 @@ CREATE TABLE IF NOT EXISTS replay_player (
 
 CREATE TABLE IF NOT EXISTS live (
   player_id INTEGER PRIMARY KEY NOT NULL REFERENCES player(id) ON DELETE CASCADE ON UPDATE CASCADE,
-  sid TEXT NOT NULL
+  sid TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT '',
+  game_time DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+  logged_in TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS live_last_seen_idx ON live(last_seen);
+
+CREATE TABLE IF NOT EXISTS race (
+  id TEXT PRIMARY KEY NOT NULL,
+  created TIMESTAMP WITH TIME ZONE NOT NULL,
+  started TIMESTAMP WITH TIME ZONE NOT NULL,
+  finished TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS race_player (
+  race_id TEXT NOT NULL REFERENCES race(id) ON DELETE CASCADE ON UPDATE CASCADE,
+  player_id INTEGER NOT NULL REFERENCES player(id) ON DELETE CASCADE ON UPDATE CASCADE,
+  player_name TEXT NOT NULL DEFAULT '',
+  game_id BIGINT REFERENCES game(id) ON DELETE SET NULL ON UPDATE CASCADE,
+  game_time DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+  place INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (race_id, player_id)
+);
+
+CREATE TABLE IF NOT EXISTS play_session (
+  id BIGSERIAL PRIMARY KEY NOT NULL,
+  player_id INTEGER NOT NULL REFERENCES player(id) ON DELETE CASCADE ON UPDATE CASCADE,
+  sid TEXT NOT NULL,
+  started TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  ended TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS play_session_player_id_idx ON play_session(player_id, started DESC);
+
+CREATE TABLE IF NOT EXISTS play_session_event (
+  play_session_id BIGINT NOT NULL REFERENCES play_session(id) ON DELETE CASCADE ON UPDATE CASCADE,
+  event TEXT NOT NULL,
+  game_time DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+  at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS play_session_event_play_session_id_idx ON play_session_event(play_session_id, at);
+
+CREATE TABLE IF NOT EXISTS notification_rule (
+  player_id INTEGER NOT NULL REFERENCES player(id) ON DELETE CASCADE ON UPDATE CASCADE,
+  spawnset TEXT NOT NULL DEFAULT '',
+  milestones DOUBLE PRECISION[] NOT NULL DEFAULT '{}',
+  dagger_tiers BOOLEAN NOT NULL DEFAULT FALSE,
+  PRIMARY KEY (player_id, spawnset)
 );
 
 CREATE TABLE IF NOT EXISTS spawnset (
@@ -172,23 +233,59 @@ CREATE TABLE IF NOT EXISTS collector_run (
   since_bronze_daggers INTEGER NOT NULL DEFAULT 0,
   since_silver_daggers INTEGER NOT NULL DEFAULT 0,
   since_gold_daggers INTEGER NOT NULL DEFAULT 0,
-  since_devil_daggers INTEGER NOT NULL DEFAULT 0,
-  fallen INTEGER NOT NULL DEFAULT 0,
-  swarmed INTEGER NOT NULL DEFAULT 0,
-  impaled INTEGER NOT NULL DEFAULT 0,
-  gored INTEGER NOT NULL DEFAULT 0,
-  infested INTEGER NOT NULL DEFAULT 0,
-  opened INTEGER NOT NULL DEFAULT 0,
-  purged INTEGER NOT NULL DEFAULT 0,
-  desecrated INTEGER NOT NULL DEFAULT 0,
-  sacrificed INTEGER NOT NULL DEFAULT 0,
-  eviscerated INTEGER NOT NULL DEFAULT 0,
-  annihilated INTEGER NOT NULL DEFAULT 0,
-  intoxicated INTEGER NOT NULL DEFAULT 0,
-  envenmonated INTEGER NOT NULL DEFAULT 0,
-  incarnated INTEGER NOT NULL DEFAULT 0,
-  discarnated INTEGER NOT NULL DEFAULT 0,
-  barbed INTEGER NOT NULL DEFAULT 0
+  since_devil_daggers INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS collector_run_death_type (
+  collector_run_id BIGINT REFERENCES collector_run(id) ON UPDATE CASCADE ON DELETE CASCADE,
+  death_type TEXT NOT NULL,
+  count INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (collector_run_id, death_type)
+);
+
+-- a partition is created for every month by the collector, so that a
+-- player's history only reads the months it covers. time_stamp is the time
+-- stamp of the run.
+CREATE TABLE IF NOT EXISTS collector_player_snapshot (
+  collector_run_id BIGINT NOT NULL REFERENCES collector_run(id) ON UPDATE CASCADE ON DELETE CASCADE,
+  time_stamp TIMESTAMP WITH TIME ZONE NOT NULL,
+  collector_player_id INTEGER NOT NULL,
+  rank INTEGER NOT NULL DEFAULT 0,
+  game_time DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+  overall_deaths BIGINT NOT NULL DEFAULT 0,
+  overall_game_time DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+  PRIMARY KEY (collector_run_id, collector_player_id, time_stamp)
+) PARTITION BY RANGE (time_stamp);
+
+CREATE INDEX IF NOT EXISTS collector_player_snapshot_collector_player_id_time_stamp_idx ON collector_player_snapshot(collector_player_id, time_stamp);
+
+CREATE TABLE IF NOT EXISTS collector_run_state (
+  collector_run_id BIGINT PRIMARY KEY REFERENCES collector_run(id) ON UPDATE CASCADE ON DELETE CASCADE,
+  next_rank INTEGER NOT NULL DEFAULT 1,
+  run_time BIGINT NOT NULL DEFAULT 0,
+  total_players INTEGER NOT NULL DEFAULT 0,
+  active_players INTEGER NOT NULL DEFAULT 0,
+  players_with_new_scores INTEGER NOT NULL DEFAULT 0,
+  players_with_new_ranks INTEGER NOT NULL DEFAULT 0,
+  player_improvement_time DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+  player_rank_improvement BIGINT NOT NULL DEFAULT 0,
+  player_game_time DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+  player_deaths BIGINT NOT NULL DEFAULT 0,
+  player_gems BIGINT NOT NULL DEFAULT 0,
+  player_enemies_killed BIGINT NOT NULL DEFAULT 0,
+  player_daggers_hit BIGINT NOT NULL DEFAULT 0,
+  player_daggers_fired BIGINT NOT NULL DEFAULT 0,
+  world_record DOUBLE PRECISION NOT NULL DEFAULT 0.0
+);
+
+CREATE TABLE IF NOT EXISTS collector_status (
+  id INTEGER PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+  running BOOLEAN NOT NULL DEFAULT FALSE,
+  last_started TIMESTAMP WITH TIME ZONE,
+  last_success TIMESTAMP WITH TIME ZONE,
+  last_duration BIGINT NOT NULL DEFAULT 0,
+  last_error TEXT NOT NULL DEFAULT '',
+  next_run TIMESTAMP WITH TIME ZONE
 );
 
 CREATE TABLE IF NOT EXISTS collector_player (
@@ -240,6 +337,25 @@ CREATE TABLE IF NOT EXISTS collector_new_player (
 
 CREATE INDEX IF NOT EXISTS collector_new_player_collector_run_id_idx ON collector_new_player(collector_run_id);
 
+-- scores flagged by the collector for review, announced on discord by the
+-- server
+CREATE TABLE IF NOT EXISTS collector_anomaly (
+  id BIGSERIAL PRIMARY KEY NOT NULL,
+  collector_run_id BIGINT REFERENCES collector_run(id) ON UPDATE CASCADE ON DELETE CASCADE,
+  collector_player_id INTEGER REFERENCES collector_player(id) ON UPDATE CASCADE ON DELETE CASCADE,
+  rule TEXT NOT NULL,
+  detail TEXT NOT NULL DEFAULT '',
+  game_time DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+  previous_game_time DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+  status TEXT NOT NULL DEFAULT 'pending',
+  announced BOOLEAN NOT NULL DEFAULT FALSE,
+  time_stamp TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  reviewed_at TIMESTAMP WITH TIME ZONE,
+  UNIQUE (collector_run_id, collector_player_id, rule)
+);
+
+CREATE INDEX IF NOT EXISTS collector_anomaly_status_idx ON collector_anomaly(status);
+
 -- below are POSTGRES helper functions to make dealing with the database easier --
 
 -- this function is used internally